@@ -0,0 +1,391 @@
+// Package client is a typed Go client for the Chirpy API.
+//
+//	c := client.New("https://chirpy.example.com")
+//	if _, err := c.Login(ctx, email, password); err != nil { ... }
+//	chirp, err := c.CreateChirp(ctx, "hello")
+//
+// After Login the client sends the access token with every call that needs
+// one and, when the server answers 401, trades the refresh token for a new
+// access token and tries once more. Idempotent calls are retried on network
+// errors, 429 and 502-504. Error responses come back as *Error.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// apiPrefix is the API version the client speaks.
+const apiPrefix = "/api/v2"
+
+const (
+	DefaultMaxRetries   = 2
+	DefaultRetryBackoff = 200 * time.Millisecond
+	// maxRetryWait caps how long a Retry-After header can make us wait.
+	maxRetryWait = 30 * time.Second
+)
+
+// Client calls one Chirpy server. Set the exported fields before the first
+// call; the methods are safe for concurrent use.
+type Client struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	// PolkaKey authenticates PolkaWebhook.
+	PolkaKey string
+	// MaxRetries is how many times an idempotent call is retried. Negative
+	// disables retries.
+	MaxRetries int
+	// RetryBackoff is the wait before the first retry; it doubles after
+	// each one. A Retry-After header takes precedence.
+	RetryBackoff time.Duration
+
+	mu           sync.Mutex
+	accessToken  string
+	refreshToken string
+	// refreshMu serializes automatic refreshes, so concurrent calls that
+	// all got a 401 share one new token.
+	refreshMu sync.Mutex
+}
+
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL:      strings.TrimSuffix(baseURL, "/"),
+		HTTPClient:   http.DefaultClient,
+		MaxRetries:   DefaultMaxRetries,
+		RetryBackoff: DefaultRetryBackoff,
+	}
+}
+
+// SetTokens resumes a session saved from Tokens.
+func (c *Client) SetTokens(accessToken, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.accessToken, c.refreshToken = accessToken, refreshToken
+}
+
+// Tokens returns the current tokens, which change when the client refreshes.
+func (c *Client) Tokens() (accessToken, refreshToken string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.accessToken, c.refreshToken
+}
+
+type User struct {
+	ID          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+type Session struct {
+	User
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type Chirp struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+	// IsChirpyRed is the author's Chirpy Red status.
+	IsChirpyRed bool `json:"is_chirpy_red"`
+}
+
+type CreatedChirp struct {
+	Chirp
+	// Held is set when moderation held the chirp for review instead of
+	// publishing it.
+	Held bool `json:"-"`
+}
+
+// Sort orders for ListChirpsOptions.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+type ListChirpsOptions struct {
+	// AuthorID, when set, lists only that user's chirps.
+	AuthorID uuid.UUID
+	Sort     string
+}
+
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func (c *Client) CreateUser(ctx context.Context, email, password string) (User, error) {
+	var user User
+	_, err := c.call(ctx, http.MethodPost, apiPrefix+"/users", authNone, credentials{email, password}, &user)
+	return user, err
+}
+
+// UpdateUser changes the logged-in user's email and password.
+func (c *Client) UpdateUser(ctx context.Context, email, password string) (User, error) {
+	var user User
+	_, err := c.call(ctx, http.MethodPut, apiPrefix+"/users", authAccess, credentials{email, password}, &user)
+	return user, err
+}
+
+// Login starts a session; later calls use its tokens.
+func (c *Client) Login(ctx context.Context, email, password string) (Session, error) {
+	var session Session
+	if _, err := c.call(ctx, http.MethodPost, apiPrefix+"/login", authNone, credentials{email, password}, &session); err != nil {
+		return Session{}, err
+	}
+	c.SetTokens(session.Token, session.RefreshToken)
+	return session, nil
+}
+
+// Refresh trades the refresh token for a new access token. Calls do this on
+// their own when the access token expires.
+func (c *Client) Refresh(ctx context.Context) (string, error) {
+	var refreshed struct {
+		Token string `json:"token"`
+	}
+	if _, err := c.call(ctx, http.MethodPost, apiPrefix+"/refresh", authRefresh, nil, &refreshed); err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.accessToken = refreshed.Token
+	c.mu.Unlock()
+	return refreshed.Token, nil
+}
+
+// Revoke ends the session on the server and forgets its tokens.
+func (c *Client) Revoke(ctx context.Context) error {
+	if _, err := c.call(ctx, http.MethodPost, apiPrefix+"/revoke", authRefresh, nil, nil); err != nil {
+		return err
+	}
+	c.SetTokens("", "")
+	return nil
+}
+
+func (c *Client) ListChirps(ctx context.Context, opts ListChirpsOptions) ([]Chirp, error) {
+	query := url.Values{}
+	if opts.AuthorID != uuid.Nil {
+		query.Set("author_id", opts.AuthorID.String())
+	}
+	if opts.Sort != "" {
+		query.Set("sort", opts.Sort)
+	}
+	path := apiPrefix + "/chirps"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+
+	// Logged-in users also see their own shadow-banned chirps.
+	var chirps []Chirp
+	_, err := c.call(ctx, http.MethodGet, path, authOptional, nil, &chirps)
+	return chirps, err
+}
+
+func (c *Client) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	var chirp Chirp
+	_, err := c.call(ctx, http.MethodGet, apiPrefix+"/chirps/"+id.String(), authOptional, nil, &chirp)
+	return chirp, err
+}
+
+func (c *Client) CreateChirp(ctx context.Context, body string) (CreatedChirp, error) {
+	var chirp CreatedChirp
+	status, err := c.call(ctx, http.MethodPost, apiPrefix+"/chirps", authAccess, map[string]string{"body": body}, &chirp)
+	chirp.Held = status == http.StatusAccepted
+	return chirp, err
+}
+
+func (c *Client) DeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := c.call(ctx, http.MethodDelete, apiPrefix+"/chirps/"+id.String(), authAccess, nil, nil)
+	return err
+}
+
+// PolkaWebhook delivers a Polka event, such as "user.upgraded", signed with
+// PolkaKey.
+func (c *Client) PolkaWebhook(ctx context.Context, event string, userID uuid.UUID) error {
+	payload := map[string]any{
+		"event": event,
+		"data":  map[string]string{"user_id": userID.String()},
+	}
+	_, err := c.call(ctx, http.MethodPost, apiPrefix+"/polka/webhooks", authPolka, payload, nil)
+	return err
+}
+
+type authKind int
+
+const (
+	authNone authKind = iota
+	// authOptional sends the access token if there is one, but doesn't
+	// refresh it: the call works anonymously too.
+	authOptional
+	authAccess
+	authRefresh
+	authPolka
+)
+
+// call sends one API call and decodes a successful response into out. It
+// returns the response status, including for errors.
+func (c *Client) call(ctx context.Context, method, path string, auth authKind, in, out any) (int, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return 0, err
+		}
+	}
+
+	resp, token, err := c.send(ctx, method, path, auth, body)
+	if err != nil {
+		return 0, err
+	}
+	if _, refreshToken := c.Tokens(); resp.StatusCode == http.StatusUnauthorized && auth == authAccess && refreshToken != "" {
+		resp.Body.Close()
+		if err := c.refreshAfter(ctx, token); err != nil {
+			return http.StatusUnauthorized, err
+		}
+		if resp, _, err = c.send(ctx, method, path, auth, body); err != nil {
+			return 0, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return resp.StatusCode, decodeError(resp)
+	}
+	if out != nil && resp.StatusCode != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp.StatusCode, err
+		}
+	}
+	return resp.StatusCode, nil
+}
+
+// refreshAfter refreshes the access token unless another call already
+// replaced the one that was rejected.
+func (c *Client) refreshAfter(ctx context.Context, rejected string) error {
+	c.refreshMu.Lock()
+	defer c.refreshMu.Unlock()
+	if current, _ := c.Tokens(); current != rejected {
+		return nil
+	}
+	_, err := c.Refresh(ctx)
+	return err
+}
+
+// send makes the request, retrying idempotent methods. It also returns the
+// token it sent, so a 401 can tell whether that token is still current.
+func (c *Client) send(ctx context.Context, method, path string, auth authKind, body []byte) (*http.Response, string, error) {
+	retries := 0
+	if isIdempotent(method) {
+		retries = max(c.MaxRetries, 0)
+	}
+	backoff := c.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		req, token, err := c.newRequest(ctx, method, path, auth, body)
+		if err != nil {
+			return nil, "", err
+		}
+		resp, err := c.HTTPClient.Do(req)
+		if attempt == retries || !shouldRetry(resp, err) {
+			return resp, token, err
+		}
+
+		wait := backoff
+		if resp != nil {
+			if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+				wait = min(time.Duration(seconds)*time.Second, maxRetryWait)
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		backoff *= 2
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (c *Client) newRequest(ctx context.Context, method, path string, auth authKind, body []byte) (*http.Request, string, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.BaseURL+path, reader)
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	accessToken, refreshToken := c.Tokens()
+	var token string
+	switch auth {
+	case authOptional, authAccess:
+		token = accessToken
+	case authRefresh:
+		token = refreshToken
+	case authPolka:
+		req.Header.Set("Authorization", "ApiKey "+c.PolkaKey)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, token, nil
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+func shouldRetry(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// decodeError reads a problem body, falling back to the raw body for
+// responses that didn't come from Chirpy's handlers.
+func decodeError(resp *http.Response) error {
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType == "application/problem+json" || mediaType == "application/json" {
+		var problem Error
+		if json.Unmarshal(data, &problem) == nil && problem.Code != "" {
+			problem.StatusCode = resp.StatusCode
+			return &problem
+		}
+	}
+	return &Error{StatusCode: resp.StatusCode, Detail: strings.TrimSpace(string(data))}
+}
@@ -0,0 +1,239 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/client"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/handlers"
+	"github.com/k3vwdd/chirpyWS/internal/testenv"
+)
+
+// newServer serves the handlers the client calls, backed by an in-memory
+// store. wrap, if set, sits in front of them.
+func newServer(t *testing.T, wrap func(http.Handler) http.Handler) *client.Client {
+	t.Helper()
+	cfg := &handlers.ApiConfig{ApiConfig: testenv.New(t).Config}
+
+	mux := http.NewServeMux()
+	for pattern, handler := range map[string]http.HandlerFunc{
+		"POST /users":              cfg.HandleCreateUser,
+		"PUT /users":               cfg.HandleUpdateUser,
+		"POST /login":              cfg.HandleLogin,
+		"POST /refresh":            cfg.HandleRefresh,
+		"POST /revoke":             cfg.HandleRevokeToken,
+		"GET /chirps":              cfg.HandleGetChirps,
+		"POST /chirps":             cfg.HandleCreateChirp,
+		"GET /chirps/{chirpID}":    cfg.HandleGetSingleChirp,
+		"DELETE /chirps/{chirpID}": cfg.HandleDeleteChirp,
+		"POST /polka/webhooks":     cfg.HandleWebHook,
+	} {
+		method, path, _ := strings.Cut(pattern, " ")
+		mux.Handle(method+" "+handlers.V2Prefix+path, handlers.Versioned(handlers.APIv2, handlers.V2Prefix, handler))
+	}
+
+	var handler http.Handler = mux
+	if wrap != nil {
+		handler = wrap(mux)
+	}
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	c := client.New(server.URL)
+	c.HTTPClient = server.Client()
+	c.PolkaKey = testenv.PolkaKey
+	c.RetryBackoff = time.Millisecond
+	return c
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	c := newServer(t, nil)
+
+	user, err := c.CreateUser(ctx, "alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Login(ctx, "alice@example.com", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := c.CreateChirp(ctx, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.UserID != user.ID || first.Held {
+		t.Errorf("created chirp = %+v", first)
+	}
+	if _, err := c.CreateChirp(ctx, "second"); err != nil {
+		t.Fatal(err)
+	}
+
+	chirps, err := c.ListChirps(ctx, client.ListChirpsOptions{AuthorID: user.ID, Sort: client.SortDesc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 2 || chirps[0].Body != "second" {
+		t.Errorf("chirps = %+v, want second then first", chirps)
+	}
+	chirps, err = c.ListChirps(ctx, client.ListChirpsOptions{AuthorID: uuid.New()})
+	if err != nil || len(chirps) != 0 {
+		t.Errorf("another author's chirps = %+v, %v", chirps, err)
+	}
+
+	got, err := c.GetChirp(ctx, first.ID)
+	if err != nil || got.Body != "first" {
+		t.Errorf("GetChirp = %+v, %v", got, err)
+	}
+	if err := c.DeleteChirp(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.GetChirp(ctx, first.ID); !errors.Is(err, client.ErrNotFound) {
+		t.Errorf("GetChirp after delete = %v, want ErrNotFound", err)
+	}
+
+	if _, err := c.UpdateUser(ctx, "alice@example.org", "hunter3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.PolkaWebhook(ctx, "user.upgraded", user.ID); err != nil {
+		t.Fatal(err)
+	}
+	session, err := c.Login(ctx, "alice@example.org", "hunter3")
+	if err != nil || !session.IsChirpyRed {
+		t.Errorf("Login after upgrade = %+v, %v", session, err)
+	}
+	chirps, err = c.ListChirps(ctx, client.ListChirpsOptions{})
+	if err != nil || len(chirps) != 1 || !chirps[0].IsChirpyRed {
+		t.Errorf("chirps after upgrade = %+v, %v", chirps, err)
+	}
+
+	if err := c.Revoke(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if access, refresh := c.Tokens(); access != "" || refresh != "" {
+		t.Error("Revoke kept the tokens")
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+	c := newServer(t, nil)
+
+	if _, err := c.CreateUser(ctx, "alice@example.com", "hunter2"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := c.CreateUser(ctx, "alice@example.com", "hunter2")
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || apiErr.Code != client.CodeEmailTaken || !errors.Is(err, client.ErrConflict) {
+		t.Errorf("duplicate sign-up = %#v", err)
+	}
+
+	_, err = c.CreateUser(ctx, "not an email", "")
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrValidation) || len(apiErr.Fields) != 2 {
+		t.Errorf("invalid sign-up = %#v", err)
+	}
+
+	_, err = c.Login(ctx, "alice@example.com", "wrong")
+	if !errors.As(err, &apiErr) || apiErr.Code != client.CodeInvalidCredentials {
+		t.Errorf("bad login = %#v", err)
+	}
+
+	// Without a session there is nothing to refresh: the 401 comes straight back.
+	if _, err := c.CreateChirp(ctx, "hello"); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("anonymous CreateChirp = %v", err)
+	}
+
+	c.PolkaKey = "wrong"
+	if err := c.PolkaWebhook(ctx, "user.upgraded", uuid.New()); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("webhook with the wrong key = %v", err)
+	}
+}
+
+func TestClientRefreshesExpiredToken(t *testing.T) {
+	ctx := context.Background()
+	c := newServer(t, nil)
+
+	user, err := c.CreateUser(ctx, "alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := c.Login(ctx, "alice@example.com", "hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := auth.MakeJWT(user.ID, testenv.JWTKey, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SetTokens(expired, session.RefreshToken)
+
+	if _, err := c.CreateChirp(ctx, "after refresh"); err != nil {
+		t.Fatalf("CreateChirp with an expired token = %v", err)
+	}
+	if access, _ := c.Tokens(); access == expired || access == "" {
+		t.Error("the access token wasn't replaced")
+	}
+
+	// Once the refresh token is revoked, the refresh's own 401 is returned.
+	if err := c.Revoke(ctx); err != nil {
+		t.Fatal(err)
+	}
+	c.SetTokens(expired, session.RefreshToken)
+	if _, err := c.CreateChirp(ctx, "too late"); !errors.Is(err, client.ErrUnauthorized) {
+		t.Errorf("CreateChirp with a revoked session = %v", err)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	ctx := context.Background()
+	var failures, calls atomic.Int32
+	c := newServer(t, func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			if failures.Load() > 0 {
+				failures.Add(-1)
+				w.Header().Set("Retry-After", "0")
+				http.Error(w, "upstream unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	failures.Store(2)
+	if _, err := c.ListChirps(ctx, client.ListChirpsOptions{}); err != nil {
+		t.Errorf("ListChirps after two 503s = %v", err)
+	}
+	if calls.Load() != 3 {
+		t.Errorf("ListChirps made %d requests, want 3", calls.Load())
+	}
+
+	failures.Store(3)
+	calls.Store(0)
+	_, err := c.ListChirps(ctx, client.ListChirpsOptions{})
+	var apiErr *client.Error
+	if !errors.As(err, &apiErr) || !errors.Is(err, client.ErrServer) || apiErr.Detail != "upstream unavailable" {
+		t.Errorf("ListChirps after three 503s = %#v", err)
+	}
+
+	// POST isn't idempotent, so it's never retried.
+	failures.Store(1)
+	calls.Store(0)
+	if _, err := c.CreateUser(ctx, "alice@example.com", "hunter2"); !errors.Is(err, client.ErrServer) {
+		t.Errorf("CreateUser after a 503 = %v", err)
+	}
+	if calls.Load() != 1 {
+		t.Errorf("CreateUser made %d requests, want 1", calls.Load())
+	}
+}
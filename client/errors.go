@@ -0,0 +1,95 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Codes the server puts in Error.Code. They never change meaning.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidJSON        = "invalid_json"
+	CodeBodyTooLarge       = "body_too_large"
+	CodeValidationFailed   = "validation_failed"
+	CodeContentRejected    = "content_rejected"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeAccountSuspended   = "account_suspended"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeEmailTaken         = "email_taken"
+	CodePreconditionFailed = "precondition_failed"
+	CodeIdempotencyReused  = "idempotency_key_reused"
+	CodeIdempotencyInUse   = "idempotency_key_in_use"
+	CodeRateLimited        = "rate_limited"
+	CodeInternal           = "internal_error"
+)
+
+// Sentinels for errors.Is. Each matches every *Error with its status, so
+// errors.Is(err, ErrNotFound) works whatever the code.
+var (
+	ErrValidation   = errors.New("chirpy: invalid request")
+	ErrUnauthorized = errors.New("chirpy: unauthorized")
+	ErrForbidden    = errors.New("chirpy: forbidden")
+	ErrNotFound     = errors.New("chirpy: not found")
+	ErrConflict     = errors.New("chirpy: conflict")
+	ErrPrecondition = errors.New("chirpy: precondition failed")
+	ErrRateLimited  = errors.New("chirpy: rate limited")
+	ErrServer       = errors.New("chirpy: server error")
+)
+
+// FieldError is one invalid field of a rejected request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an error response from the server, decoded from its RFC 7807
+// problem body. Responses that aren't problems, such as a proxy's 502, keep
+// the status and put the body in Detail.
+type Error struct {
+	StatusCode int          `json:"status"`
+	Code       string       `json:"code"`
+	Type       string       `json:"type"`
+	Title      string       `json:"title"`
+	Detail     string       `json:"detail"`
+	Instance   string       `json:"instance"`
+	RequestID  string       `json:"request_id"`
+	Fields     []FieldError `json:"errors"`
+}
+
+func (e *Error) Error() string {
+	code := e.Code
+	if code == "" {
+		code = http.StatusText(e.StatusCode)
+	}
+	if e.Detail == "" {
+		return fmt.Sprintf("chirpy: %d %s", e.StatusCode, code)
+	}
+	return fmt.Sprintf("chirpy: %d %s: %s", e.StatusCode, code, e.Detail)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrValidation:
+		return e.StatusCode == http.StatusBadRequest || e.StatusCode == http.StatusRequestEntityTooLarge ||
+			e.StatusCode == http.StatusUnprocessableEntity
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized
+	case ErrForbidden:
+		return e.StatusCode == http.StatusForbidden
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrConflict:
+		return e.StatusCode == http.StatusConflict
+	case ErrPrecondition:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrRateLimited:
+		return e.StatusCode == http.StatusTooManyRequests
+	case ErrServer:
+		return e.StatusCode >= http.StatusInternalServerError
+	}
+	return false
+}
@@ -0,0 +1,619 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/config"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/migrations"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	"github.com/k3vwdd/chirpyWS/internal/types"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+	"golang.org/x/term"
+)
+
+// cliStore is what the commands query: database.Store plus the queries
+// only they run. *database.Queries implements it; tests use memstore.
+type cliStore interface {
+	database.Store
+	DeleteChirpsByAuthorID(ctx context.Context, userID uuid.UUID) (int64, error)
+	ListAllChirps(ctx context.Context) ([]database.Chirp, error)
+	ListUsers(ctx context.Context) ([]database.User, error)
+	RevokeRefreshTokensForUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	SetUserRole(ctx context.Context, arg database.SetUserRoleParams) error
+}
+
+// cli is what every admin command gets: the same queries the API uses, plus
+// somewhere to read passwords from and write results to.
+type cli struct {
+	conf    config.Config
+	db      *sql.DB
+	queries cliStore
+	// inTx runs fn with queries bound to one transaction, which is
+	// committed if fn succeeds and rolled back otherwise.
+	inTx func(ctx context.Context, fn func(q cliStore) error) error
+	in   *bufio.Reader
+	out  io.Writer
+	// terminal is set when stdin is a terminal, so passwords aren't echoed.
+	terminal bool
+}
+
+type command struct {
+	run func(ctx context.Context, c *cli, args []string) error
+	// rawSchema commands work on a database at any schema version.
+	rawSchema bool
+}
+
+var commands = map[string]command{
+	"migrate":             {run: cmdMigrate, rawSchema: true},
+	"user create":         {run: cmdUserCreate},
+	"user set-role":       {run: cmdUserSetRole},
+	"user upgrade-red":    {run: cmdUserUpgradeRed},
+	"user reset-password": {run: cmdUserResetPassword},
+	"tokens revoke-user":  {run: cmdTokensRevokeUser},
+	"chirps purge":        {run: cmdChirpsPurge},
+	"seed":                {run: cmdSeed},
+	"export":              {run: cmdExport},
+}
+
+// findCommand finds the command named by the first one or two words of args
+// and returns the arguments left for it.
+func findCommand(args []string) (command, []string, error) {
+	name, rest := args[0], args[1:]
+	cmd, ok := commands[name]
+	if !ok && len(rest) > 0 {
+		name, rest = name+" "+rest[0], rest[1:]
+		cmd, ok = commands[name]
+	}
+	if !ok {
+		return command{}, nil, fmt.Errorf("unknown command %q; run chirpy help", strings.Join(args, " "))
+	}
+	return cmd, rest, nil
+}
+
+// runCommand runs the command args names against the configured database.
+func runCommand(args []string) error {
+	cmd, rest, err := findCommand(args)
+	if err != nil {
+		return err
+	}
+
+	conf, err := config.Load(nil, config.Options{DatabaseOnly: true})
+	if err != nil {
+		return err
+	}
+
+	db, err := sql.Open("postgres", conf.DBURL)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if !cmd.rawSchema {
+		migrator, err := migrations.New(db)
+		if err != nil {
+			return err
+		}
+		if err := migrator.Check(ctx); err != nil {
+			return err
+		}
+	}
+
+	queries := database.New(db)
+	return cmd.run(ctx, &cli{
+		conf:     conf,
+		db:       db,
+		queries:  queries,
+		inTx:     sqlTx(db, queries),
+		in:       bufio.NewReader(os.Stdin),
+		out:      os.Stdout,
+		terminal: term.IsTerminal(int(os.Stdin.Fd())),
+	}, rest)
+}
+
+// parseFlags parses a command's flags and rejects stray arguments.
+func parseFlags(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("%s: unexpected arguments: %s", fs.Name(), strings.Join(fs.Args(), " "))
+	}
+	return nil
+}
+
+// findUser accepts either a user ID or an email address.
+func (c *cli) findUser(ctx context.Context, ref string) (database.User, error) {
+	if ref == "" {
+		return database.User{}, errors.New("no user given")
+	}
+	var user database.User
+	var err error
+	if id, parseErr := uuid.Parse(ref); parseErr == nil {
+		user, err = c.queries.GetUserByID(ctx, id)
+	} else {
+		user, err = c.queries.GetUserByEmail(ctx, ref)
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, fmt.Errorf("no user %q", ref)
+	}
+	return user, err
+}
+
+// readPassword prompts for a password without echoing it when stdin is a
+// terminal, and otherwise takes the first line of stdin, so passwords stay
+// out of shell history and the process list.
+func (c *cli) readPassword() (string, error) {
+	var password string
+	if c.terminal {
+		fmt.Fprint(os.Stderr, "Password: ")
+		line, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		password = string(line)
+	} else {
+		line, err := c.in.ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		return "", errors.New("empty password")
+	}
+	return password, nil
+}
+
+// hashPassword applies the API's limit: bcrypt only looks at 72 bytes.
+func hashPassword(password string) (string, error) {
+	hashed, err := auth.HashPassword(password)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", errors.New("password must be at most 72 bytes")
+	}
+	return hashed, err
+}
+
+// validate checks v's validate tags as the API does.
+func validate(v any) error {
+	var problems []string
+	for _, detail := range utils.Validate(v) {
+		problems = append(problems, detail.Field+" "+detail.Message)
+	}
+	if len(problems) > 0 {
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// sqlTx is cli.inTx for a Postgres database.
+func sqlTx(db *sql.DB, queries *database.Queries) func(ctx context.Context, fn func(q cliStore) error) error {
+	return func(ctx context.Context, fn func(q cliStore) error) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer tx.Rollback()
+
+		if err := fn(queries.WithTx(tx)); err != nil {
+			return err
+		}
+		return tx.Commit()
+	}
+}
+
+func cmdMigrate(ctx context.Context, c *cli, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: chirpy migrate up|down|status|redo|version")
+	}
+
+	runner, err := migrations.New(c.db)
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		results, err := runner.Up(ctx)
+		for _, result := range results {
+			fmt.Fprintf(c.out, "applied %s (%s)\n", result.Source.Path, result.Duration.Round(time.Millisecond))
+		}
+		if err != nil {
+			return err
+		}
+		if len(results) == 0 {
+			fmt.Fprintln(c.out, "already up to date")
+		}
+	case "down":
+		result, err := runner.Down(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "rolled back %s\n", result.Source.Path)
+	case "redo":
+		results, err := runner.Redo(ctx)
+		for _, result := range results {
+			fmt.Fprintf(c.out, "%s %s\n", result.Direction, result.Source.Path)
+		}
+		return err
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		for _, status := range statuses {
+			applied := "pending"
+			if !status.AppliedAt.IsZero() {
+				applied = status.AppliedAt.Format(time.RFC3339)
+			}
+			fmt.Fprintf(c.out, "%-45s %s\n", status.Source.Path, applied)
+		}
+	case "version":
+		version, err := runner.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.out, "database %d, build %d\n", version, runner.Expected())
+	default:
+		return fmt.Errorf("unknown migrate command %q", args[0])
+	}
+	return nil
+}
+
+func cmdUserCreate(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("user create", flag.ContinueOnError)
+	email := fs.String("email", "", "email address")
+	role := fs.String("role", auth.RoleUser, "user, moderator or admin")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if *email == "" {
+		return errors.New("--email is required")
+	}
+	if !auth.ValidRole(*role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	if err := validate(service.Credentials{Email: *email, Password: password}); err != nil {
+		return err
+	}
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	var user database.User
+	err = c.inTx(ctx, func(q cliStore) error {
+		user, err = q.CreateUser(ctx, database.CreateUserParams{
+			ID:             uuid.New(),
+			CreatedAt:      time.Now(),
+			UpdatedAt:      time.Now(),
+			Email:          *email,
+			HashedPassword: hashed,
+		})
+		if database.IsUniqueViolation(err) {
+			return fmt.Errorf("%s is already registered", *email)
+		}
+		if err != nil || *role == auth.RoleUser {
+			return err
+		}
+		return q.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: *role})
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "created %s %s (%s)\n", *role, user.Email, user.ID)
+	return nil
+}
+
+func cmdUserSetRole(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("user set-role", flag.ContinueOnError)
+	email := fs.String("email", "", "email address or user ID")
+	role := fs.String("role", "", "user, moderator or admin")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if !auth.ValidRole(*role) {
+		return fmt.Errorf("unknown role %q", *role)
+	}
+
+	user, err := c.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	err = c.queries.SetUserRole(ctx, database.SetUserRoleParams{ID: user.ID, Role: *role})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%s is now %s (was %s)\n", user.Email, *role, user.Role)
+	return nil
+}
+
+func cmdUserUpgradeRed(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("user upgrade-red", flag.ContinueOnError)
+	email := fs.String("email", "", "email address or user ID")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	user, err := c.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	if err := c.queries.UpgradeUserToChirpyRed(ctx, user.ID); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "%s is now Chirpy Red\n", user.Email)
+	return nil
+}
+
+func cmdUserResetPassword(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("user reset-password", flag.ContinueOnError)
+	email := fs.String("email", "", "email address or user ID")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	user, err := c.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	password, err := c.readPassword()
+	if err != nil {
+		return err
+	}
+	hashed, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
+	err = c.queries.UpdateUserEmailAndPassword(ctx, database.UpdateUserEmailAndPasswordParams{
+		ID:             user.ID,
+		Email:          user.Email,
+		HashedPassword: hashed,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "password reset for %s; existing sessions stay valid until revoked with tokens revoke-user\n", user.Email)
+	return nil
+}
+
+func cmdTokensRevokeUser(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("tokens revoke-user", flag.ContinueOnError)
+	email := fs.String("email", "", "email address or user ID")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	user, err := c.findUser(ctx, *email)
+	if err != nil {
+		return err
+	}
+	revoked, err := c.queries.RevokeRefreshTokensForUser(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "revoked %d refresh tokens for %s\n", revoked, user.Email)
+	return nil
+}
+
+func cmdChirpsPurge(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("chirps purge", flag.ContinueOnError)
+	author := fs.String("author", "", "email address or user ID of the author")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	user, err := c.findUser(ctx, *author)
+	if err != nil {
+		return err
+	}
+	deleted, err := c.queries.DeleteChirpsByAuthorID(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "deleted %d chirps by %s\n", deleted, user.Email)
+	return nil
+}
+
+var seedBodies = []string{
+	"Just setting up my chirpy.",
+	"Gophers are the best mascots.",
+	"Is it too early for coffee? Asking for a friend.",
+	"I love a good ServeMux.",
+	"Shipping on a Friday, wish me luck.",
+	"Postgres is my favourite database.",
+	"Who else is excited about range over func?",
+}
+
+const seedUsers = 5
+
+// cmdSeed fills a dev database with sample chirps. The chirps are posted
+// through the service like any other, so moderation rules apply and their
+// hits are logged; rejected ones are skipped.
+func cmdSeed(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("seed", flag.ContinueOnError)
+	count := fs.Int("count", 20, "number of chirps to create")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+	if c.conf.Platform != "dev" {
+		return errors.New("seed only runs with PLATFORM=dev")
+	}
+	if *count < 1 {
+		return errors.New("--count must be at least 1")
+	}
+
+	engine := moderation.NewEngine(c.queries)
+	if err := engine.Reload(ctx); err != nil {
+		return err
+	}
+	svc := service.New(&types.ApiConfig{
+		Db:         c.queries,
+		Metrics:    metrics.New(nil),
+		Platform:   c.conf.Platform,
+		Moderation: engine,
+	})
+
+	hashed, err := auth.HashPassword("password")
+	if err != nil {
+		return err
+	}
+	var users []database.User
+	for i := 1; i <= seedUsers; i++ {
+		email := fmt.Sprintf("seed%d@example.com", i)
+		user, err := c.queries.GetUserByEmail(ctx, email)
+		if errors.Is(err, sql.ErrNoRows) {
+			user, err = c.queries.CreateUser(ctx, database.CreateUserParams{
+				ID:             uuid.New(),
+				CreatedAt:      time.Now(),
+				UpdatedAt:      time.Now(),
+				Email:          email,
+				HashedPassword: hashed,
+			})
+		}
+		if err != nil {
+			return err
+		}
+		users = append(users, user)
+	}
+
+	created := 0
+	for i := 0; i < *count; i++ {
+		_, err := svc.PostChirp(ctx, users[i%len(users)], service.NewChirp{Body: seedBodies[i%len(seedBodies)]})
+		var apiErr *utils.Error
+		if errors.As(err, &apiErr) && apiErr.Code == utils.CodeContentRejected {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		created++
+	}
+
+	fmt.Fprintf(c.out, "created %d chirps from %d users (password \"password\")\n", created, len(users))
+	return nil
+}
+
+type exportUser struct {
+	ID             uuid.UUID  `json:"id"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	Email          string     `json:"email"`
+	IsChirpyRed    bool       `json:"is_chirpy_red"`
+	Role           string     `json:"role"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+	ShadowBanned   bool       `json:"shadow_banned"`
+}
+
+type exportChirp struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserID    uuid.UUID `json:"user_id"`
+	Status    string    `json:"status"`
+}
+
+// cmdExport writes every user and chirp as one JSON document. Password
+// hashes and tokens are left out.
+func cmdExport(ctx context.Context, c *cli, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	out := fs.String("out", "", "file to write instead of stdout")
+	if err := parseFlags(fs, args); err != nil {
+		return err
+	}
+
+	users, err := c.queries.ListUsers(ctx)
+	if err != nil {
+		return err
+	}
+	chirps, err := c.queries.ListAllChirps(ctx)
+	if err != nil {
+		return err
+	}
+
+	doc := struct {
+		ExportedAt time.Time     `json:"exported_at"`
+		Users      []exportUser  `json:"users"`
+		Chirps     []exportChirp `json:"chirps"`
+	}{ExportedAt: time.Now().UTC(), Users: []exportUser{}, Chirps: []exportChirp{}}
+
+	for _, user := range users {
+		exported := exportUser{
+			ID:           user.ID,
+			CreatedAt:    user.CreatedAt,
+			UpdatedAt:    user.UpdatedAt,
+			Email:        user.Email,
+			IsChirpyRed:  user.IsChirpyRed,
+			Role:         user.Role,
+			ShadowBanned: user.ShadowBanned,
+		}
+		if user.SuspendedUntil.Valid {
+			exported.SuspendedUntil = &user.SuspendedUntil.Time
+		}
+		doc.Users = append(doc.Users, exported)
+	}
+	for _, chirp := range chirps {
+		doc.Chirps = append(doc.Chirps, exportChirp{
+			ID:        chirp.ID,
+			CreatedAt: chirp.CreatedAt,
+			UpdatedAt: chirp.UpdatedAt,
+			Body:      chirp.Body,
+			UserID:    chirp.UserID,
+			Status:    chirp.Status,
+		})
+	}
+
+	w := c.out
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return err
+	}
+	if *out != "" {
+		fmt.Fprintf(os.Stderr, "exported %d users and %d chirps to %s\n", len(doc.Users), len(doc.Chirps), *out)
+	}
+	return nil
+}
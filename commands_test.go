@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/memstore"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+)
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args   []string
+		action int
+		rest   []string
+	}{
+		{nil, actionServe, nil},
+		{[]string{"serve"}, actionServe, []string{}},
+		{[]string{"serve", "-port", "9000"}, actionServe, []string{"-port", "9000"}},
+		{[]string{"-port", "9000"}, actionServe, []string{"-port", "9000"}},
+		{[]string{"help"}, actionHelp, nil},
+		{[]string{"--help"}, actionHelp, nil},
+		{[]string{"-h"}, actionHelp, nil},
+		{[]string{"user", "create", "--email", "a@example.com"}, actionCommand, []string{"user", "create", "--email", "a@example.com"}},
+		// An empty argument is an unknown command rather than a panic.
+		{[]string{""}, actionCommand, []string{""}},
+	}
+	for _, tt := range tests {
+		action, rest := parseArgs(tt.args)
+		if action != tt.action || !slices.Equal(rest, tt.rest) {
+			t.Errorf("parseArgs(%q) = %d, %q; want %d, %q", tt.args, action, rest, tt.action, tt.rest)
+		}
+	}
+}
+
+func TestFindCommand(t *testing.T) {
+	tests := []struct {
+		args    []string
+		rest    []string
+		wantErr bool
+	}{
+		{args: []string{"migrate", "up"}, rest: []string{"up"}},
+		{args: []string{"user", "create", "--email", "a@example.com"}, rest: []string{"--email", "a@example.com"}},
+		{args: []string{"chirps", "purge"}, rest: []string{}},
+		{args: []string{"user"}, wantErr: true},
+		{args: []string{"user", "delete"}, wantErr: true},
+		{args: []string{""}, wantErr: true},
+	}
+	for _, tt := range tests {
+		_, rest, err := findCommand(tt.args)
+		if (err != nil) != tt.wantErr || !slices.Equal(rest, tt.rest) {
+			t.Errorf("findCommand(%q) = %q, %v", tt.args, rest, err)
+		}
+	}
+}
+
+// newTestCLI runs commands against an in-memory store with stdin as the
+// input.
+func newTestCLI(store *memstore.Store, stdin string) (*cli, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &cli{
+		queries: store,
+		// memstore has no transactions; fn sees each write as it happens.
+		inTx: func(ctx context.Context, fn func(q cliStore) error) error {
+			return fn(store)
+		},
+		in:  bufio.NewReader(strings.NewReader(stdin)),
+		out: out,
+	}, out
+}
+
+func createTestUser(t *testing.T, store *memstore.Store, email string) database.User {
+	t.Helper()
+	user, err := store.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Email:     email,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func TestUserCreate(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		stdin    string
+		wantErr  string
+		wantRole string
+	}{
+		{name: "user", args: []string{"--email", "new@example.com"}, stdin: "hunter2\n", wantRole: auth.RoleUser},
+		{name: "admin", args: []string{"--email", "new@example.com", "--role", "admin"}, stdin: "hunter2\n", wantRole: auth.RoleAdmin},
+		{name: "no newline", args: []string{"--email", "new@example.com"}, stdin: "hunter2", wantRole: auth.RoleUser},
+		{name: "no email", args: nil, stdin: "hunter2\n", wantErr: "--email is required"},
+		{name: "invalid email", args: []string{"--email", "not-an-email"}, stdin: "hunter2\n", wantErr: "email"},
+		{name: "long email", args: []string{"--email", strings.Repeat("a", 250) + "@example.com"}, stdin: "hunter2\n", wantErr: "email"},
+		{name: "unknown role", args: []string{"--email", "new@example.com", "--role", "owner"}, stdin: "hunter2\n", wantErr: `unknown role "owner"`},
+		{name: "empty password", args: []string{"--email", "new@example.com"}, stdin: "\n", wantErr: "empty password"},
+		{name: "long password", args: []string{"--email", "new@example.com"}, stdin: strings.Repeat("p", 73) + "\n", wantErr: "72 bytes"},
+		{name: "taken email", args: []string{"--email", "taken@example.com"}, stdin: "hunter2\n", wantErr: "already registered"},
+		{name: "stray argument", args: []string{"--email", "new@example.com", "extra"}, stdin: "hunter2\n", wantErr: "unexpected arguments"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memstore.New()
+			createTestUser(t, store, "taken@example.com")
+			c, out := newTestCLI(store, tt.stdin)
+
+			err := cmdUserCreate(context.Background(), c, tt.args)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want one containing %q", err, tt.wantErr)
+				}
+				if users, _ := store.ListUsers(context.Background()); len(users) != 1 {
+					t.Errorf("a failed create left %d users", len(users))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			user, err := store.GetUserByEmail(context.Background(), "new@example.com")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role = %q, want %q", user.Role, tt.wantRole)
+			}
+			if err := auth.CheckPasswordHash("hunter2", user.HashedPassword); err != nil {
+				t.Errorf("password wasn't stored: %v", err)
+			}
+			if !strings.Contains(out.String(), user.ID.String()) {
+				t.Errorf("output %q doesn't name the user", out)
+			}
+		})
+	}
+}
+
+func TestUserSetRole(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     func(user database.User) []string
+		wantErr  string
+		wantRole string
+	}{
+		{name: "by email", args: func(u database.User) []string { return []string{"--email", u.Email, "--role", "moderator"} }, wantRole: auth.RoleModerator},
+		{name: "by ID", args: func(u database.User) []string { return []string{"--email", u.ID.String(), "--role", "admin"} }, wantRole: auth.RoleAdmin},
+		{name: "unknown role", args: func(u database.User) []string { return []string{"--email", u.Email, "--role", "owner"} }, wantErr: "unknown role", wantRole: auth.RoleUser},
+		{name: "no role", args: func(u database.User) []string { return []string{"--email", u.Email} }, wantErr: "unknown role", wantRole: auth.RoleUser},
+		{name: "unknown user", args: func(u database.User) []string { return []string{"--email", "nobody@example.com", "--role", "admin"} }, wantErr: "no user", wantRole: auth.RoleUser},
+		{name: "no user", args: func(u database.User) []string { return []string{"--role", "admin"} }, wantErr: "no user given", wantRole: auth.RoleUser},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := memstore.New()
+			user := createTestUser(t, store, "alice@example.com")
+			c, _ := newTestCLI(store, "")
+
+			err := cmdUserSetRole(context.Background(), c, tt.args(user))
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			} else if tt.wantErr == "" && err != nil {
+				t.Fatal(err)
+			}
+
+			user, err = store.GetUserByID(context.Background(), user.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if user.Role != tt.wantRole {
+				t.Errorf("role = %q, want %q", user.Role, tt.wantRole)
+			}
+		})
+	}
+}
+
+func TestTokensRevokeUser(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	alice := createTestUser(t, store, "alice@example.com")
+	bob := createTestUser(t, store, "bob@example.com")
+	for _, token := range []struct {
+		token  string
+		userID uuid.UUID
+	}{{"alice-1", alice.ID}, {"alice-2", alice.ID}, {"alice-3", alice.ID}, {"bob-1", bob.ID}} {
+		if err := store.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: token.token, UserID: token.userID}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.RevokeRefreshToken(ctx, "alice-3"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args    []string
+		wantOut string
+		wantErr string
+	}{
+		{args: []string{"--email", "alice@example.com"}, wantOut: "revoked 2 refresh tokens"},
+		{args: []string{"--email", alice.ID.String()}, wantOut: "revoked 0 refresh tokens"},
+		{args: []string{"--email", "nobody@example.com"}, wantErr: "no user"},
+		{args: nil, wantErr: "no user given"},
+	}
+	for _, tt := range tests {
+		c, out := newTestCLI(store, "")
+		err := cmdTokensRevokeUser(ctx, c, tt.args)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: got error %v, want one containing %q", tt.args, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !strings.Contains(out.String(), tt.wantOut) {
+			t.Errorf("%q: got %q, %v; want %q", tt.args, out, err, tt.wantOut)
+		}
+	}
+
+	for _, token := range []string{"alice-1", "alice-2"} {
+		if _, err := store.GetUserFromRefreshToken(ctx, token); err == nil {
+			t.Errorf("%s still works", token)
+		}
+	}
+	if _, err := store.GetUserFromRefreshToken(ctx, "bob-1"); err != nil {
+		t.Errorf("bob's token was revoked: %v", err)
+	}
+}
+
+func TestChirpsPurge(t *testing.T) {
+	tests := []struct {
+		name    string
+		author  func(alice database.User) string
+		wantOut string
+		wantErr string
+		left    int
+	}{
+		{name: "by email", author: func(u database.User) string { return u.Email }, wantOut: "deleted 2 chirps by alice@example.com", left: 1},
+		{name: "by ID", author: func(u database.User) string { return u.ID.String() }, wantOut: "deleted 2 chirps", left: 1},
+		{name: "unknown author", author: func(database.User) string { return "nobody@example.com" }, wantErr: "no user", left: 3},
+		{name: "no author", author: func(database.User) string { return "" }, wantErr: "no user given", left: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			store := memstore.New()
+			alice := createTestUser(t, store, "alice@example.com")
+			bob := createTestUser(t, store, "bob@example.com")
+			for _, author := range []uuid.UUID{alice.ID, alice.ID, bob.ID} {
+				_, err := store.CreateChirp(ctx, database.CreateChirpParams{
+					ID: uuid.New(), CreatedAt: time.Now(), UpdatedAt: time.Now(), Body: "hello", UserID: author, Status: service.ChirpPublished,
+				})
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			c, out := newTestCLI(store, "")
+
+			err := cmdChirpsPurge(ctx, c, []string{"--author", tt.author(alice)})
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("got error %v, want one containing %q", err, tt.wantErr)
+			} else if tt.wantErr == "" && (err != nil || !strings.Contains(out.String(), tt.wantOut)) {
+				t.Errorf("got %q, %v; want %q", out, err, tt.wantOut)
+			}
+
+			chirps, err := store.ListAllChirps(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chirps) != tt.left {
+				t.Errorf("%d chirps left, want %d", len(chirps), tt.left)
+			}
+			for _, chirp := range chirps {
+				if tt.wantErr == "" && chirp.UserID != bob.ID {
+					t.Errorf("alice's chirp %v survived the purge", chirp.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestSeed(t *testing.T) {
+	ctx := context.Background()
+	store := memstore.New()
+	for _, rule := range []database.CreateModerationRuleParams{
+		{Kind: moderation.KindWord, Pattern: "servemux", Action: moderation.ActionReject},
+		{Kind: moderation.KindWord, Pattern: "coffee", Action: moderation.ActionHold},
+	} {
+		rule.ID, rule.Enabled = uuid.New(), true
+		if _, err := store.CreateModerationRule(ctx, rule); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c, out := newTestCLI(store, "")
+	c.conf.Platform = "dev"
+
+	if err := cmdSeed(ctx, c, []string{"--count", fmt.Sprint(len(seedBodies))}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "created 6 chirps from 5 users") {
+		t.Errorf("output = %q", out)
+	}
+
+	held, err := store.ListChirpsByStatus(ctx, service.ChirpHeld)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(held) != 1 || !strings.Contains(held[0].Body, "coffee") {
+		t.Fatalf("held chirps = %v", held)
+	}
+	hits, err := store.GetModerationHitsByChirpID(ctx, uuid.NullUUID{UUID: held[0].ID, Valid: true})
+	if err != nil || len(hits) != 1 {
+		t.Errorf("held chirp's moderation hits = %v, %v", hits, err)
+	}
+}
@@ -14,6 +14,17 @@ import (
 	"golang.org/x/crypto/bcrypt"
 )
 
+const (
+    RoleUser      = "user"
+    RoleModerator = "moderator"
+    RoleAdmin     = "admin"
+)
+
+// ValidRole reports whether role is one of the roles above.
+func ValidRole(role string) bool {
+    return role == RoleUser || role == RoleModerator || role == RoleAdmin
+}
+
 func HashPassword(password string) (string, error) {
     hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
     if err != nil {
@@ -42,8 +53,6 @@ func MakeJWT(userID uuid.UUID, tokenSecret string, expiresIn time.Duration) (str
         return "", fmt.Errorf("failed to sign token: %w", err)
     }
 
-	fmt.Printf("Signed Token: %s\n", signedToken)
-
     return signedToken, nil
 }
 
@@ -0,0 +1,561 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is everything Chirpy reads at startup.
+type Config struct {
+	Port int
+	// GRPCPort serves the gRPC API when set; 0 turns it off.
+	GRPCPort int
+	Platform string
+	DBURL    string
+	JWTKey   string
+	PolkaKey string
+
+	LogLevel        slog.Level
+	LogRedactFields []string
+	TracesExporter  string
+
+	ReportHideThreshold int
+	TrustedProxies      []netip.Prefix
+	RateLimitStore      string
+	CORS                CORS
+
+	// IdempotencyStore keeps Idempotency-Key responses for IdempotencyTTL.
+	IdempotencyStore string
+	IdempotencyTTL   time.Duration
+
+	// MediaDir is served under /app/; readiness fails when its file
+	// system has less than MinFreeDiskMB megabytes free.
+	MediaDir      string
+	MinFreeDiskMB int
+
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+	ShutdownTimeout   time.Duration
+
+	// Migrate applies pending migrations before serving.
+	Migrate bool
+}
+
+// CORS says which browser origins may call the API and how.
+type CORS struct {
+	// AllowedOrigins are exact origins such as "https://chirpy.app",
+	// patterns with one "*" for any subdomains such as
+	// "https://*.chirpy.app", or "*" for every origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders may be sent by scripts; "*" allows any.
+	AllowedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight; 0 leaves it to
+	// them.
+	MaxAge time.Duration
+}
+
+// MinJWTKeyLength rejects keys short enough to brute force.
+const MinJWTKeyLength = 32
+
+// Default returns the configuration used when nothing is set.
+func Default() Config {
+	return Config{
+		Port:                8080,
+		Platform:            "prod",
+		LogLevel:            slog.LevelInfo,
+		TracesExporter:      "none",
+		ReportHideThreshold: 3,
+		RateLimitStore:      "memory",
+		IdempotencyStore:    "memory",
+		IdempotencyTTL:      24 * time.Hour,
+		// Any origin may call the API with a bearer token, but not with
+		// cookies.
+		CORS: CORS{
+			AllowedOrigins: []string{"*"},
+			AllowedMethods: []string{"GET", "HEAD", "POST", "PUT", "DELETE"},
+			AllowedHeaders: []string{
+				"Authorization", "Content-Type", "If-Match", "If-None-Match", "If-Modified-Since",
+				"Idempotency-Key", "X-Request-ID", "traceparent", "tracestate",
+			},
+			MaxAge: 10 * time.Minute,
+		},
+		MediaDir:          ".",
+		MinFreeDiskMB:     100,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+		MaxHeaderBytes:    1 << 20,
+		ShutdownTimeout:   20 * time.Second,
+	}
+}
+
+// field describes one setting under each of its names: key in the config
+// file, env in the environment and .env, flag on the command line.
+type field struct {
+	key    string
+	env    string
+	flag   string
+	usage  string
+	secret bool
+	// boolean fields are plain switches on the command line (--migrate).
+	boolean bool
+	set     func(c *Config, value string) error
+}
+
+var fields = []field{
+	{key: "port", env: "PORT", flag: "port", usage: "port to listen on",
+		set: func(c *Config, v string) error { return setInt(&c.Port, v) }},
+	{key: "grpc_port", env: "GRPC_PORT", flag: "grpc-port", usage: "port for the gRPC API; 0 disables it",
+		set: func(c *Config, v string) error { return setInt(&c.GRPCPort, v) }},
+	{key: "platform", env: "PLATFORM", flag: "platform", usage: "dev or prod; dev enables /admin/reset",
+		set: func(c *Config, v string) error { c.Platform = v; return nil }},
+	{key: "db_url", env: "DB_URL", flag: "db-url", usage: "Postgres connection URL", secret: true,
+		set: func(c *Config, v string) error { c.DBURL = v; return nil }},
+	{key: "jwt_key", env: "JWTKEY", flag: "jwt-key", usage: "secret used to sign access tokens", secret: true,
+		set: func(c *Config, v string) error { c.JWTKey = v; return nil }},
+	{key: "polka_key", env: "POLKA_KEY", flag: "polka-key", usage: "API key Polka uses for webhooks", secret: true,
+		set: func(c *Config, v string) error { c.PolkaKey = v; return nil }},
+	{key: "log_level", env: "LOG_LEVEL", flag: "log-level", usage: "debug, info, warn or error",
+		set: func(c *Config, v string) error { return c.LogLevel.UnmarshalText([]byte(v)) }},
+	{key: "log_redact_fields", env: "LOG_REDACT_FIELDS", flag: "log-redact-fields", usage: "extra comma separated fields to redact from logs",
+		set: func(c *Config, v string) error { c.LogRedactFields = splitList(v); return nil }},
+	{key: "traces_exporter", env: "OTEL_TRACES_EXPORTER", flag: "traces-exporter", usage: "none, stdout or otlp",
+		set: func(c *Config, v string) error { c.TracesExporter = v; return nil }},
+	{key: "report_hide_threshold", env: "REPORT_HIDE_THRESHOLD", flag: "report-hide-threshold", usage: "open reports that hide a chirp",
+		set: func(c *Config, v string) error { return setInt(&c.ReportHideThreshold, v) }},
+	{key: "trusted_proxies", env: "TRUSTED_PROXIES", flag: "trusted-proxies", usage: "comma separated proxy CIDRs whose X-Forwarded-For is trusted",
+		set: func(c *Config, v string) (err error) {
+			c.TrustedProxies, err = parseTrustedProxies(v)
+			return err
+		}},
+	{key: "rate_limit_store", env: "RATE_LIMIT_STORE", flag: "rate-limit-store", usage: "memory or postgres",
+		set: func(c *Config, v string) error { c.RateLimitStore = v; return nil }},
+	{key: "idempotency_store", env: "IDEMPOTENCY_STORE", flag: "idempotency-store", usage: "memory or postgres",
+		set: func(c *Config, v string) error { c.IdempotencyStore = v; return nil }},
+	{key: "idempotency_ttl", env: "IDEMPOTENCY_TTL", flag: "idempotency-ttl", usage: "how long responses are kept for retries with the same Idempotency-Key",
+		set: func(c *Config, v string) error { return setDuration(&c.IdempotencyTTL, v) }},
+	{key: "cors_allowed_origins", env: "CORS_ALLOWED_ORIGINS", flag: "cors-allowed-origins", usage: "comma separated browser origins allowed to call the API, such as https://*.chirpy.app; * allows any",
+		set: func(c *Config, v string) (err error) {
+			c.CORS.AllowedOrigins, err = parseCORSOrigins(v)
+			return err
+		}},
+	{key: "cors_allowed_methods", env: "CORS_ALLOWED_METHODS", flag: "cors-allowed-methods", usage: "comma separated methods cross-origin requests may use",
+		set: func(c *Config, v string) error { c.CORS.AllowedMethods = splitList(strings.ToUpper(v)); return nil }},
+	{key: "cors_allowed_headers", env: "CORS_ALLOWED_HEADERS", flag: "cors-allowed-headers", usage: "comma separated request headers cross-origin requests may send; * allows any",
+		set: func(c *Config, v string) error { c.CORS.AllowedHeaders = splitList(v); return nil }},
+	{key: "cors_allow_credentials", env: "CORS_ALLOW_CREDENTIALS", flag: "cors-allow-credentials", usage: "let cross-origin requests send cookies", boolean: true,
+		set: func(c *Config, v string) error { return setBool(&c.CORS.AllowCredentials, v) }},
+	{key: "cors_max_age", env: "CORS_MAX_AGE", flag: "cors-max-age", usage: "how long browsers may cache a CORS preflight",
+		set: func(c *Config, v string) error { return setDuration(&c.CORS.MaxAge, v) }},
+	{key: "media_dir", env: "MEDIA_DIR", flag: "media-dir", usage: "directory of files served under /app/",
+		set: func(c *Config, v string) error { c.MediaDir = v; return nil }},
+	{key: "min_free_disk_mb", env: "MIN_FREE_DISK_MB", flag: "min-free-disk-mb", usage: "free space in MEDIA_DIR below which /api/readyz fails",
+		set: func(c *Config, v string) error { return setInt(&c.MinFreeDiskMB, v) }},
+	{key: "server_read_header_timeout", env: "SERVER_READ_HEADER_TIMEOUT", flag: "read-header-timeout", usage: "time allowed to read request headers",
+		set: func(c *Config, v string) error { return setDuration(&c.ReadHeaderTimeout, v) }},
+	{key: "server_read_timeout", env: "SERVER_READ_TIMEOUT", flag: "read-timeout", usage: "time allowed to read a whole request",
+		set: func(c *Config, v string) error { return setDuration(&c.ReadTimeout, v) }},
+	{key: "server_write_timeout", env: "SERVER_WRITE_TIMEOUT", flag: "write-timeout", usage: "time allowed to write a response",
+		set: func(c *Config, v string) error { return setDuration(&c.WriteTimeout, v) }},
+	{key: "server_idle_timeout", env: "SERVER_IDLE_TIMEOUT", flag: "idle-timeout", usage: "keep-alive idle time",
+		set: func(c *Config, v string) error { return setDuration(&c.IdleTimeout, v) }},
+	{key: "server_max_header_bytes", env: "SERVER_MAX_HEADER_BYTES", flag: "max-header-bytes", usage: "largest request header accepted",
+		set: func(c *Config, v string) error { return setInt(&c.MaxHeaderBytes, v) }},
+	{key: "shutdown_timeout", env: "SHUTDOWN_TIMEOUT", flag: "shutdown-timeout", usage: "how long to drain requests on shutdown",
+		set: func(c *Config, v string) error { return setDuration(&c.ShutdownTimeout, v) }},
+	{key: "migrate", env: "MIGRATE", flag: "migrate", usage: "apply pending database migrations before serving", boolean: true,
+		set: func(c *Config, v string) error { return setBool(&c.Migrate, v) }},
+}
+
+func setInt(dst *int, value string) error {
+	parsed, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return errors.New("not an integer")
+	}
+	*dst = parsed
+	return nil
+}
+
+func setBool(dst *bool, value string) error {
+	parsed, err := strconv.ParseBool(strings.TrimSpace(value))
+	if err != nil {
+		return errors.New("not true or false")
+	}
+	*dst = parsed
+	return nil
+}
+
+func setDuration(dst *time.Duration, value string) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return errors.New(`not a duration such as "15s"`)
+	}
+	*dst = parsed
+	return nil
+}
+
+// parseTrustedProxies turns a comma separated list of CIDRs or addresses into prefixes.
+func parseTrustedProxies(value string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if !strings.Contains(part, "/") {
+			addr, err := netip.ParseAddr(part)
+			if err != nil {
+				return nil, err
+			}
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(part)
+		if err != nil {
+			return nil, err
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// parseCORSOrigins parses a comma separated list of CORS.AllowedOrigins.
+func parseCORSOrigins(value string) ([]string, error) {
+	var origins []string
+	for _, origin := range strings.Split(value, ",") {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		if origin == "" {
+			continue
+		}
+		if origin != "*" {
+			if err := checkOrigin(origin); err != nil {
+				return nil, fmt.Errorf("%q: %w", origin, err)
+			}
+		}
+		origins = append(origins, origin)
+	}
+	return origins, nil
+}
+
+func checkOrigin(origin string) error {
+	if strings.Count(origin, "*") > 1 {
+		return errors.New("only one * is allowed")
+	}
+	u, err := url.Parse(strings.Replace(origin, "*", "wildcard", 1))
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return errors.New("not an origin such as https://chirpy.app")
+	}
+	if u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return errors.New("an origin is only a scheme, host and port")
+	}
+	if strings.Contains(origin, "*") && !strings.Contains(u.Hostname(), "wildcard") {
+		return errors.New("* may only stand for part of the host")
+	}
+	return nil
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// describe names a value in an error without leaking it.
+func (f field) describe(value string) string {
+	if f.secret {
+		return "(value redacted)"
+	}
+	return strconv.Quote(value)
+}
+
+// Options says where Load looks. The zero value reads .env and the real
+// environment; tests point it elsewhere.
+type Options struct {
+	// DotEnv is the .env file to read. Defaults to ".env"; a missing file is fine.
+	DotEnv string
+	// LookupEnv defaults to os.LookupEnv.
+	LookupEnv func(string) (string, bool)
+	// Output receives flag usage. Defaults to os.Stderr.
+	Output io.Writer
+	// DatabaseOnly limits validation to what admin commands need, so they
+	// run without the server's secrets.
+	DatabaseOnly bool
+}
+
+// Load builds the configuration from, in increasing priority: defaults, the
+// YAML or TOML file named by --config or CHIRPY_CONFIG, .env, the
+// environment and args. The result is validated; every problem found is
+// reported at once.
+func Load(args []string, opts Options) (Config, error) {
+	if opts.DotEnv == "" {
+		opts.DotEnv = ".env"
+	}
+	if opts.LookupEnv == nil {
+		opts.LookupEnv = os.LookupEnv
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+
+	cfg := Default()
+	var problems []error
+	apply := func(f field, source, value string) {
+		if err := f.set(&cfg, value); err != nil {
+			problems = append(problems, fmt.Errorf("%s (from %s): %s is invalid: %v", f.env, source, f.describe(value), err))
+		}
+	}
+
+	fs := flag.NewFlagSet("chirpy", flag.ContinueOnError)
+	fs.SetOutput(opts.Output)
+	configPath := fs.String("config", "", "YAML or TOML config file (or CHIRPY_CONFIG)")
+	flagValues := map[string]string{}
+	for _, f := range fields {
+		store := func(value string) error {
+			flagValues[f.flag] = value
+			return nil
+		}
+		if f.boolean {
+			fs.BoolFunc(f.flag, f.usage+" ("+f.env+")", store)
+		} else {
+			fs.Func(f.flag, f.usage+" ("+f.env+")", store)
+		}
+	}
+	if err := fs.Parse(args); err != nil {
+		return Config{}, err
+	}
+	if fs.NArg() > 0 {
+		return Config{}, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	dotenv, err := godotenv.Read(opts.DotEnv)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return Config{}, fmt.Errorf("reading %s: %w", opts.DotEnv, err)
+	}
+
+	path := *configPath
+	if path == "" {
+		if value, ok := opts.LookupEnv("CHIRPY_CONFIG"); ok {
+			path = value
+		} else {
+			path = dotenv["CHIRPY_CONFIG"]
+		}
+	}
+	if path != "" {
+		values, err := readFile(path)
+		if err != nil {
+			return Config{}, err
+		}
+		known := map[string]bool{}
+		for _, f := range fields {
+			known[f.key] = true
+			if value, ok := values[f.key]; ok {
+				apply(f, path, value)
+			}
+		}
+		for key := range values {
+			if !known[key] {
+				problems = append(problems, fmt.Errorf("%s: unknown setting %q", path, key))
+			}
+		}
+	}
+
+	for _, f := range fields {
+		if value, ok := dotenv[f.env]; ok {
+			apply(f, opts.DotEnv, value)
+		}
+	}
+	for _, f := range fields {
+		if value, ok := opts.LookupEnv(f.env); ok {
+			apply(f, "environment", value)
+		}
+	}
+	for _, f := range fields {
+		if value, ok := flagValues[f.flag]; ok {
+			apply(f, "--"+f.flag, value)
+		}
+	}
+
+	if opts.DatabaseOnly {
+		problems = append(problems, cfg.validateDatabase()...)
+	} else {
+		problems = append(problems, cfg.Validate()...)
+	}
+	if len(problems) > 0 {
+		return Config{}, &Error{Problems: problems}
+	}
+	return cfg, nil
+}
+
+// readFile flattens a YAML or TOML file into setting names and their values
+// as strings, so they go through the same parsing as everything else.
+func readFile(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading config file: %w", err)
+	}
+
+	raw := map[string]any{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &raw)
+	case ".toml":
+		err = toml.Unmarshal(data, &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+
+	values := map[string]string{}
+	for key, value := range raw {
+		switch v := value.(type) {
+		case []any:
+			items := make([]string, len(v))
+			for i, item := range v {
+				items[i] = fmt.Sprint(item)
+			}
+			values[key] = strings.Join(items, ",")
+		default:
+			values[key] = fmt.Sprint(v)
+		}
+	}
+	return values, nil
+}
+
+func (c Config) validateDatabase() []error {
+	var problems []error
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.Platform != "dev" && c.Platform != "prod" {
+		fail("PLATFORM: %q must be dev or prod", c.Platform)
+	}
+	if c.DBURL == "" {
+		fail("DB_URL: required")
+	} else if u, err := url.Parse(c.DBURL); err != nil {
+		fail("DB_URL: (value redacted) is not a URL")
+	} else if u.Scheme != "postgres" && u.Scheme != "postgresql" {
+		fail("DB_URL: %s must use the postgres:// scheme", u.Redacted())
+	}
+	return problems
+}
+
+// Validate checks values that parsed but still can't work.
+func (c Config) Validate() []error {
+	problems := c.validateDatabase()
+	fail := func(format string, args ...any) {
+		problems = append(problems, fmt.Errorf(format, args...))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		fail("PORT: %d is not between 1 and 65535", c.Port)
+	}
+	if c.GRPCPort < 0 || c.GRPCPort > 65535 {
+		fail("GRPC_PORT: %d is not between 0 and 65535", c.GRPCPort)
+	} else if c.GRPCPort == c.Port {
+		fail("GRPC_PORT: %d is already the HTTP port", c.GRPCPort)
+	}
+
+	if c.JWTKey == "" {
+		fail("JWTKEY: required")
+	} else if len(c.JWTKey) < MinJWTKeyLength {
+		fail("JWTKEY: (value redacted) is %d characters, need at least %d", len(c.JWTKey), MinJWTKeyLength)
+	}
+	if c.PolkaKey == "" {
+		fail("POLKA_KEY: required")
+	}
+
+	switch c.TracesExporter {
+	case "none", "stdout", "otlp":
+	default:
+		fail("OTEL_TRACES_EXPORTER: %q must be none, stdout or otlp", c.TracesExporter)
+	}
+	if c.RateLimitStore != "memory" && c.RateLimitStore != "postgres" {
+		fail("RATE_LIMIT_STORE: %q must be memory or postgres", c.RateLimitStore)
+	}
+	if c.IdempotencyStore != "memory" && c.IdempotencyStore != "postgres" {
+		fail("IDEMPOTENCY_STORE: %q must be memory or postgres", c.IdempotencyStore)
+	}
+	if c.IdempotencyTTL <= 0 {
+		fail("IDEMPOTENCY_TTL: %s must be positive", c.IdempotencyTTL)
+	}
+	if c.ReportHideThreshold < 1 {
+		fail("REPORT_HIDE_THRESHOLD: %d must be at least 1", c.ReportHideThreshold)
+	}
+	if c.CORS.AllowCredentials && slices.Contains(c.CORS.AllowedOrigins, "*") {
+		fail("CORS_ALLOW_CREDENTIALS: can't be combined with CORS_ALLOWED_ORIGINS allowing every origin (*)")
+	}
+	if c.CORS.MaxAge < 0 {
+		fail("CORS_MAX_AGE: %s must not be negative", c.CORS.MaxAge)
+	}
+	if c.MediaDir == "" {
+		fail("MEDIA_DIR: required")
+	}
+	if c.MinFreeDiskMB < 0 {
+		fail("MIN_FREE_DISK_MB: %d must not be negative", c.MinFreeDiskMB)
+	}
+
+	for _, timeout := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"SERVER_READ_HEADER_TIMEOUT", c.ReadHeaderTimeout},
+		{"SERVER_READ_TIMEOUT", c.ReadTimeout},
+		{"SERVER_WRITE_TIMEOUT", c.WriteTimeout},
+		{"SERVER_IDLE_TIMEOUT", c.IdleTimeout},
+		{"SHUTDOWN_TIMEOUT", c.ShutdownTimeout},
+	} {
+		if timeout.value <= 0 {
+			fail("%s: %s must be positive", timeout.name, timeout.value)
+		}
+	}
+	if c.MaxHeaderBytes < 1 {
+		fail("SERVER_MAX_HEADER_BYTES: %d must be positive", c.MaxHeaderBytes)
+	}
+
+	return problems
+}
+
+// Error lists every configuration problem found.
+type Error struct {
+	Problems []error
+}
+
+func (e *Error) Error() string {
+	lines := make([]string, len(e.Problems))
+	for i, problem := range e.Problems {
+		lines[i] = "  " + problem.Error()
+	}
+	return "invalid configuration:\n" + strings.Join(lines, "\n")
+}
+
+func (e *Error) Unwrap() []error {
+	return e.Problems
+}
@@ -13,9 +13,9 @@ import (
 )
 
 const createChirp = `-- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES ($1, $2, $3, $4, $5)
-RETURNING id, created_at, updated_at, body, user_id
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, status)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, created_at, updated_at, body, user_id, status
 `
 
 type CreateChirpParams struct {
@@ -24,6 +24,7 @@ type CreateChirpParams struct {
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	Status    string
 }
 
 func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error) {
@@ -33,6 +34,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		arg.UpdatedAt,
 		arg.Body,
 		arg.UserID,
+		arg.Status,
 	)
 	var i Chirp
 	err := row.Scan(
@@ -41,6 +43,7 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Status,
 	)
 	return i, err
 }
@@ -55,14 +58,49 @@ func (q *Queries) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
 	return err
 }
 
+const deleteChirpIfUnchanged = `-- name: DeleteChirpIfUnchanged :execrows
+DELETE FROM chirps
+WHERE id = $1
+    AND updated_at = $2
+`
+
+type DeleteChirpIfUnchangedParams struct {
+	ID        uuid.UUID
+	UpdatedAt time.Time
+}
+
+func (q *Queries) DeleteChirpIfUnchanged(ctx context.Context, arg DeleteChirpIfUnchangedParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirpIfUnchanged, arg.ID, arg.UpdatedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const deleteChirpsByAuthorID = `-- name: DeleteChirpsByAuthorID :execrows
+DELETE FROM chirps
+WHERE user_id = $1
+`
+
+func (q *Queries) DeleteChirpsByAuthorID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteChirpsByAuthorID, userID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getAllChirps = `-- name: GetAllChirps :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.status
 FROM chirps
-ORDER BY created_at ASC
+INNER JOIN users ON users.id = chirps.user_id
+WHERE chirps.status = 'published'
+    AND (users.shadow_banned = FALSE OR chirps.user_id = $1)
+ORDER BY chirps.created_at ASC
 `
 
-func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getAllChirps)
+func (q *Queries) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getAllChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -76,6 +114,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -91,7 +130,7 @@ func (q *Queries) GetAllChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const getChirpByID = `-- name: GetChirpByID :one
-SELECT id, created_at, updated_at, body, user_id
+SELECT id, created_at, updated_at, body, user_id, status
 FROM chirps
 WHERE id = $1
 `
@@ -105,19 +144,101 @@ func (q *Queries) GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
 		&i.UpdatedAt,
 		&i.Body,
 		&i.UserID,
+		&i.Status,
 	)
 	return i, err
 }
 
 const getChirpsByAuthorID = `-- name: GetChirpsByAuthorID :many
-SELECT id, created_at, updated_at, body, user_id
+SELECT chirps.id, chirps.created_at, chirps.updated_at, chirps.body, chirps.user_id, chirps.status
 FROM chirps
-WHERE user_id = $1
+INNER JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = $1
+    AND chirps.status = 'published'
+    AND (users.shadow_banned = FALSE OR chirps.user_id = $2)
+ORDER BY chirps.created_at ASC
+`
+
+type GetChirpsByAuthorIDParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) GetChirpsByAuthorID(ctx context.Context, arg GetChirpsByAuthorIDParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorID, arg.UserID, arg.ViewerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAllChirps = `-- name: ListAllChirps :many
+SELECT id, created_at, updated_at, body, user_id, status
+FROM chirps
+ORDER BY created_at ASC
+`
+
+func (q *Queries) ListAllChirps(ctx context.Context) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listAllChirps)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Body,
+			&i.UserID,
+			&i.Status,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listChirpsByStatus = `-- name: ListChirpsByStatus :many
+SELECT id, created_at, updated_at, body, user_id, status
+FROM chirps
+WHERE status = $1
 ORDER BY created_at ASC
 `
 
-func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, getChirpsByAuthorID, userID)
+func (q *Queries) ListChirpsByStatus(ctx context.Context, status string) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByStatus, status)
 	if err != nil {
 		return nil, err
 	}
@@ -131,6 +252,7 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 			&i.UpdatedAt,
 			&i.Body,
 			&i.UserID,
+			&i.Status,
 		); err != nil {
 			return nil, err
 		}
@@ -144,3 +266,46 @@ func (q *Queries) GetChirpsByAuthorID(ctx context.Context, userID uuid.UUID) ([]
 	}
 	return items, nil
 }
+
+const transitionChirpStatus = `-- name: TransitionChirpStatus :execrows
+UPDATE chirps
+SET
+    status = $1,
+    updated_at = NOW()
+WHERE
+    id = $2
+    AND status = $3
+`
+
+type TransitionChirpStatusParams struct {
+	NewStatus string
+	ID        uuid.UUID
+	OldStatus string
+}
+
+func (q *Queries) TransitionChirpStatus(ctx context.Context, arg TransitionChirpStatusParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, transitionChirpStatus, arg.NewStatus, arg.ID, arg.OldStatus)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const updateChirpStatus = `-- name: UpdateChirpStatus :exec
+UPDATE chirps
+SET
+    status = $2,
+    updated_at = NOW()
+WHERE
+    id = $1
+`
+
+type UpdateChirpStatusParams struct {
+	ID     uuid.UUID
+	Status string
+}
+
+func (q *Queries) UpdateChirpStatus(ctx context.Context, arg UpdateChirpStatusParams) error {
+	_, err := q.db.ExecContext(ctx, updateChirpStatus, arg.ID, arg.Status)
+	return err
+}
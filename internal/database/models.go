@@ -6,6 +6,7 @@ package database
 
 import (
 	"database/sql"
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
@@ -17,6 +18,56 @@ type Chirp struct {
 	UpdatedAt time.Time
 	Body      string
 	UserID    uuid.UUID
+	Status    string
+}
+
+type IdempotencyKey struct {
+	Key         string
+	RequestHash string
+	Status      int32
+	Headers     json.RawMessage
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	Claim       uuid.UUID
+}
+
+type ModerationAuditLog struct {
+	ID           uuid.UUID
+	CreatedAt    time.Time
+	ModeratorID  uuid.UUID
+	Action       string
+	ReportID     uuid.NullUUID
+	ChirpID      uuid.NullUUID
+	TargetUserID uuid.NullUUID
+	Note         string
+}
+
+type ModerationHit struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	RuleID    uuid.UUID
+	ChirpID   uuid.NullUUID
+	UserID    uuid.UUID
+	Matched   string
+	Action    string
+}
+
+type ModerationRule struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	Kind      string
+	Pattern   string
+	Action    string
+	Enabled   bool
+}
+
+type RateLimitBucket struct {
+	Key       string
+	Tokens    float64
+	Allowed   bool
+	UpdatedAt time.Time
 }
 
 type RefreshToken struct {
@@ -28,6 +79,22 @@ type RefreshToken struct {
 	RevokedAt sql.NullTime
 }
 
+type Report struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	ClaimedBy  uuid.NullUUID
+	ClaimedAt  sql.NullTime
+	ResolvedBy uuid.NullUUID
+	ResolvedAt sql.NullTime
+	Resolution sql.NullString
+}
+
 type User struct {
 	ID             uuid.UUID
 	CreatedAt      time.Time
@@ -35,4 +102,16 @@ type User struct {
 	Email          string
 	HashedPassword string
 	IsChirpyRed    bool
+	Role           string
+	SuspendedUntil sql.NullTime
+	ShadowBanned   bool
+}
+
+type UserWarning struct {
+	ID        uuid.UUID
+	CreatedAt time.Time
+	UserID    uuid.UUID
+	ChirpID   uuid.NullUUID
+	Reason    string
+	Note      string
 }
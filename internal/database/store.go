@@ -0,0 +1,57 @@
+package database
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+)
+
+// Store is the set of queries the HTTP handlers run. *Queries is the
+// Postgres implementation; tests use an in-memory one.
+type Store interface {
+	ClaimReport(ctx context.Context, arg ClaimReportParams) (Report, error)
+	CountUnresolvedReportsForChirp(ctx context.Context, chirpID uuid.UUID) (int64, error)
+	CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp, error)
+	CreateModerationAuditEntry(ctx context.Context, arg CreateModerationAuditEntryParams) error
+	CreateModerationHit(ctx context.Context, arg CreateModerationHitParams) error
+	CreateModerationRule(ctx context.Context, arg CreateModerationRuleParams) (ModerationRule, error)
+	CreateRefreshToken(ctx context.Context, arg CreateRefreshTokenParams) error
+	CreateReport(ctx context.Context, arg CreateReportParams) (Report, error)
+	CreateUser(ctx context.Context, arg CreateUserParams) (User, error)
+	CreateUserWarning(ctx context.Context, arg CreateUserWarningParams) (UserWarning, error)
+	DeleteAllUsers(ctx context.Context) error
+	DeleteChirpByID(ctx context.Context, id uuid.UUID) error
+	DeleteChirpIfUnchanged(ctx context.Context, arg DeleteChirpIfUnchangedParams) (int64, error)
+	DeleteModerationRule(ctx context.Context, id uuid.UUID) error
+	GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error)
+	GetChirpByID(ctx context.Context, id uuid.UUID) (Chirp, error)
+	GetChirpsByAuthorID(ctx context.Context, arg GetChirpsByAuthorIDParams) ([]Chirp, error)
+	GetModerationHitsByChirpID(ctx context.Context, chirpID uuid.NullUUID) ([]ModerationHit, error)
+	GetModerationRuleByID(ctx context.Context, id uuid.UUID) (ModerationRule, error)
+	GetReportByID(ctx context.Context, id uuid.UUID) (Report, error)
+	GetUserByEmail(ctx context.Context, email string) (User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (User, error)
+	GetUserFromRefreshToken(ctx context.Context, token string) (GetUserFromRefreshTokenRow, error)
+	GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]User, error)
+	// InTx runs fn with a Store whose queries share one transaction,
+	// committed if fn returns nil and rolled back if it returns an error.
+	InTx(ctx context.Context, fn func(q Store) error) error
+	ListChirpsByStatus(ctx context.Context, status string) ([]Chirp, error)
+	ListEnabledModerationRules(ctx context.Context) ([]ModerationRule, error)
+	ListModerationAuditEntries(ctx context.Context, limit int32) ([]ModerationAuditLog, error)
+	ListModerationRules(ctx context.Context) ([]ModerationRule, error)
+	ListReportsByStatus(ctx context.Context, status string) ([]ListReportsByStatusRow, error)
+	ListUserWarnings(ctx context.Context, userID uuid.UUID) ([]UserWarning, error)
+	ResolveReport(ctx context.Context, arg ResolveReportParams) (int64, error)
+	ResolveReportsForChirp(ctx context.Context, arg ResolveReportsForChirpParams) error
+	RevokeRefreshToken(ctx context.Context, token string) error
+	SetUserShadowBanned(ctx context.Context, arg SetUserShadowBannedParams) error
+	SuspendUser(ctx context.Context, arg SuspendUserParams) error
+	TransitionChirpStatus(ctx context.Context, arg TransitionChirpStatusParams) (int64, error)
+	UpdateChirpStatus(ctx context.Context, arg UpdateChirpStatusParams) error
+	UpdateModerationRule(ctx context.Context, arg UpdateModerationRuleParams) (ModerationRule, error)
+	UpdateUserEmailAndPassword(ctx context.Context, arg UpdateUserEmailAndPasswordParams) error
+	UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) error
+}
+
+var _ Store = (*Queries)(nil)
@@ -0,0 +1,25 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+)
+
+// InTx runs fn in a transaction on q's *sql.DB, returning fn's error as it
+// is. Queries that are already bound to a transaction run fn in it.
+func (q *Queries) InTx(ctx context.Context, fn func(q Store) error) error {
+	db, ok := q.db.(*sql.DB)
+	if !ok {
+		return fn(q)
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(q.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,103 @@
+// Package dataloader batches lookups by key. A resolver asks for a key and
+// gets back a thunk; the first thunk that is called fetches every key asked
+// for so far in one query. Results are cached, so a Loader belongs to one
+// request and must not outlive it.
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrNotFound is returned for keys the batch function didn't return.
+var ErrNotFound = errors.New("dataloader: not found")
+
+// BatchFunc fetches keys in one go. It may leave out keys that don't exist.
+type BatchFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
+
+type Loader[K comparable, V any] struct {
+	batch BatchFunc[K, V]
+
+	mu      sync.Mutex
+	pending []K
+	entries map[K]*entry[V]
+	batches int
+}
+
+type entry[V any] struct {
+	loaded bool
+	value  V
+	err    error
+}
+
+func New[K comparable, V any](batch BatchFunc[K, V]) *Loader[K, V] {
+	return &Loader[K, V]{batch: batch, entries: map[K]*entry[V]{}}
+}
+
+// Load queues key for the next batch and returns a thunk for its value.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) func() (V, error) {
+	l.mu.Lock()
+	if _, ok := l.entries[key]; !ok {
+		l.entries[key] = &entry[V]{}
+		l.pending = append(l.pending, key)
+	}
+	l.mu.Unlock()
+
+	return func() (V, error) {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		e := l.entries[key]
+		if !e.loaded {
+			l.dispatch(ctx)
+		}
+		return e.value, e.err
+	}
+}
+
+// Prime caches a value the caller already has, such as a chirp's author
+// loaded alongside it.
+func (l *Loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if e, ok := l.entries[key]; !ok || !e.loaded {
+		l.entries[key] = &entry[V]{loaded: true, value: value}
+	}
+}
+
+// Batches is how many times the batch function has run.
+func (l *Loader[K, V]) Batches() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.batches
+}
+
+// dispatch fetches every pending key. l.mu is held.
+func (l *Loader[K, V]) dispatch(ctx context.Context) {
+	var keys []K
+	for _, key := range l.pending {
+		if !l.entries[key].loaded {
+			keys = append(keys, key)
+		}
+	}
+	l.pending = nil
+	if len(keys) == 0 {
+		return
+	}
+
+	l.batches++
+	values, err := l.batch(ctx, keys)
+	for _, key := range keys {
+		e := l.entries[key]
+		e.loaded = true
+		value, ok := values[key]
+		switch {
+		case err != nil:
+			e.err = err
+		case !ok:
+			e.err = ErrNotFound
+		default:
+			e.value = value
+		}
+	}
+}
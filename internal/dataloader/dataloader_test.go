@@ -0,0 +1,69 @@
+package dataloader
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestLoader(t *testing.T) {
+	ctx := context.Background()
+	var batches [][]int
+	l := New(func(ctx context.Context, keys []int) (map[int]string, error) {
+		batches = append(batches, slices.Clone(keys))
+		values := map[int]string{}
+		for _, key := range keys {
+			if key > 0 {
+				values[key] = "v" + string(rune('0'+key))
+			}
+		}
+		return values, nil
+	})
+
+	// Keys asked for before any thunk runs share one batch, duplicates
+	// included once.
+	one, two, oneAgain, missing := l.Load(ctx, 1), l.Load(ctx, 2), l.Load(ctx, 1), l.Load(ctx, -1)
+	if v, err := two(); v != "v2" || err != nil {
+		t.Errorf("two = %q, %v", v, err)
+	}
+	if v, err := one(); v != "v1" || err != nil {
+		t.Errorf("one = %q, %v", v, err)
+	}
+	if v, _ := oneAgain(); v != "v1" {
+		t.Errorf("one again = %q", v)
+	}
+	if _, err := missing(); !errors.Is(err, ErrNotFound) {
+		t.Errorf("missing = %v, want ErrNotFound", err)
+	}
+	if len(batches) != 1 || !slices.Equal(batches[0], []int{1, 2, -1}) {
+		t.Fatalf("batches = %v, want [[1 2 -1]]", batches)
+	}
+
+	// Cached and primed keys don't hit the batch function again.
+	l.Prime(5, "primed")
+	if v, _ := l.Load(ctx, 5)(); v != "primed" {
+		t.Errorf("primed = %q", v)
+	}
+	if v, _ := l.Load(ctx, 2)(); v != "v2" || l.Batches() != 1 {
+		t.Errorf("cached = %q after %d batches", v, l.Batches())
+	}
+
+	if v, _ := l.Load(ctx, 3)(); v != "v3" || l.Batches() != 2 {
+		t.Errorf("new key = %q after %d batches", v, l.Batches())
+	}
+}
+
+func TestLoaderError(t *testing.T) {
+	boom := errors.New("boom")
+	l := New(func(ctx context.Context, keys []string) (map[string]int, error) {
+		return nil, boom
+	})
+	a, b := l.Load(context.Background(), "a"), l.Load(context.Background(), "b")
+	if _, err := a(); !errors.Is(err, boom) {
+		t.Errorf("a = %v", err)
+	}
+	if _, err := b(); !errors.Is(err, boom) || l.Batches() != 1 {
+		t.Errorf("b = %v after %d batches", err, l.Batches())
+	}
+}
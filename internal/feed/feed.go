@@ -0,0 +1,82 @@
+// Package feed fans newly published chirps out to the streams watching for
+// them. A Feed lives in memory, so watchers only see chirps posted through
+// the same process.
+package feed
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/k3vwdd/chirpyWS/internal/database"
+)
+
+// ErrTooSlow ends a subscription whose reader fell a whole buffer behind.
+// Publishing never waits for a watcher.
+var ErrTooSlow = errors.New("feed: subscriber fell behind")
+
+// Entry is a chirp as it was published, with its author.
+type Entry struct {
+	Chirp  database.Chirp
+	Author database.User
+}
+
+type Feed struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+func New() *Feed {
+	return &Feed{subs: map[*Subscription]struct{}{}}
+}
+
+type Subscription struct {
+	feed *Feed
+	c    chan Entry
+	// err is set before c is closed.
+	err error
+}
+
+// Subscribe starts receiving entries, holding up to buffer of them for a
+// slow reader. Close the subscription when done.
+func (f *Feed) Subscribe(buffer int) *Subscription {
+	s := &Subscription{feed: f, c: make(chan Entry, buffer)}
+	f.mu.Lock()
+	f.subs[s] = struct{}{}
+	f.mu.Unlock()
+	return s
+}
+
+func (f *Feed) Publish(e Entry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for s := range f.subs {
+		select {
+		case s.c <- e:
+		default:
+			s.err = ErrTooSlow
+			delete(f.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// C delivers entries in the order they were published. It is closed when
+// the subscription ends; Err then says why.
+func (s *Subscription) C() <-chan Entry {
+	return s.c
+}
+
+// Err is ErrTooSlow if the feed dropped the subscription, nil otherwise.
+// It is only meaningful once C is closed.
+func (s *Subscription) Err() error {
+	return s.err
+}
+
+func (s *Subscription) Close() {
+	s.feed.mu.Lock()
+	defer s.feed.mu.Unlock()
+	if _, ok := s.feed.subs[s]; ok {
+		delete(s.feed.subs, s)
+		close(s.c)
+	}
+}
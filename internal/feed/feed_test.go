@@ -0,0 +1,56 @@
+package feed
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/k3vwdd/chirpyWS/internal/database"
+)
+
+func entry(body string) Entry {
+	return Entry{Chirp: database.Chirp{Body: body}}
+}
+
+func TestFeed(t *testing.T) {
+	f := New()
+	a, b := f.Subscribe(2), f.Subscribe(2)
+
+	f.Publish(entry("one"))
+	f.Publish(entry("two"))
+	for _, s := range []*Subscription{a, b} {
+		for _, want := range []string{"one", "two"} {
+			if got := <-s.C(); got.Chirp.Body != want {
+				t.Errorf("got %q, want %q", got.Chirp.Body, want)
+			}
+		}
+	}
+
+	b.Close()
+	b.Close()
+	f.Publish(entry("three"))
+	if got := <-a.C(); got.Chirp.Body != "three" {
+		t.Errorf("got %q after b left", got.Chirp.Body)
+	}
+	if _, ok := <-b.C(); ok || b.Err() != nil {
+		t.Errorf("closed subscription: open = %v, err = %v", ok, b.Err())
+	}
+}
+
+func TestFeedDropsSlowSubscribers(t *testing.T) {
+	f := New()
+	slow := f.Subscribe(1)
+
+	f.Publish(entry("one"))
+	f.Publish(entry("two"))
+
+	if got := <-slow.C(); got.Chirp.Body != "one" {
+		t.Errorf("got %q, want the buffered entry", got.Chirp.Body)
+	}
+	if _, ok := <-slow.C(); ok {
+		t.Fatal("subscription still open after overflowing")
+	}
+	if !errors.Is(slow.Err(), ErrTooSlow) {
+		t.Errorf("Err = %v, want ErrTooSlow", slow.Err())
+	}
+	slow.Close()
+}
@@ -0,0 +1,268 @@
+// Package grpcapi serves the chirpy.v1 gRPC services. Like the REST
+// handlers it is a thin transport over package service: it converts
+// messages, reads the access token from "authorization: Bearer <jwt>"
+// metadata and turns *utils.Error values into gRPC statuses.
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	"github.com/k3vwdd/chirpyWS/internal/types"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+	chirpyv1 "github.com/k3vwdd/chirpyWS/proto/chirpy/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail every error carries;
+// its reason is the same code a REST problem has.
+const ErrorDomain = "chirpy"
+
+// NewServer returns a gRPC server with the Users, Auth and Chirps services
+// registered. Calls are logged to logger like HTTP requests are.
+func NewServer(cfg *types.ApiConfig, logger *slog.Logger, opts ...grpc.ServerOption) *grpc.Server {
+	svc := service.New(cfg)
+	opts = append(opts,
+		grpc.ChainUnaryInterceptor(unaryInterceptor(logger), rateLimitInterceptor(svc)),
+		grpc.ChainStreamInterceptor(streamInterceptor(logger)),
+	)
+	server := grpc.NewServer(opts...)
+
+	chirpyv1.RegisterUsersServiceServer(server, &usersServer{svc: svc})
+	chirpyv1.RegisterAuthServiceServer(server, &authServer{svc: svc})
+	chirpyv1.RegisterChirpsServiceServer(server, &chirpsServer{svc: svc})
+	return server
+}
+
+func unaryInterceptor(logger *slog.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, done := startCall(ctx, logger, info.FullMethod)
+		resp, err := handler(ctx, req)
+		err = toStatus(ctx, err)
+		done(err)
+		return resp, err
+	}
+}
+
+func streamInterceptor(logger *slog.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, done := startCall(stream.Context(), logger, info.FullMethod)
+		err := handler(srv, &serverStream{ServerStream: stream, ctx: ctx})
+		err = toStatus(ctx, err)
+		done(err)
+		return err
+	}
+}
+
+// rateLimitedMethods maps the RPCs that create accounts, sessions and
+// chirps to the REST routes whose rate limits they share.
+var rateLimitedMethods = map[string]string{
+	chirpyv1.UsersService_CreateUser_FullMethodName:   "POST /api/users",
+	chirpyv1.AuthService_Login_FullMethodName:         "POST /api/login",
+	chirpyv1.ChirpsService_CreateChirp_FullMethodName: "POST /api/chirps",
+}
+
+// rateLimitInterceptor counts calls against the RateLimiter as the REST
+// middleware does: per user for a valid access token, else per peer
+// address. It runs inside unaryInterceptor, so a refusal is logged and
+// becomes ResourceExhausted with a rate_limited ErrorInfo.
+func rateLimitInterceptor(svc *service.Service) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		pattern, ok := rateLimitedMethods[info.FullMethod]
+		if !ok || svc.RateLimiter == nil {
+			return handler(ctx, req)
+		}
+		if err := svc.RateLimiter.Limit(ctx, pattern, peerIP(ctx), svc.ViewerID(bearerToken(ctx))); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// peerIP is the address the call came from, without its port.
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// startCall tags the call with a request id, taken from x-request-id
+// metadata when the client sent one, and returns a func that logs it.
+func startCall(ctx context.Context, logger *slog.Logger, method string) (context.Context, func(error)) {
+	start := time.Now()
+	requestID := firstMetadata(ctx, "x-request-id")
+	if requestID == "" || len(requestID) > 128 {
+		requestID = logging.NewRequestID()
+	}
+	info := &logging.RequestInfo{ID: requestID}
+	ctx = logging.WithRequest(ctx, logger, info)
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", requestID))
+
+	return ctx, func(err error) {
+		code := status.Code(err)
+		attrs := []slog.Attr{
+			slog.String("method", method),
+			slog.String("code", code.String()),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+		}
+		if userID := info.UserID(); userID != uuid.Nil {
+			attrs = append(attrs, slog.String("user_id", userID.String()))
+		}
+
+		level := slog.LevelInfo
+		switch code {
+		case codes.OK, codes.Canceled:
+		case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unimplemented:
+			level = slog.LevelError
+		default:
+			level = slog.LevelWarn
+		}
+		logging.FromContext(ctx).LogAttrs(ctx, level, "rpc", attrs...)
+	}
+}
+
+func firstMetadata(ctx context.Context, key string) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+// bearerToken returns the access token in the call's metadata, or "" if
+// there is none or it is malformed.
+func bearerToken(ctx context.Context) string {
+	md, _ := metadata.FromIncomingContext(ctx)
+	token, err := auth.GetBearerToken(http.Header{"Authorization": md.Get("authorization")})
+	if err != nil {
+		return ""
+	}
+	return token
+}
+
+// authenticate resolves the call's access token to a user, as the REST
+// handlers do for the Authorization header.
+func authenticate(ctx context.Context, svc *service.Service) (database.User, error) {
+	token := bearerToken(ctx)
+	if token == "" {
+		return database.User{}, utils.Unauthorized("Missing or malformed bearer token")
+	}
+	return svc.Authenticate(ctx, token)
+}
+
+// validate applies the validate tags of the service's input types, which
+// DecodeJSON checks for REST.
+func validate(params any) error {
+	if details := utils.Validate(params); len(details) > 0 {
+		return utils.Validation(details...)
+	}
+	return nil
+}
+
+// parseID parses a UUID field. Empty values are an error unless optional.
+func parseID(value, field string, optional bool) (uuid.UUID, error) {
+	if value == "" && optional {
+		return uuid.Nil, nil
+	}
+	id, err := uuid.Parse(value)
+	if err != nil {
+		return uuid.Nil, utils.Validation(utils.FieldError{Field: field, Message: "must be a UUID"})
+	}
+	return id, nil
+}
+
+// toStatus converts a service error to a status with the same message. Its
+// code and any field errors ride along as ErrorInfo and BadRequest details.
+func toStatus(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+
+	var apiErr *utils.Error
+	if !errors.As(err, &apiErr) {
+		apiErr = utils.Internal("Internal server error", err)
+	}
+	if apiErr.Status >= http.StatusInternalServerError {
+		logging.FromContext(ctx).Error(apiErr.Message, "code", apiErr.Code, "err", apiErr.Err)
+	}
+
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: apiErr.Code, Domain: ErrorDomain}}
+	if len(apiErr.Details) > 0 {
+		badRequest := &errdetails.BadRequest{}
+		for _, field := range apiErr.Details {
+			badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+				Field:       field.Field,
+				Description: field.Message,
+			})
+		}
+		details = append(details, badRequest)
+	}
+
+	st := status.New(grpcCode(apiErr), apiErr.Message)
+	if withDetails, err := st.WithDetails(details...); err == nil {
+		st = withDetails
+	}
+	return st.Err()
+}
+
+// grpcCode maps an error's HTTP status to the nearest gRPC code.
+func grpcCode(err *utils.Error) codes.Code {
+	switch err.Status {
+	case http.StatusBadRequest, http.StatusRequestEntityTooLarge:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		if err.Code == utils.CodeEmailTaken {
+			return codes.AlreadyExists
+		}
+		return codes.FailedPrecondition
+	case http.StatusPreconditionFailed:
+		return codes.FailedPrecondition
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	}
+	return codes.Internal
+}
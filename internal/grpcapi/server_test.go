@@ -0,0 +1,238 @@
+package grpcapi_test
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/k3vwdd/chirpyWS/internal/grpcapi"
+	"github.com/k3vwdd/chirpyWS/internal/middleWare"
+	"github.com/k3vwdd/chirpyWS/internal/testenv"
+	"github.com/k3vwdd/chirpyWS/internal/types"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+	chirpyv1 "github.com/k3vwdd/chirpyWS/proto/chirpy/v1"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type clients struct {
+	users  chirpyv1.UsersServiceClient
+	auth   chirpyv1.AuthServiceClient
+	chirps chirpyv1.ChirpsServiceClient
+	// closeStreams ends watches as a server shutdown does.
+	closeStreams context.CancelFunc
+}
+
+// newServer serves the API over an in-memory connection. configure, if
+// given, adjusts the config first.
+func newServer(t *testing.T, configure ...func(*types.ApiConfig)) clients {
+	t.Helper()
+	env := testenv.New(t)
+	cfg := env.Config
+	for _, f := range configure {
+		f(cfg)
+	}
+	server := grpcapi.NewServer(cfg, slog.New(slog.NewTextHandler(io.Discard, nil)))
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return clients{
+		users:        chirpyv1.NewUsersServiceClient(conn),
+		auth:         chirpyv1.NewAuthServiceClient(conn),
+		chirps:       chirpyv1.NewChirpsServiceClient(conn),
+		closeStreams: env.CloseStreams,
+	}
+}
+
+func withToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// signUp creates a user and returns a context carrying their access token.
+func (c clients) signUp(t *testing.T, email string) (context.Context, *chirpyv1.User) {
+	t.Helper()
+	ctx := context.Background()
+	if _, err := c.users.CreateUser(ctx, &chirpyv1.CreateUserRequest{Email: email, Password: "hunter2"}); err != nil {
+		t.Fatal(err)
+	}
+	login, err := c.auth.Login(ctx, &chirpyv1.LoginRequest{Email: email, Password: "hunter2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return withToken(ctx, login.Token), login.User
+}
+
+// errorReason returns the code of the ErrorInfo detail on err.
+func errorReason(err error) string {
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			return info.Reason
+		}
+	}
+	return ""
+}
+
+func TestServer(t *testing.T) {
+	ctx := context.Background()
+	c := newServer(t)
+	alice, aliceUser := c.signUp(t, "alice@example.com")
+	bob, _ := c.signUp(t, "bob@example.com")
+
+	_, err := c.users.CreateUser(ctx, &chirpyv1.CreateUserRequest{Email: "alice@example.com", Password: "hunter2"})
+	if status.Code(err) != codes.AlreadyExists || errorReason(err) != utils.CodeEmailTaken {
+		t.Errorf("duplicate CreateUser = %v", err)
+	}
+
+	_, err = c.users.CreateUser(ctx, &chirpyv1.CreateUserRequest{Email: "not an email"})
+	var violations []*errdetails.BadRequest_FieldViolation
+	for _, detail := range status.Convert(err).Details() {
+		if badRequest, ok := detail.(*errdetails.BadRequest); ok {
+			violations = badRequest.FieldViolations
+		}
+	}
+	if status.Code(err) != codes.InvalidArgument || len(violations) != 2 {
+		t.Errorf("invalid CreateUser = %v with %v", err, violations)
+	}
+
+	if _, err := c.chirps.CreateChirp(ctx, &chirpyv1.CreateChirpRequest{Body: "hello"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CreateChirp without a token = %v", err)
+	}
+	if _, err := c.chirps.CreateChirp(withToken(ctx, "garbage"), &chirpyv1.CreateChirpRequest{Body: "hello"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("CreateChirp with a bad token = %v", err)
+	}
+
+	created, err := c.chirps.CreateChirp(alice, &chirpyv1.CreateChirpRequest{Body: "hello"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.Held || created.Chirp.UserId != aliceUser.Id {
+		t.Errorf("CreateChirp = %v", created)
+	}
+
+	list, err := c.chirps.ListChirps(ctx, &chirpyv1.ListChirpsRequest{AuthorId: aliceUser.Id, Sort: chirpyv1.SortOrder_SORT_ORDER_DESC})
+	if err != nil || len(list.Chirps) != 1 || list.Chirps[0].Body != "hello" {
+		t.Errorf("ListChirps = %v, %v", list, err)
+	}
+	if _, err := c.chirps.ListChirps(ctx, &chirpyv1.ListChirpsRequest{AuthorId: "nope"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("ListChirps with a bad author = %v", err)
+	}
+
+	if _, err := c.chirps.DeleteChirp(bob, &chirpyv1.DeleteChirpRequest{Id: created.Chirp.Id}); status.Code(err) != codes.PermissionDenied {
+		t.Errorf("DeleteChirp of another user's chirp = %v", err)
+	}
+	if _, err := c.chirps.DeleteChirp(alice, &chirpyv1.DeleteChirpRequest{Id: created.Chirp.Id}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.chirps.GetChirp(ctx, &chirpyv1.GetChirpRequest{Id: created.Chirp.Id}); status.Code(err) != codes.NotFound {
+		t.Errorf("GetChirp after delete = %v", err)
+	}
+
+	updated, err := c.users.UpdateUser(alice, &chirpyv1.UpdateUserRequest{Email: "alice@example.org", Password: "hunter3"})
+	if err != nil || updated.User.Email != "alice@example.org" {
+		t.Errorf("UpdateUser = %v, %v", updated, err)
+	}
+
+	login, err := c.auth.Login(ctx, &chirpyv1.LoginRequest{Email: "alice@example.org", Password: "hunter3"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.auth.Refresh(ctx, &chirpyv1.RefreshRequest{RefreshToken: login.RefreshToken}); err != nil {
+		t.Errorf("Refresh = %v", err)
+	}
+	if _, err := c.auth.Revoke(ctx, &chirpyv1.RevokeRequest{RefreshToken: login.RefreshToken}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.auth.Refresh(ctx, &chirpyv1.RefreshRequest{RefreshToken: login.RefreshToken}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Refresh after Revoke = %v", err)
+	}
+}
+
+func TestRateLimits(t *testing.T) {
+	ctx := context.Background()
+	c := newServer(t, func(cfg *types.ApiConfig) {
+		cfg.RateLimiter = &middleWare.RateLimiter{
+			Store:  middleWare.NewMemoryRateLimitStore(),
+			Rules:  map[string]middleWare.RateLimitRule{"POST /api/login": {Limit: 10, Window: time.Minute}},
+			JWTKEY: testenv.JWTKey,
+		}
+	})
+	c.signUp(t, "alice@example.com")
+
+	// signUp used one login; the rest of the minute's ten are guesses.
+	for i := range 10 {
+		_, err := c.auth.Login(ctx, &chirpyv1.LoginRequest{Email: "alice@example.com", Password: "guess"})
+		want, reason := codes.Unauthenticated, utils.CodeInvalidCredentials
+		if i == 9 {
+			want, reason = codes.ResourceExhausted, utils.CodeRateLimited
+		}
+		if status.Code(err) != want || errorReason(err) != reason {
+			t.Errorf("login %d = %v, want %s %s", i+2, err, want, reason)
+		}
+	}
+
+	// Other RPCs have no rule.
+	if _, err := c.chirps.ListChirps(ctx, &chirpyv1.ListChirpsRequest{}); err != nil {
+		t.Errorf("ListChirps = %v", err)
+	}
+}
+
+func TestWatchChirps(t *testing.T) {
+	c := newServer(t)
+	alice, aliceUser := c.signUp(t, "alice@example.com")
+	bob, _ := c.signUp(t, "bob@example.com")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := c.chirps.WatchChirps(ctx, &chirpyv1.WatchChirpsRequest{AuthorId: aliceUser.Id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Headers arrive once the server is running the call, so nothing
+	// posted from here on can be missed.
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, post := range []struct {
+		ctx  context.Context
+		body string
+	}{{bob, "from bob"}, {alice, "from alice"}} {
+		if _, err := c.chirps.CreateChirp(post.ctx, &chirpyv1.CreateChirpRequest{Body: post.body}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resp, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Chirp.Body != "from alice" {
+		t.Errorf("watched %q, want only alice's chirp", resp.Chirp.Body)
+	}
+
+	c.closeStreams()
+	if _, err := stream.Recv(); status.Code(err) != codes.Unavailable {
+		t.Errorf("Recv after shutdown = %v, want Unavailable", err)
+	}
+}
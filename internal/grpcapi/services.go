@@ -0,0 +1,202 @@
+package grpcapi
+
+import (
+	"context"
+
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	chirpyv1 "github.com/k3vwdd/chirpyWS/proto/chirpy/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func toUser(user database.User) *chirpyv1.User {
+	return &chirpyv1.User{
+		Id:          user.ID.String(),
+		Email:       user.Email,
+		CreatedAt:   timestamppb.New(user.CreatedAt),
+		UpdatedAt:   timestamppb.New(user.UpdatedAt),
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
+
+func toChirp(chirp database.Chirp, author database.User) *chirpyv1.Chirp {
+	return &chirpyv1.Chirp{
+		Id:          chirp.ID.String(),
+		Body:        chirp.Body,
+		UserId:      chirp.UserID.String(),
+		CreatedAt:   timestamppb.New(chirp.CreatedAt),
+		UpdatedAt:   timestamppb.New(chirp.UpdatedAt),
+		IsChirpyRed: author.IsChirpyRed,
+	}
+}
+
+var sortOrders = map[chirpyv1.SortOrder]string{
+	chirpyv1.SortOrder_SORT_ORDER_ASC:  service.SortAsc,
+	chirpyv1.SortOrder_SORT_ORDER_DESC: service.SortDesc,
+}
+
+type usersServer struct {
+	chirpyv1.UnimplementedUsersServiceServer
+	svc *service.Service
+}
+
+func (s *usersServer) CreateUser(ctx context.Context, req *chirpyv1.CreateUserRequest) (*chirpyv1.CreateUserResponse, error) {
+	params := service.Credentials{Email: req.Email, Password: req.Password}
+	if err := validate(params); err != nil {
+		return nil, err
+	}
+	user, err := s.svc.SignUp(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &chirpyv1.CreateUserResponse{User: toUser(user)}, nil
+}
+
+func (s *usersServer) UpdateUser(ctx context.Context, req *chirpyv1.UpdateUserRequest) (*chirpyv1.UpdateUserResponse, error) {
+	user, err := authenticate(ctx, s.svc)
+	if err != nil {
+		return nil, err
+	}
+	params := service.Credentials{Email: req.Email, Password: req.Password}
+	if err := validate(params); err != nil {
+		return nil, err
+	}
+	user, err = s.svc.UpdateCredentials(ctx, user, params)
+	if err != nil {
+		return nil, err
+	}
+	return &chirpyv1.UpdateUserResponse{User: toUser(user)}, nil
+}
+
+type authServer struct {
+	chirpyv1.UnimplementedAuthServiceServer
+	svc *service.Service
+}
+
+func (s *authServer) Login(ctx context.Context, req *chirpyv1.LoginRequest) (*chirpyv1.LoginResponse, error) {
+	params := service.Login{Email: req.Email, Password: req.Password}
+	if err := validate(params); err != nil {
+		return nil, err
+	}
+	session, err := s.svc.LogIn(ctx, params)
+	if err != nil {
+		return nil, err
+	}
+	return &chirpyv1.LoginResponse{
+		User:         toUser(session.User),
+		Token:        session.Token,
+		RefreshToken: session.RefreshToken,
+	}, nil
+}
+
+func (s *authServer) Refresh(ctx context.Context, req *chirpyv1.RefreshRequest) (*chirpyv1.RefreshResponse, error) {
+	token, err := s.svc.Refresh(ctx, req.RefreshToken)
+	if err != nil {
+		return nil, err
+	}
+	return &chirpyv1.RefreshResponse{Token: token}, nil
+}
+
+func (s *authServer) Revoke(ctx context.Context, req *chirpyv1.RevokeRequest) (*chirpyv1.RevokeResponse, error) {
+	if err := s.svc.Revoke(ctx, req.RefreshToken); err != nil {
+		return nil, err
+	}
+	return &chirpyv1.RevokeResponse{}, nil
+}
+
+type chirpsServer struct {
+	chirpyv1.UnimplementedChirpsServiceServer
+	svc *service.Service
+}
+
+func (s *chirpsServer) ListChirps(ctx context.Context, req *chirpyv1.ListChirpsRequest) (*chirpyv1.ListChirpsResponse, error) {
+	authorID, err := parseID(req.AuthorId, "author_id", true)
+	if err != nil {
+		return nil, err
+	}
+	chirps, err := s.svc.ListChirps(ctx, authorID, s.svc.ViewerID(bearerToken(ctx)), sortOrders[req.Sort])
+	if err != nil {
+		return nil, err
+	}
+	authors, err := s.svc.ChirpAuthors(ctx, chirps)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &chirpyv1.ListChirpsResponse{Chirps: make([]*chirpyv1.Chirp, 0, len(chirps))}
+	for _, chirp := range chirps {
+		resp.Chirps = append(resp.Chirps, toChirp(chirp, authors[chirp.UserID]))
+	}
+	return resp, nil
+}
+
+func (s *chirpsServer) GetChirp(ctx context.Context, req *chirpyv1.GetChirpRequest) (*chirpyv1.GetChirpResponse, error) {
+	id, err := parseID(req.Id, "id", false)
+	if err != nil {
+		return nil, err
+	}
+	chirp, author, err := s.svc.VisibleChirp(ctx, id, s.svc.ViewerID(bearerToken(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	return &chirpyv1.GetChirpResponse{Chirp: toChirp(chirp, author)}, nil
+}
+
+func (s *chirpsServer) CreateChirp(ctx context.Context, req *chirpyv1.CreateChirpRequest) (*chirpyv1.CreateChirpResponse, error) {
+	user, err := authenticate(ctx, s.svc)
+	if err != nil {
+		return nil, err
+	}
+	params := service.NewChirp{Body: req.Body}
+	if err := validate(params); err != nil {
+		return nil, err
+	}
+	chirp, err := s.svc.PostChirp(ctx, user, params)
+	if err != nil {
+		return nil, err
+	}
+	return &chirpyv1.CreateChirpResponse{Chirp: toChirp(chirp, user), Held: chirp.Status == service.ChirpHeld}, nil
+}
+
+func (s *chirpsServer) DeleteChirp(ctx context.Context, req *chirpyv1.DeleteChirpRequest) (*chirpyv1.DeleteChirpResponse, error) {
+	user, err := authenticate(ctx, s.svc)
+	if err != nil {
+		return nil, err
+	}
+	id, err := parseID(req.Id, "id", false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.svc.DeleteOwnChirp(ctx, user, id, nil); err != nil {
+		return nil, err
+	}
+	return &chirpyv1.DeleteChirpResponse{}, nil
+}
+
+func (s *chirpsServer) WatchChirps(req *chirpyv1.WatchChirpsRequest, stream chirpyv1.ChirpsService_WatchChirpsServer) error {
+	ctx := stream.Context()
+	authorID, err := parseID(req.AuthorId, "author_id", true)
+	if err != nil {
+		return err
+	}
+	watch, err := s.svc.WatchChirps(ctx, authorID, s.svc.ViewerID(bearerToken(ctx)))
+	if err != nil {
+		return err
+	}
+	defer watch.Close()
+
+	// Headers tell the client the watch is live: nothing published after
+	// they arrive is missed.
+	if err := stream.SendHeader(nil); err != nil {
+		return err
+	}
+	for {
+		e, err := watch.Next()
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&chirpyv1.WatchChirpsResponse{Chirp: toChirp(e.Chirp, e.Author)}); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+type userEnforcementResponse struct {
+	Id             uuid.UUID  `json:"id"`
+	Email          string     `json:"email"`
+	SuspendedUntil *time.Time `json:"suspended_until"`
+	ShadowBanned   bool       `json:"shadow_banned"`
+}
+
+type suspendUserRequest struct {
+	Hours int    `json:"hours" validate:"min=0,max=87600"`
+	Note  string `json:"note" validate:"max=500"`
+}
+
+type shadowBanRequest struct {
+	ShadowBanned bool   `json:"shadow_banned"`
+	Note         string `json:"note" validate:"max=500"`
+}
+
+// writeUserEnforcement re-reads the user so the response reflects what was stored.
+func (cfg *ApiConfig) writeUserEnforcement(w http.ResponseWriter, r *http.Request, userID uuid.UUID) {
+	user, err := cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Unable to fetch updated user", err))
+		return
+	}
+
+	response := userEnforcementResponse{
+		Id:           user.ID,
+		Email:        user.Email,
+		ShadowBanned: user.ShadowBanned,
+	}
+	if user.SuspendedUntil.Valid {
+		response.SuspendedUntil = &user.SuspendedUntil.Time
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, response)
+}
+
+// adminTargetUser authorizes an admin and loads the user named in the path.
+func (cfg *ApiConfig) adminTargetUser(w http.ResponseWriter, r *http.Request) (database.User, database.User, bool) {
+	admin, ok := cfg.requireRole(w, r, auth.RoleAdmin)
+	if !ok {
+		return database.User{}, database.User{}, false
+	}
+
+	userID, err := uuid.Parse(r.PathValue("userID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid user ID format"))
+		return database.User{}, database.User{}, false
+	}
+
+	target, err := cfg.Db.GetUserByID(r.Context(), userID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.LookupError(err, "User not found"))
+		return database.User{}, database.User{}, false
+	}
+
+	return admin, target, true
+}
+
+func (cfg *ApiConfig) HandleSuspendUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	admin, target, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	params := suspendUserRequest{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
+
+	if params.Hours <= 0 {
+		params.Hours = defaultSuspendHours
+	}
+
+	err := cfg.Db.SuspendUser(r.Context(), database.SuspendUserParams{
+		ID:             target.ID,
+		SuspendedUntil: sql.NullTime{Time: time.Now().Add(time.Duration(params.Hours) * time.Hour), Valid: true},
+	})
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error suspending user", err))
+		return
+	}
+
+	note := "suspended for " + strconv.Itoa(params.Hours) + " hours"
+	if params.Note != "" {
+		note = params.Note
+	}
+	cfg.writeAuditEntry(r, database.CreateModerationAuditEntryParams{
+		ModeratorID:  admin.ID,
+		Action:       resolutionSuspendUser,
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+		Note:         note,
+	})
+
+	cfg.writeUserEnforcement(w, r, target.ID)
+}
+
+func (cfg *ApiConfig) HandleUnsuspendUser(w http.ResponseWriter, r *http.Request) {
+	admin, target, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.Db.SuspendUser(r.Context(), database.SuspendUserParams{
+		ID: target.ID,
+	})
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error lifting suspension", err))
+		return
+	}
+
+	cfg.writeAuditEntry(r, database.CreateModerationAuditEntryParams{
+		ModeratorID:  admin.ID,
+		Action:       "unsuspend_user",
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+	})
+
+	cfg.writeUserEnforcement(w, r, target.ID)
+}
+
+func (cfg *ApiConfig) HandleShadowBanUser(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	admin, target, ok := cfg.adminTargetUser(w, r)
+	if !ok {
+		return
+	}
+
+	params := shadowBanRequest{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
+
+	err := cfg.Db.SetUserShadowBanned(r.Context(), database.SetUserShadowBannedParams{
+		ID:           target.ID,
+		ShadowBanned: params.ShadowBanned,
+	})
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error updating shadow ban", err))
+		return
+	}
+
+	action := "shadow_ban_user"
+	if !params.ShadowBanned {
+		action = "lift_shadow_ban"
+	}
+	cfg.writeAuditEntry(r, database.CreateModerationAuditEntryParams{
+		ModeratorID:  admin.ID,
+		Action:       action,
+		TargetUserID: uuid.NullUUID{UUID: target.ID, Valid: true},
+		Note:         params.Note,
+	})
+
+	cfg.writeUserEnforcement(w, r, target.ID)
+}
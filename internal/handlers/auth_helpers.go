@@ -0,0 +1,52 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// authenticate resolves the bearer token to a user, rejecting suspended
+// accounts. On failure it writes the error response and returns false.
+func (cfg *ApiConfig) authenticate(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	tokenString, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Unauthorized("Missing or malformed bearer token"))
+		return database.User{}, false
+	}
+
+	user, err := cfg.svc().Authenticate(r.Context(), tokenString)
+	if err != nil {
+		utils.RespondWithError(w, r, err)
+		return database.User{}, false
+	}
+	return user, true
+}
+
+// requireRole authenticates the request and checks that the user holds one of roles.
+func (cfg *ApiConfig) requireRole(w http.ResponseWriter, r *http.Request, roles ...string) (database.User, bool) {
+	user, ok := cfg.authenticate(w, r)
+	if !ok {
+		return database.User{}, false
+	}
+
+	for _, role := range roles {
+		if user.Role == role {
+			return user, true
+		}
+	}
+
+	utils.RespondWithError(w, r, utils.Forbidden("Insufficient role"))
+	return database.User{}, false
+}
+
+// viewerID returns the user behind an optional bearer token, or uuid.Nil for
+// anonymous callers. Read endpoints use it to show users their own
+// shadow-banned chirps.
+func (cfg *ApiConfig) viewerID(r *http.Request) uuid.UUID {
+	tokenString, _ := auth.GetBearerToken(r.Header)
+	return cfg.svc().ViewerID(tokenString)
+}
@@ -1,47 +1,113 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
+	"database/sql"
+	"errors"
+	"html/template"
 	"net/http"
-	"os"
-	"sort"
-	"sync/atomic"
 	"time"
-	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/k3vwdd/chirpyWS/internal/auth"
 	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/health"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/service"
 	"github.com/k3vwdd/chirpyWS/internal/types"
 	"github.com/k3vwdd/chirpyWS/internal/utils"
 )
 
 type ApiConfig struct {
 	*types.ApiConfig
-	FileServerHits atomic.Int32
+}
+
+// svc is the service layer the REST, GraphQL and gRPC APIs share.
+func (cfg *ApiConfig) svc() *service.Service {
+	return service.New(cfg.ApiConfig)
+}
+
+type userResponse struct {
+	Id          uuid.UUID `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Email       string    `json:"email"`
+	IsChirpyRed bool      `json:"is_chirpy_red"`
+}
+
+type loginResponse struct {
+	userResponse
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+type refreshResponse struct {
+	Token string `json:"token"`
+}
+
+type chirpResponse struct {
+	Id        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserId    uuid.UUID `json:"user_id"`
+}
+
+// createdChirpResponse also tells the author whether Chirpy Red raised
+// their rate limit.
+type createdChirpResponse struct {
+	chirpResponse
+	IsChirpyRed bool `json:"is_chirpy_red"`
+}
+
+type polkaWebhookRequest struct {
+	Event string `json:"event" validate:"required"`
+	Data  struct {
+		UserId string `json:"user_id" validate:"uuid"`
+	} `json:"data"`
+}
+
+func toUserResponse(user database.User) userResponse {
+	return userResponse{
+		Id:          user.ID,
+		CreatedAt:   user.CreatedAt,
+		UpdatedAt:   user.UpdatedAt,
+		Email:       user.Email,
+		IsChirpyRed: user.IsChirpyRed,
+	}
+}
+
+func toLoginResponse(session service.Session) loginResponse {
+	return loginResponse{
+		userResponse: toUserResponse(session.User),
+		Token:        session.Token,
+		RefreshToken: session.RefreshToken,
+	}
+}
+
+func toChirpResponse(chirp database.Chirp) chirpResponse {
+	return chirpResponse{
+		Id:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserId:    chirp.UserID,
+	}
 }
 
 
 func (cfg *ApiConfig) HandleRegister(w http.ResponseWriter, r *http.Request) {
     if cfg.ApiConfig.Platform != "dev" {
-        http.Error(w, "Forbidden", http.StatusForbidden)
+        utils.RespondWithError(w, r, utils.Forbidden("Reset is only available on the dev platform"))
         return
     }
 
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
     err := cfg.Db.DeleteAllUsers(r.Context())
     if err != nil {
-		utils.RespondWithErrorHelper(w, 400, "Unable to delete users from DB")
+		utils.RespondWithError(w, r, utils.Internal("Unable to delete users from DB", err))
 		return
     }
 
-    utils.RespondWithJSONHelper(w, 200, "Success.. All users removed from db")
+    utils.RespondWithJSONHelper(w, r, 200, "Success.. All users removed from db")
 	//cfg.FileServerHits.Store(0) // Resets the Hits.. their version
 	//w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	//w.WriteHeader(http.StatusOK)
@@ -49,612 +115,303 @@ func (cfg *ApiConfig) HandleRegister(w http.ResponseWriter, r *http.Request) {
 }
 
 func (cfg *ApiConfig) HandleHealthReadiness(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(http.StatusText(http.StatusOK)))
 }
 
-// Create a new handler that writes the number of requests that have been counted as plain text in this format to the HTTP response:
-// Hits: x
+type statusResponse struct {
+	Status string `json:"status"`
+}
 
-func (cfg *ApiConfig) HandleWriteHits(w http.ResponseWriter, r *http.Request) {
-	html := `
+// HandleLiveness only shows the process is serving requests; it never
+// touches dependencies, so a database outage doesn't get Chirpy restarted.
+func (cfg *ApiConfig) HandleLiveness(w http.ResponseWriter, r *http.Request) {
+	utils.RespondWithJSONHelper(w, r, http.StatusOK, statusResponse{Status: health.StatusOK})
+}
+
+// HandleReadiness runs every registered check and answers 503 if any of
+// them fail, so load balancers stop sending traffic.
+func (cfg *ApiConfig) HandleReadiness(w http.ResponseWriter, r *http.Request) {
+	report := health.Report{Status: health.StatusOK, Checks: []health.Result{}}
+	if cfg.Readiness != nil {
+		report = cfg.Readiness.Run(r.Context())
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if !report.Ready() {
+		utils.RespondWithJSONHelper(w, r, http.StatusServiceUnavailable, report)
+		return
+	}
+	utils.RespondWithJSONHelper(w, r, http.StatusOK, report)
+}
+
+// adminMetricsPage renders the same series /metrics exports, for humans.
+var adminMetricsPage = template.Must(template.New("metrics").Parse(`
     <html>
     <body>
     <h1>Welcome, Chirpy Admin</h1>
-    <p>Chirpy has been visited %v times!</p>
+    <p>Chirpy has been visited {{.Hits}} times!</p>
+    <table>
+    <tr><th>Metric</th><th>Labels</th><th>Value</th></tr>
+    {{range .Samples}}<tr><td>{{.Name}}</td><td>{{.Labels}}</td><td>{{.Value}}</td></tr>
+    {{end}}</table>
     </body>
     </html>
-    `
-	if r.Method != http.MethodGet {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, html, cfg.FileServerHits.Load())
-}
+    `))
 
-func (cfg *ApiConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusNotFound)
+func (cfg *ApiConfig) HandleWriteHits(w http.ResponseWriter, r *http.Request) {
+	samples, err := cfg.Metrics.Snapshot()
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Unable to gather metrics", err))
 		return
 	}
 
-	defer r.Body.Close()
-
-	type requestBody struct {
-        Password string `json:"password"`
-		Email string `json:"email"`
+	hits := 0.0
+	for _, sample := range samples {
+		if sample.Name == "chirpy_fileserver_hits_total" {
+			hits = sample.Value
+		}
 	}
 
-	type responseBody struct {
-		Id uuid.UUID `json:"id"`
-        CreatedAt time.Time `json:"created_at"`
-        UpdatedAt time.Time `json:"updated_at"`
-        Email string `json:"email"`
-        IsChirpyRed bool `json:"is_chirpy_red"`
-	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	adminMetricsPage.Execute(w, struct {
+		Hits    float64
+		Samples []metrics.Sample
+	}{hits, samples})
+}
 
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "couldn't read request")
+func (cfg *ApiConfig) HandleCreateUser(w http.ResponseWriter, r *http.Request) {
+	params := service.Credentials{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-	params := requestBody{}
-	err = json.Unmarshal(data, &params)
+	user, err := cfg.svc().SignUp(r.Context(), params)
 	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "couldn't unmarshal parameters")
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-    hashPassword, err := auth.HashPassword(params.Password)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "Unable to hash password")
-		return
-    }
-
-    user, err := cfg.Db.CreateUser(r.Context(), database.CreateUserParams{
-        ID: uuid.New(),
-        CreatedAt: time.Now(),
-        UpdatedAt: time.Now(),
-        Email: params.Email,
-        HashedPassword: hashPassword,
-    })
-
-    if err != nil {
-		fmt.Fprintf(os.Stderr, "Error Creating user: %v\n", err)
-    }
-
-	utils.RespondWithJSONHelper(w, 201, responseBody{
-        Id: user.ID,
-        CreatedAt: user.CreatedAt,
-        UpdatedAt: user.UpdatedAt,
-        Email: user.Email,
-	})
+	utils.RespondWithJSONHelper(w, r, 201, toUserResponse(user))
 }
 
 func (cfg *ApiConfig) HandleCreateChirp(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
-		utils.RespondWithErrorHelper(w, 404, "Unauthorized: Method Not Allowed")
-        return
-    }
-
-    defer r.Body.Close()
-
-	type requestBody struct {
-		Body string `json:"body"`
-	}
-
-	type responseBody struct {
-		Id uuid.UUID `json:"id"`
-        CreatedAt time.Time `json:"created_at"`
-        UpdatedAt time.Time `json:"updated_at"`
-		Body string `json:"body"`
-        UserId uuid.UUID `json:"user_id"`
-        IsChirpyRed bool `json:"is_chirpy_red"`
+	user, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
 	}
 
-    authHeader := r.Header
-    tokenString, err := auth.GetBearerToken(authHeader)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 404, "Unauthorized: Invalid header")
-        return
-    }
-
-    userID, err := auth.ValidateJWT(tokenString, cfg.JWTKEY)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unauthorized: Invalid token")
-        return
-    }
-
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "couldn't read request")
+	params := service.NewChirp{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-	params := requestBody{}
-	err = json.Unmarshal(data, &params)
+	chirp, err := cfg.svc().PostChirp(r.Context(), user, params)
 	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "error with json format")
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-	chirpCount := utf8.RuneCountInString(params.Body)
-	if chirpCount > 140 {
-		utils.RespondWithErrorHelper(w, 400, "Chirp is too long")
-		return
+	statusCode := http.StatusCreated
+	if chirp.Status == service.ChirpHeld {
+		statusCode = http.StatusAccepted
 	}
-
-    cleanedWords := utils.CheckBadChirpLang(params.Body)
-
-    chirp, err := cfg.Db.CreateChirp(r.Context(), database.CreateChirpParams{
-        ID:        uuid.New(),
-        CreatedAt: time.Now(),
-        UpdatedAt: time.Now(),
-        Body:      cleanedWords,
-        UserID: userID,
-    })
-
-    if err != nil {
-		utils.RespondWithErrorHelper(w, http.StatusBadRequest, "Error creating chirp")
-        return
-    }
-
-    user, err := cfg.Db.GetUserByID(r.Context(), userID)
-    if err != nil {
-        utils.RespondWithErrorHelper(w, http.StatusBadRequest, "Error creating chirp")
-        return
-
-    }
-
-	utils.RespondWithJSONHelper(w, 201, responseBody{
-        Id: chirp.ID,
-        CreatedAt: chirp.CreatedAt,
-        UpdatedAt: chirp.UpdatedAt,
-        Body: cleanedWords,
-        UserId: userID,
-        IsChirpyRed: user.IsChirpyRed,
+	utils.RespondWithJSONHelper(w, r, statusCode, createdChirpResponse{
+		chirpResponse: toChirpResponse(chirp),
+		IsChirpyRed:   user.IsChirpyRed,
 	})
 }
 
 func (cfg *ApiConfig) HandleGetChirps(w http.ResponseWriter, r *http.Request) {
+	var authorID uuid.UUID
+	if authorIDString := r.URL.Query().Get("author_id"); authorIDString != "" {
+		var err error
+		authorID, err = uuid.Parse(authorIDString)
+		if err != nil {
+			utils.RespondWithError(w, r, utils.BadRequest("Invalid author ID format"))
+			return
+		}
+	}
 
-    if r.Method != http.MethodGet {
-        utils.RespondWithErrorHelper(w, 400, "method not allowed")
-        return
-    }
-
-    type responseBody struct {
-        Id uuid.UUID `json:"id"`
-        CreatedAt time.Time `json:"created_at"`
-        UpdatedAt time.Time `json:"updated_at"`
-        Body string `json:"body"`
-        UserId uuid.UUID `json:"user_id"`
-    }
-
-
-    authorIDString := r.URL.Query().Get("author_id")
-    sortParam := r.URL.Query().Get("sort")
-    var err error
-    var chirps []database.Chirp
-    result := []responseBody{}
-
-    if authorIDString != "" {
-        authorID, err := uuid.Parse(authorIDString)
-        if err != nil {
-            utils.RespondWithErrorHelper(w, http.StatusBadRequest, "Invalid author ID format")
-            return
-        }
-        chirps, err = cfg.Db.GetChirpsByAuthorID(r.Context(), authorID)
-    } else {
-        chirps, err = cfg.Db.GetAllChirps(r.Context())
-    }
-
-    if sortParam == "desc" {
-        //for i, j := 0, len(chirps)-1; i < j; i, j = i+1, j-1 {
-        //    chirps[i], chirps[j] = chirps[j], chirps[i]
-        //}
-        sort.Slice(chirps, func(i, j int) bool {
-            return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
-        })
-    } else if sortParam == "asc" {
-        sort.Slice(chirps, func(i, j int) bool {
-            return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
-        })
-    }
-
-    if err != nil {
-        utils.RespondWithErrorHelper(w, http.StatusInternalServerError, "Error fetching chirps")
-    }
-
-    for _, val := range chirps {
-        result = append(result, responseBody{
-            Id: val.ID,
-            CreatedAt: val.CreatedAt,
-            UpdatedAt: val.UpdatedAt,
-            Body: val.Body,
-            UserId: val.UserID,
-        })
-    }
+	chirps, err := cfg.svc().ListChirps(r.Context(), authorID, cfg.viewerID(r), r.URL.Query().Get("sort"))
+	if err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
 
-    utils.RespondWithJSONHelper(w, http.StatusOK, result)
+	cfg.respondChirps(w, r, chirps)
 }
 
 func (cfg *ApiConfig) HandleGetSingleChirp(w http.ResponseWriter, r *http.Request) {
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid chirp ID format"))
+		return
+	}
 
-    if r.Method != http.MethodGet {
-        http.Error(w, "Method Not Allowed", http.StatusNotFound)
-        return
-    }
-
-    type responseBody struct {
-        Id uuid.UUID `json:"id"`
-        CreatedAt time.Time `json:"created_at"`
-        UpdatedAt time.Time `json:"updated_at"`
-        Body string `json:"body"`
-        UserId uuid.UUID `json:"user_id"`
-    }
-
-    requestedChirp := r.PathValue("chirpID")
-    parsedChirp, err := uuid.Parse(requestedChirp)
-    if err != nil {
-        utils.RespondWithErrorHelper(w, 500, "unable to convert string to uuid")
-        return
-    }
-
-    getChirp, err := cfg.Db.GetChirpByID(r.Context(), parsedChirp)
-    if err != nil {
-        utils.RespondWithErrorHelper(w, 400, "chirpID doesn't exists")
-        return
-    }
-
-    chirp := responseBody{
-            Id: getChirp.ID,
-            CreatedAt: getChirp.CreatedAt,
-            UpdatedAt: getChirp.UpdatedAt,
-            Body: getChirp.Body,
-            UserId: getChirp.UserID,
-        }
+	chirp, author, err := cfg.svc().VisibleChirp(r.Context(), chirpID, cfg.viewerID(r))
+	if err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
 
-        utils.RespondWithJSONHelper(w, 200, chirp)
-    }
+	respondChirp(w, r, chirp, author)
+}
 
 func (cfg *ApiConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodDelete {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
-    authHeader := r.Header
-    tokenString, err := auth.GetBearerToken(authHeader)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 404, "Unauthorized: Invalid header")
-        return
-    }
-
-    userID, err := auth.ValidateJWT(tokenString, cfg.JWTKEY)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unauthorized: Invalid token")
-        return
-    }
-
-    requestedChirp := r.PathValue("chirpID")
-    parsedChirp, err := uuid.Parse(requestedChirp)
-    if err != nil {
-        utils.RespondWithErrorHelper(w, 500, "unable to convert string to uuid")
-        return
-    }
-
-    getChirp, err := cfg.Db.GetChirpByID(r.Context(), parsedChirp)
-    if err != nil {
-        utils.RespondWithErrorHelper(w, 400, "chirpID doesn't exists")
-        return
-    }
+	user, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
 
-    if getChirp.UserID != userID {
-        utils.RespondWithErrorHelper(w, 403, "Forbidden: You can only delete your own chirps")
-        return
-    }
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid chirp ID format"))
+		return
+	}
 
-    err = cfg.Db.DeleteChirpByID(r.Context(), getChirp.ID)
-    if err != nil {
-        utils.RespondWithErrorHelper(w, 404, "Unable to remove chirp")
-        return
-    }
+	// The chirp is the user's own, so they are its author in v2's ETag.
+	ifMatch := func(chirp database.Chirp) error {
+		return utils.CheckIfMatch(r, chirpETag(r, chirp, user))
+	}
+	if err := cfg.svc().DeleteOwnChirp(r.Context(), user, chirpID, ifMatch); err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
 
-    utils.RespondWithJSONHelper(w, 204, "Chirp deleted")
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *ApiConfig) HandleLogin(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
-        http.Error(w, "Method Not Allowed", http.StatusNotFound)
-        return
-    }
-
-    defer r.Body.Close()
-
-	type requestBody struct {
-		Email string `json:"email"`
-        Password string `json:"password"`
-        //ExpiresInSeconds *int `json:"expires_in_seconds"`
-	}
-
-    type responseBody struct {
-        Id uuid.UUID `json:"id"`
-        CreatedAt time.Time `json:"created_at"`
-        UpdatedAt time.Time `json:"updated_at"`
-        Email string `json:"email"`
-        Token string `json:"token"`
-        RefreshToken string `json:"refresh_token"`
-        IsChirpyRed bool `json:"is_chirpy_red"`
-    }
-
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "couldn't read request")
+	params := service.Login{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-	params := requestBody{}
-	err = json.Unmarshal(data, &params)
+	session, err := cfg.svc().LogIn(r.Context(), params)
 	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "error with json format")
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-    getUser, err := cfg.Db.GetUserByEmail(r.Context(), params.Email)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 400, "Incorrect email or password")
-		return
-    }
-
-    checkPass := auth.CheckPasswordHash(params.Password, getUser.HashedPassword)
-    if checkPass != nil {
-		utils.RespondWithErrorHelper(w, 400, "Incorrect email or password")
-        return
-    }
-
-    refreshtoken, err := auth.MakeRefreshToken()
-    if err != nil {
-        utils.RespondWithErrorHelper(w, 500, "Failed to generate refresh token")
-        return
-    }
-
-    createRefreshToken := cfg.Db.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
-        Token: refreshtoken,
-        UserID: getUser.ID,
-    })
-
-    if createRefreshToken != nil {
-        utils.RespondWithErrorHelper(w, 500, "Failed to create refresh token in db")
-    }
-
-    //if params.ExpiresInSeconds != nil {
-    //    requestedDuration := time.Duration(*params.ExpiresInSeconds) * time.Second
-
-    //    if requestedDuration < defaultDuration {
-    //        defaultDuration = requestedDuration
-    //    }
-    //}
-
-    jwtToken, err := auth.MakeJWT(getUser.ID, cfg.JWTKEY, time.Hour * 1)
-    if err != nil {
-        utils.RespondWithErrorHelper(w, 500, "Failed to generate JWT")
-        return
-    }
-
-    user := responseBody{
-        Id: getUser.ID,
-        CreatedAt: getUser.CreatedAt,
-        UpdatedAt: getUser.UpdatedAt,
-        Email: getUser.Email,
-        Token: jwtToken,
-        RefreshToken: refreshtoken,
-        IsChirpyRed: getUser.IsChirpyRed,
-    }
-
-	utils.RespondWithJSONHelper(w, 200, user)
+	utils.RespondWithJSONHelper(w, r, 200, toLoginResponse(session))
 }
 
 
 func (cfg *ApiConfig) HandleRefresh(w http.ResponseWriter, r *http.Request) {
-    type responseBody struct {
-        Token string `json:"token"`
-    }
-
-    if r.Method != http.MethodPost {
-        http.Error(w, "Method Not Allowed", http.StatusNotFound)
-        return
-    }
-
-    authHeader := r.Header
-    refreshTokenString, err := auth.GetBearerToken(authHeader)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unauthorized: Invalid header")
-        return
-    }
-
-    user, err := cfg.Db.GetUserFromRefreshToken(r.Context(), refreshTokenString)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unable to retrieve token from user")
-        return
-    }
-
-    jwtToken, err := auth.MakeJWT(user.ID, cfg.JWTKEY, time.Hour * 1)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Error creating jwt with duration 1 hour")
-        return
-    }
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Unauthorized("Missing or malformed bearer token"))
+		return
+	}
 
-    utils.RespondWithJSONHelper(w, 200, responseBody{
-        Token: jwtToken,
-    })
+	token, err := cfg.svc().Refresh(r.Context(), refreshToken)
+	if err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
 
+	utils.RespondWithJSONHelper(w, r, 200, refreshResponse{Token: token})
 }
 
 func (cfg *ApiConfig) HandleRevokeToken(w http.ResponseWriter, r *http.Request) {
-    if r.Method != http.MethodPost {
-        http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-        return
-    }
-
-    authHeader := r.Header
-    refreshTokenString, err := auth.GetBearerToken(authHeader)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unauthorized: Invalid header")
-        return
-    }
-
-    err = cfg.Db.RevokeRefreshToken(r.Context(), refreshTokenString)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unauthorized: Unable to revoke refresh token")
-        return
-    }
+	refreshToken, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Unauthorized("Missing or malformed bearer token"))
+		return
+	}
 
-    utils.RespondWithJSONHelper(w, 204, "")
+	if err := cfg.svc().Revoke(r.Context(), refreshToken); err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
 
+	w.WriteHeader(http.StatusNoContent)
 }
 
 func (cfg *ApiConfig) HandleUpdateUser(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+	authUser, ok := cfg.authenticate(w, r)
+	if !ok {
 		return
 	}
 
-	defer r.Body.Close()
-
-	type requestBody struct {
-        Password string `json:"password"`
-		Email string `json:"email"`
-	}
-
-	type responseBody struct {
-		Id uuid.UUID `json:"id"`
-        CreatedAt time.Time `json:"created_at"`
-        UpdatedAt time.Time `json:"updated_at"`
-        Email string `json:"email"`
-	}
-
-    authHeader := r.Header
-    tokenString, err := auth.GetBearerToken(authHeader)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 404, "Unauthorized: Invalid header")
-        return
-    }
-
-    userID, err := auth.ValidateJWT(tokenString, cfg.JWTKEY)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unauthorized: Invalid token")
-        return
-    }
-
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "couldn't read request")
+	params := service.Credentials{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-	params := requestBody{}
-	err = json.Unmarshal(data, &params)
+	user, err := cfg.svc().UpdateCredentials(r.Context(), authUser, params)
 	if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "couldn't unmarshal parameters")
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
-    hashPassword, err := auth.HashPassword(params.Password)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "Unable to hash password")
-		return
-    }
-
-    err = cfg.Db.UpdateUserEmailAndPassword(r.Context(), database.UpdateUserEmailAndPasswordParams{
-        Email: params.Email,
-        ID: userID,
-        HashedPassword: hashPassword,
-    })
-
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "Error Updating email and password")
-        return
-    }
-
-    user, err := cfg.Db.GetUserByID(r.Context(), userID)
-    if err != nil {
-		utils.RespondWithErrorHelper(w, 500, "Unalbe to fetch updated User")
-        return
-    }
-
-	utils.RespondWithJSONHelper(w, 200, responseBody{
-        Email: params.Email,
-        Id: user.ID,
-        CreatedAt: user.CreatedAt,
-        UpdatedAt: user.UpdatedAt,
-	})
+	utils.RespondWithJSONHelper(w, r, 200, toUserResponse(user))
 }
 
 func (cfg *ApiConfig) HandleWebHook(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
-		return
-	}
-
 	defer r.Body.Close()
 
-    type requestBody struct {
-        Event string `json:"event"`
-        Data struct {
-            UserId string `json:"user_id"`
-        } `json:"data"`
-    }
-
-	data, err := io.ReadAll(r.Body)
-	if err != nil {
-		utils.RespondWithErrorHelper(w, http.StatusBadRequest, "couldn't read request")
-		return
-	}
+    outcome := metrics.WebhookBadRequest
+    defer func() {
+        cfg.Metrics.Webhooks.WithLabelValues(outcome).Inc()
+    }()
 
     authHeader := r.Header
     apiKey, err := auth.GetAPIKey(authHeader)
     if err != nil {
-		utils.RespondWithErrorHelper(w, 401, "Unauthorized: unable to get extract header")
+        outcome = metrics.WebhookUnauthorized
+		utils.RespondWithError(w, r, utils.Unauthorized("Missing or malformed API key"))
         return
     }
 
     if apiKey != cfg.APIKEY {
-		utils.RespondWithErrorHelper(w, http.StatusBadRequest, "Unauthorized: Invalid API KEY")
+        outcome = metrics.WebhookUnauthorized
+		utils.RespondWithError(w, r, utils.Unauthorized("Invalid API key"))
         return
     }
 
-	params := requestBody{}
-	err = json.Unmarshal(data, &params)
-	if err != nil {
-		utils.RespondWithErrorHelper(w, http.StatusBadRequest, "Bad Request")
+	// Polka may add fields to its payloads at any time.
+	params := polkaWebhookRequest{}
+	if err := utils.DecodeJSONWith(w, r, &params, utils.DecodeOptions{AllowUnknownFields: true}); err != nil {
+		utils.RespondWithError(w, r, err)
 		return
 	}
 
     if params.Event != "user.upgraded" {
-		utils.RespondWithErrorHelper(w, http.StatusNoContent, "")
+        outcome = metrics.WebhookIgnored
+		w.WriteHeader(http.StatusNoContent)
 		return
     }
 
     user, err := uuid.Parse(params.Data.UserId)
     if err != nil {
-        utils.RespondWithErrorHelper(w, http.StatusBadRequest, "Bad Request")
+        utils.RespondWithError(w, r, utils.Validation(utils.FieldError{Field: "data.user_id", Message: "is required"}))
+        return
+    }
+
+    // The upgrade is an UPDATE, which succeeds on a missing row.
+    _, err = cfg.Db.GetUserByID(r.Context(), user)
+    if err != nil {
+        if errors.Is(err, sql.ErrNoRows) {
+            outcome = metrics.WebhookUnknownUser
+        }
+        utils.RespondWithError(w, r, utils.LookupError(err, "User not found"))
         return
     }
 
     err = cfg.Db.UpgradeUserToChirpyRed(r.Context(), user)
     if err != nil {
-        utils.RespondWithErrorHelper(w, http.StatusNotFound, "")
+        utils.RespondWithError(w, r, utils.Internal("Unable to upgrade user", err))
         return
     }
 
-    utils.RespondWithErrorHelper(w, http.StatusNoContent, "")
+    outcome = metrics.WebhookUpgraded
+    w.WriteHeader(http.StatusNoContent)
 }
@@ -0,0 +1,509 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/gqlerrors"
+	"github.com/graphql-go/graphql/language/parser"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/dataloader"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// MaxQueryComplexity bounds the cost of one GraphQL operation; see
+// queryComplexity for how it is counted.
+const MaxQueryComplexity = 500
+
+type graphQLRequest struct {
+	Query         string         `json:"query" validate:"required,max=20000"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+}
+
+type graphQLError struct {
+	Message    string         `json:"message"`
+	Path       []any          `json:"path,omitempty"`
+	Extensions map[string]any `json:"extensions,omitempty"`
+}
+
+type graphQLResponse struct {
+	Data   any            `json:"data,omitempty"`
+	Errors []graphQLError `json:"errors,omitempty"`
+}
+
+// graphQLSession is the per-request state resolvers share.
+type graphQLSession struct {
+	svc      *service.Service
+	token    string
+	clientIP string
+	users    *dataloader.Loader[uuid.UUID, database.User]
+
+	viewerOnce sync.Once
+	viewer     database.User
+	viewerErr  error
+}
+
+type graphQLSessionKey struct{}
+
+func session(ctx context.Context) *graphQLSession {
+	return ctx.Value(graphQLSessionKey{}).(*graphQLSession)
+}
+
+// user authenticates the request the way the REST handlers do.
+func (s *graphQLSession) user(ctx context.Context) (database.User, error) {
+	s.viewerOnce.Do(func() {
+		if s.token == "" {
+			s.viewerErr = utils.Unauthorized("Missing or malformed bearer token")
+			return
+		}
+		s.viewer, s.viewerErr = s.svc.Authenticate(ctx, s.token)
+	})
+	return s.viewer, s.viewerErr
+}
+
+// viewerID is the caller, or uuid.Nil for anonymous callers.
+func (s *graphQLSession) viewerID() uuid.UUID {
+	return s.svc.ViewerID(s.token)
+}
+
+// limit counts a mutation against the rate limit of the REST route it
+// mirrors, so GraphQL isn't a way around it.
+func (s *graphQLSession) limit(ctx context.Context, pattern string) error {
+	if s.svc.RateLimiter == nil {
+		return nil
+	}
+	return s.svc.RateLimiter.Limit(ctx, pattern, s.clientIP, s.viewerID())
+}
+
+func (cfg *ApiConfig) HandleGraphQL(w http.ResponseWriter, r *http.Request) {
+	params := graphQLRequest{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
+
+	token, _ := auth.GetBearerToken(r.Header)
+	s := &graphQLSession{
+		svc:   cfg.svc(),
+		token: token,
+		users: dataloader.New(cfg.batchUsers),
+	}
+	if cfg.RateLimiter != nil {
+		s.clientIP = cfg.RateLimiter.ClientIP(r)
+	}
+	ctx := context.WithValue(r.Context(), graphQLSessionKey{}, s)
+
+	utils.RespondWithJSONHelper(w, r, http.StatusOK, cfg.executeGraphQL(ctx, params))
+}
+
+// executeGraphQL parses, validates, prices and runs one request. Errors in
+// any of those steps are reported in the response, as GraphQL expects.
+func (cfg *ApiConfig) executeGraphQL(ctx context.Context, params graphQLRequest) graphQLResponse {
+	schema := graphQLSchema()
+
+	doc, err := parser.Parse(parser.ParseParams{Source: params.Query})
+	if err != nil {
+		return graphQLResponse{Errors: formatGraphQLErrors(ctx, []gqlerrors.FormattedError{gqlerrors.FormatError(err)})}
+	}
+	if result := graphql.ValidateDocument(&schema, doc, nil); !result.IsValid {
+		return graphQLResponse{Errors: formatGraphQLErrors(ctx, result.Errors)}
+	}
+	if cost := queryComplexity(&schema, doc); cost > MaxQueryComplexity {
+		return graphQLResponse{Errors: []graphQLError{{
+			Message: "Query is too complex",
+			Extensions: map[string]any{
+				"code":       utils.CodeQueryTooComplex,
+				"complexity": cost,
+				"limit":      MaxQueryComplexity,
+			},
+		}}}
+	}
+
+	result := graphql.Execute(graphql.ExecuteParams{
+		Schema:        schema,
+		AST:           doc,
+		OperationName: params.OperationName,
+		Args:          params.Variables,
+		Context:       ctx,
+	})
+	return graphQLResponse{Data: result.Data, Errors: formatGraphQLErrors(ctx, result.Errors)}
+}
+
+// formatGraphQLErrors gives resolver errors the same code, status and
+// field details a REST problem has, and logs server errors.
+func formatGraphQLErrors(ctx context.Context, errs []gqlerrors.FormattedError) []graphQLError {
+	var formatted []graphQLError
+	for _, e := range errs {
+		out := graphQLError{Message: e.Message, Path: e.Path}
+		if apiErr, ok := originalError(e).(*utils.Error); ok {
+			out.Message = apiErr.Message
+			out.Extensions = map[string]any{"code": apiErr.Code, "status": apiErr.Status}
+			if len(apiErr.Details) > 0 {
+				out.Extensions["errors"] = apiErr.Details
+			}
+			if apiErr.Status >= http.StatusInternalServerError {
+				logging.FromContext(ctx).Error(apiErr.Message, "code", apiErr.Code, "err", apiErr.Err)
+			}
+		}
+		formatted = append(formatted, out)
+	}
+	return formatted
+}
+
+// originalError digs a resolver's error out of the layers graphql-go wraps
+// it in. Neither of its error types implements Unwrap.
+func originalError(err error) error {
+	for {
+		switch e := err.(type) {
+		case gqlerrors.FormattedError:
+			if e.OriginalError() == nil {
+				return err
+			}
+			err = e.OriginalError()
+		case *gqlerrors.Error:
+			if e.OriginalError == nil {
+				return err
+			}
+			err = e.OriginalError
+		default:
+			return err
+		}
+	}
+}
+
+func (cfg *ApiConfig) batchUsers(ctx context.Context, ids []uuid.UUID) (map[uuid.UUID]database.User, error) {
+	users, err := cfg.Db.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, utils.Internal("Unable to load users", err)
+	}
+	byID := make(map[uuid.UUID]database.User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+	return byID, nil
+}
+
+// validateArgs runs the REST request type's validate tags over GraphQL
+// arguments copied into it.
+func validateArgs(params any) error {
+	if details := utils.Validate(params); len(details) > 0 {
+		return utils.Validation(details...)
+	}
+	return nil
+}
+
+func parseID(value any, field string) (uuid.UUID, error) {
+	id, err := uuid.Parse(value.(string))
+	if err != nil {
+		return uuid.Nil, utils.Validation(utils.FieldError{Field: field, Message: "must be a UUID"})
+	}
+	return id, nil
+}
+
+// orNotFound turns a 404 into a null result, the GraphQL way of saying
+// something doesn't exist.
+func orNotFound(value any, err error) (any, error) {
+	var apiErr *utils.Error
+	if errors.As(err, &apiErr) && apiErr.Status == http.StatusNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+type createChirpPayload struct {
+	Chirp database.Chirp
+	Held  bool
+}
+
+var graphQLSchema = sync.OnceValue(func() graphql.Schema {
+	sortOrder := graphql.NewEnum(graphql.EnumConfig{
+		Name: "SortOrder",
+		Values: graphql.EnumValueConfigMap{
+			"ASC":  {Value: "asc"},
+			"DESC": {Value: "desc"},
+		},
+	})
+
+	var chirpType *graphql.Object
+	userType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "User",
+		Fields: graphql.FieldsThunk(func() graphql.Fields {
+			return graphql.Fields{
+				"id": {Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(database.User).ID.String(), nil
+				}},
+				"email": {
+					Type:        graphql.String,
+					Description: "Only visible to the user and to admins.",
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						user := p.Source.(database.User)
+						viewer, err := session(p.Context).user(p.Context)
+						if err != nil || (viewer.ID != user.ID && viewer.Role != auth.RoleAdmin) {
+							return nil, nil
+						}
+						return user.Email, nil
+					},
+				},
+				"createdAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(database.User).CreatedAt, nil
+				}},
+				"isChirpyRed": {Type: graphql.NewNonNull(graphql.Boolean), Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(database.User).IsChirpyRed, nil
+				}},
+				"chirps": {
+					Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(chirpType))),
+					Args: graphql.FieldConfigArgument{"sort": {Type: sortOrder}},
+					Resolve: func(p graphql.ResolveParams) (any, error) {
+						s := session(p.Context)
+						order, _ := p.Args["sort"].(string)
+						return s.svc.ListChirps(p.Context, p.Source.(database.User).ID, s.viewerID(), order)
+					},
+				},
+			}
+		}),
+	})
+
+	chirpType = graphql.NewObject(graphql.ObjectConfig{
+		Name: "Chirp",
+		Fields: graphql.Fields{
+			"id": {Type: graphql.NewNonNull(graphql.ID), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(database.Chirp).ID.String(), nil
+			}},
+			"body": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(database.Chirp).Body, nil
+			}},
+			"createdAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(database.Chirp).CreatedAt, nil
+			}},
+			"updatedAt": {Type: graphql.NewNonNull(graphql.DateTime), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(database.Chirp).UpdatedAt, nil
+			}},
+			"author": {
+				Type:        graphql.NewNonNull(userType),
+				Description: "Loaded in one batch for every chirp in the response.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					load := session(p.Context).users.Load(p.Context, p.Source.(database.Chirp).UserID)
+					return func() (any, error) {
+						user, err := load()
+						if errors.Is(err, dataloader.ErrNotFound) {
+							return nil, utils.NotFound("Author not found")
+						}
+						return user, err
+					}, nil
+				},
+			},
+		},
+	})
+
+	authPayload := graphql.NewObject(graphql.ObjectConfig{
+		Name: "AuthPayload",
+		Fields: graphql.Fields{
+			"token": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(service.Session).Token, nil
+			}},
+			"refreshToken": {Type: graphql.NewNonNull(graphql.String), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(service.Session).RefreshToken, nil
+			}},
+			"user": {Type: graphql.NewNonNull(userType), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(service.Session).User, nil
+			}},
+		},
+	})
+
+	createChirpPayloadType := graphql.NewObject(graphql.ObjectConfig{
+		Name: "CreateChirpPayload",
+		Fields: graphql.Fields{
+			"chirp": {Type: graphql.NewNonNull(chirpType), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return p.Source.(createChirpPayload).Chirp, nil
+			}},
+			"held": {
+				Type:        graphql.NewNonNull(graphql.Boolean),
+				Description: "Moderation held the chirp for review; nobody else can see it yet.",
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					return p.Source.(createChirpPayload).Held, nil
+				},
+			},
+		},
+	})
+
+	credentialArgs := graphql.FieldConfigArgument{
+		"email":    {Type: graphql.NewNonNull(graphql.String)},
+		"password": {Type: graphql.NewNonNull(graphql.String)},
+	}
+	credentials := func(args map[string]any) service.Credentials {
+		return service.Credentials{Email: args["email"].(string), Password: args["password"].(string)}
+	}
+
+	query := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Query",
+		Fields: graphql.Fields{
+			"me": {Type: graphql.NewNonNull(userType), Resolve: func(p graphql.ResolveParams) (any, error) {
+				return session(p.Context).user(p.Context)
+			}},
+			"user": {
+				Type: userType,
+				Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, err := parseID(p.Args["id"], "id")
+					if err != nil {
+						return nil, err
+					}
+					load := session(p.Context).users.Load(p.Context, id)
+					return func() (any, error) {
+						user, err := load()
+						if errors.Is(err, dataloader.ErrNotFound) {
+							return nil, nil
+						}
+						return user, err
+					}, nil
+				},
+			},
+			"chirp": {
+				Type: chirpType,
+				Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					id, err := parseID(p.Args["id"], "id")
+					if err != nil {
+						return nil, err
+					}
+					s := session(p.Context)
+					chirp, author, err := s.svc.VisibleChirp(p.Context, id, s.viewerID())
+					if err == nil {
+						s.users.Prime(author.ID, author)
+					}
+					return orNotFound(chirp, err)
+				},
+			},
+			"chirps": {
+				Type: graphql.NewNonNull(graphql.NewList(graphql.NewNonNull(chirpType))),
+				Args: graphql.FieldConfigArgument{
+					"authorId": {Type: graphql.ID},
+					"sort":     {Type: sortOrder},
+				},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					var authorID uuid.UUID
+					if value, ok := p.Args["authorId"]; ok {
+						var err error
+						if authorID, err = parseID(value, "authorId"); err != nil {
+							return nil, err
+						}
+					}
+					s := session(p.Context)
+					order, _ := p.Args["sort"].(string)
+					return s.svc.ListChirps(p.Context, authorID, s.viewerID(), order)
+				},
+			},
+		},
+	})
+
+	mutation := graphql.NewObject(graphql.ObjectConfig{
+		Name: "Mutation",
+		Fields: graphql.Fields{
+			"createUser": {
+				Type: graphql.NewNonNull(userType),
+				Args: credentialArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					s := session(p.Context)
+					if err := s.limit(p.Context, "POST /api/users"); err != nil {
+						return nil, err
+					}
+					params := credentials(p.Args)
+					if err := validateArgs(params); err != nil {
+						return nil, err
+					}
+					return s.svc.SignUp(p.Context, params)
+				},
+			},
+			"login": {
+				Type: graphql.NewNonNull(authPayload),
+				Args: credentialArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					s := session(p.Context)
+					if err := s.limit(p.Context, "POST /api/login"); err != nil {
+						return nil, err
+					}
+					params := service.Login{Email: p.Args["email"].(string), Password: p.Args["password"].(string)}
+					if err := validateArgs(params); err != nil {
+						return nil, err
+					}
+					return s.svc.LogIn(p.Context, params)
+				},
+			},
+			"updateUser": {
+				Type: graphql.NewNonNull(userType),
+				Args: credentialArgs,
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					s := session(p.Context)
+					user, err := s.user(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					params := credentials(p.Args)
+					if err := validateArgs(params); err != nil {
+						return nil, err
+					}
+					return s.svc.UpdateCredentials(p.Context, user, params)
+				},
+			},
+			"createChirp": {
+				Type: graphql.NewNonNull(createChirpPayloadType),
+				Args: graphql.FieldConfigArgument{"body": {Type: graphql.NewNonNull(graphql.String)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					s := session(p.Context)
+					if err := s.limit(p.Context, "POST /api/chirps"); err != nil {
+						return nil, err
+					}
+					user, err := s.user(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					params := service.NewChirp{Body: p.Args["body"].(string)}
+					if err := validateArgs(params); err != nil {
+						return nil, err
+					}
+					chirp, err := s.svc.PostChirp(p.Context, user, params)
+					if err != nil {
+						return nil, err
+					}
+					return createChirpPayload{Chirp: chirp, Held: chirp.Status == service.ChirpHeld}, nil
+				},
+			},
+			"deleteChirp": {
+				Type: graphql.NewNonNull(graphql.Boolean),
+				Args: graphql.FieldConfigArgument{"id": {Type: graphql.NewNonNull(graphql.ID)}},
+				Resolve: func(p graphql.ResolveParams) (any, error) {
+					s := session(p.Context)
+					user, err := s.user(p.Context)
+					if err != nil {
+						return nil, err
+					}
+					id, err := parseID(p.Args["id"], "id")
+					if err != nil {
+						return nil, err
+					}
+					if err := s.svc.DeleteOwnChirp(p.Context, user, id, nil); err != nil {
+						return nil, err
+					}
+					return true, nil
+				},
+			},
+		},
+	})
+
+	schema, err := graphql.NewSchema(graphql.SchemaConfig{Query: query, Mutation: mutation})
+	if err != nil {
+		panic("handlers: invalid GraphQL schema: " + err.Error())
+	}
+	return schema
+})
@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+// listMultiplier is the number of items a list field is assumed to return
+// when pricing what is selected under it.
+const listMultiplier = 10
+
+// queryComplexity prices the most expensive operation in doc. Every field
+// costs 1 plus its selections, which count listMultiplier times under a
+// list. Nesting chirps under authors under chirps grows the cost
+// geometrically, which is what the limit is there to stop.
+func queryComplexity(schema *graphql.Schema, doc *ast.Document) int {
+	fragments := map[string]*ast.FragmentDefinition{}
+	for _, def := range doc.Definitions {
+		if fragment, ok := def.(*ast.FragmentDefinition); ok {
+			fragments[fragment.Name.Value] = fragment
+		}
+	}
+
+	worst := 0
+	for _, def := range doc.Definitions {
+		operation, ok := def.(*ast.OperationDefinition)
+		if !ok {
+			continue
+		}
+		var root *graphql.Object
+		switch operation.Operation {
+		case ast.OperationTypeQuery:
+			root = schema.QueryType()
+		case ast.OperationTypeMutation:
+			root = schema.MutationType()
+		}
+		c := complexity{fragments: fragments, visiting: map[string]bool{}}
+		worst = max(worst, c.selections(root, operation.SelectionSet))
+	}
+	return worst
+}
+
+type complexity struct {
+	fragments map[string]*ast.FragmentDefinition
+	visiting  map[string]bool
+}
+
+// selections prices set as selected on parent, which is nil when the type
+// isn't known, such as under introspection fields.
+func (c complexity) selections(parent *graphql.Object, set *ast.SelectionSet) int {
+	if set == nil {
+		return 0
+	}
+	cost := 0
+	for _, selection := range set.Selections {
+		switch s := selection.(type) {
+		case *ast.Field:
+			cost += c.field(parent, s)
+		case *ast.InlineFragment:
+			cost += c.selections(parent, s.SelectionSet)
+		case *ast.FragmentSpread:
+			name := s.Name.Value
+			fragment, ok := c.fragments[name]
+			if !ok || c.visiting[name] {
+				continue
+			}
+			c.visiting[name] = true
+			cost += c.selections(parent, fragment.SelectionSet)
+			delete(c.visiting, name)
+		}
+	}
+	return cost
+}
+
+func (c complexity) field(parent *graphql.Object, field *ast.Field) int {
+	var fieldType graphql.Type
+	if parent != nil {
+		if def, ok := parent.Fields()[field.Name.Value]; ok {
+			fieldType = def.Type
+		}
+	}
+
+	multiplier := 1
+	for {
+		if nonNull, ok := fieldType.(*graphql.NonNull); ok {
+			fieldType = nonNull.OfType
+		} else if list, ok := fieldType.(*graphql.List); ok {
+			multiplier *= listMultiplier
+			fieldType = list.OfType
+		} else {
+			break
+		}
+	}
+	object, _ := fieldType.(*graphql.Object)
+	return 1 + multiplier*c.selections(object, field.SelectionSet)
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+type moderationRuleResponse struct {
+	Id        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Kind      string    `json:"kind"`
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"`
+	Enabled   bool      `json:"enabled"`
+}
+
+type moderationRuleRequest struct {
+	Kind    string `json:"kind" validate:"oneof=word regex"`
+	Pattern string `json:"pattern" validate:"required,max=200"`
+	Action  string `json:"action" validate:"oneof=mask reject hold"`
+	Enabled *bool  `json:"enabled"`
+}
+
+type moderationHitResponse struct {
+	Id        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	RuleId    uuid.UUID `json:"rule_id"`
+	UserId    uuid.UUID `json:"user_id"`
+	Matched   string    `json:"matched"`
+	Action    string    `json:"action"`
+}
+
+// heldChirpResponse is a chirp in, or just out of, the review queue.
+type heldChirpResponse struct {
+	Id        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Body      string    `json:"body"`
+	UserId    uuid.UUID `json:"user_id"`
+	Status    string    `json:"status"`
+}
+
+func toHeldChirpResponse(chirp database.Chirp) heldChirpResponse {
+	return heldChirpResponse{
+		Id:        chirp.ID,
+		CreatedAt: chirp.CreatedAt,
+		UpdatedAt: chirp.UpdatedAt,
+		Body:      chirp.Body,
+		UserId:    chirp.UserID,
+		Status:    chirp.Status,
+	}
+}
+
+func toModerationRuleResponse(rule database.ModerationRule) moderationRuleResponse {
+	return moderationRuleResponse{
+		Id:        rule.ID,
+		CreatedAt: rule.CreatedAt,
+		UpdatedAt: rule.UpdatedAt,
+		Kind:      rule.Kind,
+		Pattern:   rule.Pattern,
+		Action:    rule.Action,
+		Enabled:   rule.Enabled,
+	}
+}
+
+// reloadModeration refreshes the cached rules after an admin change.
+func (cfg *ApiConfig) reloadModeration(r *http.Request) {
+	if err := cfg.Moderation.Reload(r.Context()); err != nil {
+		logging.FromContext(r.Context()).Error("reloading moderation rules", "err", err)
+	}
+}
+
+func decodeModerationRule(w http.ResponseWriter, r *http.Request) (moderationRuleRequest, bool) {
+	defer r.Body.Close()
+
+	params := moderationRuleRequest{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
+		return moderationRuleRequest{}, false
+	}
+
+	if params.Kind == "" {
+		params.Kind = moderation.KindWord
+	}
+	if params.Action == "" {
+		params.Action = moderation.ActionMask
+	}
+
+	if err := moderation.Validate(params.Kind, params.Pattern, params.Action); err != nil {
+		utils.RespondWithError(w, r, utils.NewError(http.StatusBadRequest, utils.CodeValidationFailed, err.Error()))
+		return moderationRuleRequest{}, false
+	}
+
+	return params, true
+}
+
+func (cfg *ApiConfig) HandleListModerationRules(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleAdmin); !ok {
+		return
+	}
+
+	rules, err := cfg.Db.ListModerationRules(r.Context())
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error fetching moderation rules", err))
+		return
+	}
+
+	result := []moderationRuleResponse{}
+	for _, rule := range rules {
+		result = append(result, toModerationRuleResponse(rule))
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, result)
+}
+
+func (cfg *ApiConfig) HandleCreateModerationRule(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleAdmin); !ok {
+		return
+	}
+
+	params, ok := decodeModerationRule(w, r)
+	if !ok {
+		return
+	}
+
+	enabled := true
+	if params.Enabled != nil {
+		enabled = *params.Enabled
+	}
+
+	rule, err := cfg.Db.CreateModerationRule(r.Context(), database.CreateModerationRuleParams{
+		ID:      uuid.New(),
+		Kind:    params.Kind,
+		Pattern: params.Pattern,
+		Action:  params.Action,
+		Enabled: enabled,
+	})
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error creating moderation rule", err))
+		return
+	}
+
+	cfg.reloadModeration(r)
+	utils.RespondWithJSONHelper(w, r, 201, toModerationRuleResponse(rule))
+}
+
+func (cfg *ApiConfig) HandleUpdateModerationRule(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleAdmin); !ok {
+		return
+	}
+
+	ruleID, err := uuid.Parse(r.PathValue("ruleID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid rule ID format"))
+		return
+	}
+
+	existing, err := cfg.Db.GetModerationRuleByID(r.Context(), ruleID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.LookupError(err, "Moderation rule not found"))
+		return
+	}
+
+	params, ok := decodeModerationRule(w, r)
+	if !ok {
+		return
+	}
+
+	enabled := existing.Enabled
+	if params.Enabled != nil {
+		enabled = *params.Enabled
+	}
+
+	rule, err := cfg.Db.UpdateModerationRule(r.Context(), database.UpdateModerationRuleParams{
+		ID:      ruleID,
+		Kind:    params.Kind,
+		Pattern: params.Pattern,
+		Action:  params.Action,
+		Enabled: enabled,
+	})
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error updating moderation rule", err))
+		return
+	}
+
+	cfg.reloadModeration(r)
+	utils.RespondWithJSONHelper(w, r, 200, toModerationRuleResponse(rule))
+}
+
+func (cfg *ApiConfig) HandleDeleteModerationRule(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleAdmin); !ok {
+		return
+	}
+
+	ruleID, err := uuid.Parse(r.PathValue("ruleID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid rule ID format"))
+		return
+	}
+
+	err = cfg.Db.DeleteModerationRule(r.Context(), ruleID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Unable to remove moderation rule", err))
+		return
+	}
+
+	cfg.reloadModeration(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *ApiConfig) HandleGetModerationHits(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleAdmin); !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid chirp ID format"))
+		return
+	}
+
+	hits, err := cfg.Db.GetModerationHitsByChirpID(r.Context(), uuid.NullUUID{UUID: chirpID, Valid: true})
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error fetching moderation hits", err))
+		return
+	}
+
+	result := []moderationHitResponse{}
+	for _, hit := range hits {
+		result = append(result, moderationHitResponse{
+			Id:        hit.ID,
+			CreatedAt: hit.CreatedAt,
+			RuleId:    hit.RuleID,
+			UserId:    hit.UserID,
+			Matched:   hit.Matched,
+			Action:    hit.Action,
+		})
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, result)
+}
+
+func (cfg *ApiConfig) HandleListHeldChirps(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleModerator, auth.RoleAdmin); !ok {
+		return
+	}
+
+	chirps, err := cfg.Db.ListChirpsByStatus(r.Context(), service.ChirpHeld)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error fetching held chirps", err))
+		return
+	}
+
+	result := []heldChirpResponse{}
+	for _, chirp := range chirps {
+		result = append(result, toHeldChirpResponse(chirp))
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, result)
+}
+
+func (cfg *ApiConfig) HandleApproveChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.reviewHeldChirp(w, r, true)
+}
+
+func (cfg *ApiConfig) HandleRejectChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.reviewHeldChirp(w, r, false)
+}
+
+// reviewHeldChirp publishes or removes a held chirp and records who did it.
+func (cfg *ApiConfig) reviewHeldChirp(w http.ResponseWriter, r *http.Request, approve bool) {
+	moderator, ok := cfg.requireRole(w, r, auth.RoleModerator, auth.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid chirp ID format"))
+		return
+	}
+
+	chirp, err := cfg.svc().ReviewHeldChirp(r.Context(), chirpID, approve)
+	if err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
+
+	action := "reject_chirp"
+	if approve {
+		action = "approve_chirp"
+	}
+	cfg.writeAuditEntry(r, database.CreateModerationAuditEntryParams{
+		ModeratorID:  moderator.ID,
+		Action:       action,
+		ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+	})
+
+	utils.RespondWithJSONHelper(w, r, 200, toHeldChirpResponse(chirp))
+}
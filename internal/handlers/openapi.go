@@ -0,0 +1,329 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/k3vwdd/chirpyWS/internal/health"
+	"github.com/k3vwdd/chirpyWS/internal/openapi"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// Security requirements, named after the schemes in OpenAPI.
+const (
+	securityBearer  = "bearer"
+	securityRefresh = "refreshToken"
+	securityPolka   = "polkaApiKey"
+)
+
+type apiResponse struct {
+	status      int
+	description string
+	// body is encoded as JSON; nil means no body.
+	body any
+	// contentType replaces JSON for pages and plain text.
+	contentType string
+}
+
+type endpoint struct {
+	method   string
+	path     string
+	summary  string
+	tag      string
+	security string
+	query    []openapi.Parameter
+	headers  []openapi.Parameter
+	request  any
+	// responses lists the successful responses; every operation also gets
+	// a problem+json default.
+	responses []apiResponse
+	// versioned endpoints are served under every API version; their path
+	// is relative to the version prefix.
+	versioned bool
+	// v2, if set, replaces responses in v2.
+	v2 []apiResponse
+}
+
+func queryParam(name, description string, schema *openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+func headerParam(name, description string) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "header", Description: description, Schema: &openapi.Schema{Type: "string"}}
+}
+
+// endpoints describes every route in the same terms the handlers use:
+// the request and response values are the handlers' own types.
+func endpoints() []endpoint {
+	noContent := func(description string) []apiResponse {
+		return []apiResponse{{status: http.StatusNoContent, description: description}}
+	}
+	ok := func(body any) []apiResponse {
+		return []apiResponse{{status: http.StatusOK, description: "OK", body: body}}
+	}
+	// cached adds the 304 of a conditional GET to ok.
+	cached := func(body any) []apiResponse {
+		return append(ok(body), apiResponse{status: http.StatusNotModified, description: "The client's copy is current"})
+	}
+	conditionalGET := []openapi.Parameter{
+		headerParam("If-None-Match", "ETags of copies the client has"),
+		headerParam("If-Modified-Since", "Ignored if If-None-Match is sent"),
+	}
+	idempotent := []openapi.Parameter{
+		headerParam("Idempotency-Key", "Retries with the same key, body, Content-Type and Accept replay the first response; a different request gets 422"),
+	}
+
+	return []endpoint{
+		{method: "GET", path: "/", summary: "Static files", tag: "app",
+			responses: []apiResponse{{status: http.StatusOK, description: "A file", contentType: "text/html"}}},
+		{method: "GET", path: "/app/", summary: "Static files, counted as fileserver hits", tag: "app",
+			responses: []apiResponse{{status: http.StatusOK, description: "A file", contentType: "text/html"}}},
+
+		{method: "GET", path: "/api/healthz", summary: "Legacy health check", tag: "health",
+			responses: []apiResponse{{status: http.StatusOK, description: "Always OK", contentType: "text/plain"}}},
+		{method: "GET", path: "/api/livez", summary: "Liveness probe", tag: "health",
+			responses: ok(statusResponse{})},
+		{method: "GET", path: "/api/readyz", summary: "Readiness probe", tag: "health",
+			responses: []apiResponse{
+				{status: http.StatusOK, description: "Every check passed", body: health.Report{}},
+				{status: http.StatusServiceUnavailable, description: "A check failed", body: health.Report{}},
+			}},
+		{method: "GET", path: "/api/openapi.json", summary: "This document", tag: "docs",
+			responses: []apiResponse{{status: http.StatusOK, description: "OpenAPI 3.1 document", contentType: "application/json"}}},
+		{method: "GET", path: "/api/docs", summary: "Swagger UI", tag: "docs",
+			responses: []apiResponse{{status: http.StatusOK, description: "HTML page", contentType: "text/html"}}},
+		{method: "POST", path: "/api/graphql", summary: "Run a GraphQL query or mutation; send a bearer token for fields that need one", tag: "graphql",
+			request: graphQLRequest{}, responses: ok(graphQLResponse{})},
+
+		{method: "POST", path: "/users", versioned: true, summary: "Sign up", tag: "users",
+			headers:   idempotent,
+			request:   service.Credentials{},
+			responses: []apiResponse{{status: http.StatusCreated, description: "Created", body: userResponse{}}}},
+		{method: "PUT", path: "/users", versioned: true, summary: "Change email and password", tag: "users", security: securityBearer,
+			request: service.Credentials{}, responses: ok(userResponse{})},
+		{method: "GET", path: "/users/me/warnings", versioned: true, summary: "Warnings moderators gave you", tag: "users", security: securityBearer,
+			responses: ok([]warningResponse{})},
+		{method: "POST", path: "/login", versioned: true, summary: "Log in", tag: "auth",
+			request: service.Login{}, responses: ok(loginResponse{})},
+		{method: "POST", path: "/refresh", versioned: true, summary: "Exchange a refresh token for an access token", tag: "auth", security: securityRefresh,
+			responses: ok(refreshResponse{})},
+		{method: "POST", path: "/revoke", versioned: true, summary: "Revoke a refresh token", tag: "auth", security: securityRefresh,
+			responses: noContent("Revoked")},
+
+		{method: "GET", path: "/chirps", versioned: true, summary: "List chirps", tag: "chirps",
+			query: []openapi.Parameter{
+				queryParam("author_id", "Only chirps by this user", &openapi.Schema{Type: "string", Format: "uuid"}),
+				queryParam("sort", "Order by creation time", &openapi.Schema{Type: "string", Enum: []string{"asc", "desc"}}),
+			},
+			headers:   conditionalGET[:1],
+			responses: cached([]chirpResponse{}),
+			v2:        cached([]chirpV2Response{})},
+		{method: "POST", path: "/chirps", versioned: true, summary: "Post a chirp", tag: "chirps", security: securityBearer,
+			headers: idempotent,
+			request: service.NewChirp{},
+			responses: []apiResponse{
+				{status: http.StatusCreated, description: "Published", body: createdChirpResponse{}},
+				{status: http.StatusAccepted, description: "Held for moderation", body: createdChirpResponse{}},
+			}},
+		{method: "GET", path: "/chirps/{chirpID}", versioned: true, summary: "Get a chirp", tag: "chirps",
+			headers: conditionalGET, responses: cached(chirpResponse{}), v2: cached(chirpV2Response{})},
+		{method: "DELETE", path: "/chirps/{chirpID}", versioned: true, summary: "Delete your chirp", tag: "chirps", security: securityBearer,
+			headers:   []openapi.Parameter{headerParam("If-Match", "Only delete the chirp if its ETag is still this; 412 otherwise")},
+			responses: noContent("Deleted")},
+		{method: "POST", path: "/chirps/{chirpID}/report", versioned: true, summary: "Report a chirp", tag: "moderation", security: securityBearer,
+			request:   reportChirpRequest{},
+			responses: []apiResponse{{status: http.StatusCreated, description: "Reported", body: reportResponse{}}}},
+
+		{method: "POST", path: "/polka/webhooks", versioned: true, summary: "Polka payment events", tag: "webhooks", security: securityPolka,
+			headers: idempotent, request: polkaWebhookRequest{}, responses: noContent("Handled or ignored")},
+
+		{method: "GET", path: "/admin/metrics", summary: "Metrics page", tag: "admin",
+			responses: []apiResponse{{status: http.StatusOK, description: "HTML page", contentType: "text/html"}}},
+		{method: "GET", path: "/metrics", summary: "Prometheus metrics", tag: "admin",
+			responses: []apiResponse{{status: http.StatusOK, description: "Prometheus text format", contentType: "text/plain"}}},
+		{method: "POST", path: "/admin/reset", summary: "Delete every user (dev only)", tag: "admin",
+			responses: ok("")},
+
+		{method: "GET", path: "/admin/moderation/rules", summary: "List moderation rules", tag: "moderation", security: securityBearer,
+			responses: ok([]moderationRuleResponse{})},
+		{method: "POST", path: "/admin/moderation/rules", summary: "Create a moderation rule", tag: "moderation", security: securityBearer,
+			request:   moderationRuleRequest{},
+			responses: []apiResponse{{status: http.StatusCreated, description: "Created", body: moderationRuleResponse{}}}},
+		{method: "PUT", path: "/admin/moderation/rules/{ruleID}", summary: "Replace a moderation rule", tag: "moderation", security: securityBearer,
+			request: moderationRuleRequest{}, responses: ok(moderationRuleResponse{})},
+		{method: "DELETE", path: "/admin/moderation/rules/{ruleID}", summary: "Delete a moderation rule", tag: "moderation", security: securityBearer,
+			responses: noContent("Deleted")},
+		{method: "GET", path: "/admin/moderation/chirps/{chirpID}/hits", summary: "Rule hits for a chirp", tag: "moderation", security: securityBearer,
+			responses: ok([]moderationHitResponse{})},
+		{method: "GET", path: "/admin/moderation/held", summary: "Chirps held for review, oldest first", tag: "moderation", security: securityBearer,
+			responses: ok([]heldChirpResponse{})},
+		{method: "POST", path: "/admin/moderation/chirps/{chirpID}/approve", summary: "Publish a held chirp", tag: "moderation", security: securityBearer,
+			responses: ok(heldChirpResponse{})},
+		{method: "POST", path: "/admin/moderation/chirps/{chirpID}/reject", summary: "Remove a held chirp", tag: "moderation", security: securityBearer,
+			responses: ok(heldChirpResponse{})},
+		{method: "GET", path: "/admin/moderation/audit", summary: "Moderator audit log, newest first", tag: "moderation", security: securityBearer,
+			query:     []openapi.Parameter{queryParam("limit", "At most this many entries", &openapi.Schema{Type: "integer", Minimum: intPtr(1), Maximum: intPtr(1000)})},
+			responses: ok([]auditEntryResponse{})},
+		{method: "GET", path: "/admin/reports", summary: "Report queue", tag: "moderation", security: securityBearer,
+			query:     []openapi.Parameter{queryParam("status", "Defaults to open", &openapi.Schema{Type: "string", Enum: []string{"open", "claimed", "resolved"}})},
+			responses: ok([]reportQueueItem{})},
+		{method: "POST", path: "/admin/reports/{reportID}/claim", summary: "Claim an open report", tag: "moderation", security: securityBearer,
+			responses: ok(reportResponse{})},
+		{method: "POST", path: "/admin/reports/{reportID}/resolve", summary: "Resolve a report and the chirp's other open reports", tag: "moderation", security: securityBearer,
+			request: resolveReportRequest{}, responses: ok(reportResponse{})},
+		{method: "POST", path: "/admin/users/{userID}/suspend", summary: "Suspend a user", tag: "admin", security: securityBearer,
+			request: suspendUserRequest{}, responses: ok(userEnforcementResponse{})},
+		{method: "POST", path: "/admin/users/{userID}/unsuspend", summary: "Lift a suspension", tag: "admin", security: securityBearer,
+			responses: ok(userEnforcementResponse{})},
+		{method: "POST", path: "/admin/users/{userID}/shadow-ban", summary: "Set or lift a shadow ban", tag: "admin", security: securityBearer,
+			request: shadowBanRequest{}, responses: ok(userEnforcementResponse{})},
+	}
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// OpenAPI returns the API description served at /api/openapi.json.
+func OpenAPI() openapi.Document {
+	b := openapi.New(openapi.Info{
+		Title:   "Chirpy",
+		Version: "2.0.0",
+		Description: "Errors are RFC 7807 application/problem+json documents with a stable code. " +
+			"/api and /api/v1 are deprecated aliases of each other; use /api/v2.",
+	})
+	b.SecurityScheme(securityBearer, openapi.SecurityScheme{Type: "http", Scheme: "bearer", BearerFormat: "JWT"})
+	b.SecurityScheme(securityRefresh, openapi.SecurityScheme{Type: "http", Scheme: "bearer",
+		Description: "A refresh token from /api/login"})
+	b.SecurityScheme(securityPolka, openapi.SecurityScheme{Type: "apiKey", In: "header", Name: "Authorization",
+		Description: `"ApiKey <key>"`})
+
+	problem := map[string]openapi.MediaType{"application/problem+json": {Schema: b.Schema(utils.Problem{}, openapi.Output)}}
+
+	for _, e := range endpoints() {
+		if !e.versioned {
+			addOperation(b, e, e.path, e.responses, problem, false)
+			continue
+		}
+		for _, v := range APIPrefixes {
+			responses := e.responses
+			if v.Version == APIv2 && e.v2 != nil {
+				responses = e.v2
+			}
+			addOperation(b, e, v.Prefix+e.path, responses, problem, v.Version == APIv1)
+		}
+	}
+	return b.Document()
+}
+
+func addOperation(b *openapi.Builder, e endpoint, path string, responses []apiResponse, problem map[string]openapi.MediaType, deprecated bool) {
+	op := &openapi.Operation{
+		OperationID: operationID(e.method, path),
+		Summary:     e.summary,
+		Tags:        []string{e.tag},
+		Parameters:  append(append(pathParams(path), e.query...), e.headers...),
+		Responses:   map[string]openapi.Response{"default": {Description: "Error", Content: problem}},
+		Deprecated:  deprecated,
+	}
+	if e.security != "" {
+		op.Security = []map[string][]string{{e.security: {}}}
+	}
+	if e.request != nil {
+		op.RequestBody = &openapi.RequestBody{Required: true, Content: b.JSON(e.request, openapi.Input)}
+	}
+	for _, resp := range responses {
+		response := openapi.Response{Description: resp.description}
+		switch {
+		case resp.contentType != "":
+			response.Content = map[string]openapi.MediaType{resp.contentType: {Schema: &openapi.Schema{Type: "string"}}}
+		case resp.body != nil:
+			response.Content = responseContent(b, resp.body)
+		}
+		op.Responses[strconv.Itoa(resp.status)] = response
+	}
+	b.Add(e.method, path, op)
+}
+
+// responseContent documents body in every format RespondWithJSONHelper
+// negotiates. They all carry the JSON document, and lists can also stream
+// as NDJSON, one item per line.
+func responseContent(b *openapi.Builder, body any) map[string]openapi.MediaType {
+	content := b.JSON(body, openapi.Output)
+	schema := content[utils.MediaJSON].Schema
+	content[utils.MediaMsgPack] = openapi.MediaType{Schema: schema}
+	content[utils.MediaCBOR] = openapi.MediaType{Schema: schema}
+	if schema.Type == "array" {
+		content[utils.MediaNDJSON] = openapi.MediaType{Schema: schema.Items}
+	}
+	return content
+}
+
+// pathParams declares the {name} segments of path; every one is an ID.
+func pathParams(path string) []openapi.Parameter {
+	var params []openapi.Parameter
+	for _, segment := range strings.Split(path, "/") {
+		if name, ok := strings.CutPrefix(segment, "{"); ok {
+			params = append(params, openapi.Parameter{
+				Name:     strings.TrimSuffix(name, "}"),
+				In:       "path",
+				Required: true,
+				Schema:   &openapi.Schema{Type: "string", Format: "uuid"},
+			})
+		}
+	}
+	return params
+}
+
+// operationID turns "POST /api/chirps/{chirpID}/report" into
+// "postApiChirpsChirpIDReport".
+func operationID(method, path string) string {
+	var id strings.Builder
+	id.WriteString(strings.ToLower(method))
+	for _, part := range strings.FieldsFunc(path, func(r rune) bool {
+		return r == '/' || r == '{' || r == '}' || r == '-' || r == '.'
+	}) {
+		id.WriteString(strings.ToUpper(part[:1]) + part[1:])
+	}
+	return id.String()
+}
+
+var openAPIJSON = sync.OnceValues(func() ([]byte, error) {
+	return json.Marshal(OpenAPI())
+})
+
+func (cfg *ApiConfig) HandleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	spec, err := openAPIJSON()
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Unable to encode the API description", err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(spec)
+}
+
+// swaggerUIPage loads Swagger UI from a CDN rather than vendoring it.
+const swaggerUIPage = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Chirpy API</title>
+<link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+<div id="swagger-ui"></div>
+<script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js"></script>
+<script>
+window.ui = SwaggerUIBundle({ url: "/api/openapi.json", dom_id: "#swagger-ui" });
+</script>
+</body>
+</html>
+`
+
+func (cfg *ApiConfig) HandleSwaggerUI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(swaggerUIPage))
+}
@@ -0,0 +1,458 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+const (
+	resolutionDismiss     = "dismiss"
+	resolutionRemoveChirp = "remove_chirp"
+	resolutionWarnUser    = "warn_user"
+	resolutionSuspendUser = "suspend_user"
+
+	defaultSuspendHours = 7 * 24
+)
+
+type reportResponse struct {
+	Id         uuid.UUID  `json:"id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ChirpId    uuid.UUID  `json:"chirp_id"`
+	ReporterId uuid.UUID  `json:"reporter_id"`
+	Reason     string     `json:"reason"`
+	Details    string     `json:"details"`
+	Status     string     `json:"status"`
+	ClaimedBy  *uuid.UUID `json:"claimed_by"`
+}
+
+type reportChirpRequest struct {
+	Reason  string `json:"reason" validate:"required,oneof=spam harassment hate_speech violence sexual_content misinformation other"`
+	Details string `json:"details" validate:"max=1000"`
+}
+
+type reportQueueItem struct {
+	reportResponse
+	ChirpBody     string    `json:"chirp_body"`
+	ChirpAuthorId uuid.UUID `json:"chirp_author_id"`
+	ChirpStatus   string    `json:"chirp_status"`
+}
+
+type resolveReportRequest struct {
+	Action       string `json:"action" validate:"required,oneof=dismiss remove_chirp warn_user suspend_user"`
+	Note         string `json:"note" validate:"max=500"`
+	SuspendHours int    `json:"suspend_hours" validate:"min=0,max=87600"`
+}
+
+type warningResponse struct {
+	Id        uuid.UUID  `json:"id"`
+	CreatedAt time.Time  `json:"created_at"`
+	ChirpId   *uuid.UUID `json:"chirp_id"`
+	Reason    string     `json:"reason"`
+	Note      string     `json:"note"`
+}
+
+type auditEntryResponse struct {
+	Id           uuid.UUID  `json:"id"`
+	CreatedAt    time.Time  `json:"created_at"`
+	ModeratorId  uuid.UUID  `json:"moderator_id"`
+	Action       string     `json:"action"`
+	ReportId     *uuid.UUID `json:"report_id"`
+	ChirpId      *uuid.UUID `json:"chirp_id"`
+	TargetUserId *uuid.UUID `json:"target_user_id"`
+	Note         string     `json:"note"`
+}
+
+func toReportResponse(report database.Report) reportResponse {
+	response := reportResponse{
+		Id:         report.ID,
+		CreatedAt:  report.CreatedAt,
+		ChirpId:    report.ChirpID,
+		ReporterId: report.ReporterID,
+		Reason:     report.Reason,
+		Details:    report.Details,
+		Status:     report.Status,
+	}
+	if report.ClaimedBy.Valid {
+		response.ClaimedBy = &report.ClaimedBy.UUID
+	}
+	return response
+}
+
+// writeAuditEntry records a moderator action. Like rule hits, a failure here
+// is logged but doesn't undo the action itself.
+func (cfg *ApiConfig) writeAuditEntry(r *http.Request, params database.CreateModerationAuditEntryParams) {
+	params.ID = uuid.New()
+	err := cfg.Db.CreateModerationAuditEntry(r.Context(), params)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("writing moderation audit entry", "action", params.Action, "err", err)
+	}
+}
+
+func (cfg *ApiConfig) HandleReportChirp(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	user, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+	userID := user.ID
+
+	chirpID, err := uuid.Parse(r.PathValue("chirpID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid chirp ID format"))
+		return
+	}
+
+	chirp, err := cfg.Db.GetChirpByID(r.Context(), chirpID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.LookupError(err, "Chirp not found"))
+		return
+	}
+	if chirp.Status == service.ChirpRemoved {
+		utils.RespondWithError(w, r, utils.NotFound("Chirp not found"))
+		return
+	}
+
+	params := reportChirpRequest{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
+
+	report, err := cfg.Db.CreateReport(r.Context(), database.CreateReportParams{
+		ID:         uuid.New(),
+		ChirpID:    chirp.ID,
+		ReporterID: userID,
+		Reason:     params.Reason,
+		Details:    params.Details,
+	})
+	if err != nil {
+		if database.IsUniqueViolation(err) {
+			utils.RespondWithError(w, r, utils.Conflict("You have already reported this chirp"))
+			return
+		}
+		utils.RespondWithError(w, r, utils.Internal("Error creating report", err))
+		return
+	}
+
+	count, err := cfg.Db.CountUnresolvedReportsForChirp(r.Context(), chirp.ID)
+	if err != nil {
+		logging.FromContext(r.Context()).Error("counting reports", "chirp_id", chirp.ID, "err", err)
+	} else if chirp.Status == service.ChirpPublished && count >= int64(cfg.ReportHideThreshold) {
+		err = cfg.Db.UpdateChirpStatus(r.Context(), database.UpdateChirpStatusParams{
+			ID:     chirp.ID,
+			Status: service.ChirpHidden,
+		})
+		if err != nil {
+			logging.FromContext(r.Context()).Error("hiding reported chirp", "chirp_id", chirp.ID, "err", err)
+		}
+	}
+
+	utils.RespondWithJSONHelper(w, r, 201, toReportResponse(report))
+}
+
+// HandleListWarnings shows the caller the warnings moderators gave them by
+// resolving reports with warn_user.
+func (cfg *ApiConfig) HandleListWarnings(w http.ResponseWriter, r *http.Request) {
+	user, ok := cfg.authenticate(w, r)
+	if !ok {
+		return
+	}
+
+	warnings, err := cfg.Db.ListUserWarnings(r.Context(), user.ID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error fetching warnings", err))
+		return
+	}
+
+	result := []warningResponse{}
+	for _, warning := range warnings {
+		response := warningResponse{
+			Id:        warning.ID,
+			CreatedAt: warning.CreatedAt,
+			Reason:    warning.Reason,
+			Note:      warning.Note,
+		}
+		if warning.ChirpID.Valid {
+			response.ChirpId = &warning.ChirpID.UUID
+		}
+		result = append(result, response)
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, result)
+}
+
+func (cfg *ApiConfig) HandleListReports(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleModerator, auth.RoleAdmin); !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = "open"
+	}
+	if status != "open" && status != "claimed" && status != "resolved" {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid status filter"))
+		return
+	}
+
+	reports, err := cfg.Db.ListReportsByStatus(r.Context(), status)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error fetching reports", err))
+		return
+	}
+
+	result := []reportQueueItem{}
+	for _, report := range reports {
+		result = append(result, reportQueueItem{
+			reportResponse: toReportResponse(database.Report{
+				ID:         report.ID,
+				CreatedAt:  report.CreatedAt,
+				ChirpID:    report.ChirpID,
+				ReporterID: report.ReporterID,
+				Reason:     report.Reason,
+				Details:    report.Details,
+				Status:     report.Status,
+				ClaimedBy:  report.ClaimedBy,
+			}),
+			ChirpBody:     report.ChirpBody,
+			ChirpAuthorId: report.ChirpAuthorID,
+			ChirpStatus:   report.ChirpStatus,
+		})
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, result)
+}
+
+func (cfg *ApiConfig) HandleClaimReport(w http.ResponseWriter, r *http.Request) {
+	moderator, ok := cfg.requireRole(w, r, auth.RoleModerator, auth.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid report ID format"))
+		return
+	}
+
+	report, err := cfg.Db.ClaimReport(r.Context(), database.ClaimReportParams{
+		ID:        reportID,
+		ClaimedBy: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		if _, err := cfg.Db.GetReportByID(r.Context(), reportID); err != nil {
+			utils.RespondWithError(w, r, utils.LookupError(err, "Report not found"))
+			return
+		}
+		utils.RespondWithError(w, r, utils.Conflict("Report is not open"))
+		return
+	}
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error claiming report", err))
+		return
+	}
+
+	cfg.writeAuditEntry(r, database.CreateModerationAuditEntryParams{
+		ModeratorID: moderator.ID,
+		Action:      "claim",
+		ReportID:    uuid.NullUUID{UUID: report.ID, Valid: true},
+		ChirpID:     uuid.NullUUID{UUID: report.ChirpID, Valid: true},
+	})
+
+	utils.RespondWithJSONHelper(w, r, 200, toReportResponse(report))
+}
+
+// HandleResolveReport closes the report, and every other report on the chirp
+// that is still open or claimed by this moderator, with one action. Only
+// remove_chirp takes the chirp down; the other actions put a chirp that was
+// auto-hidden by reports back in the public feed. warn_user records a warning
+// the author can read at /users/me/warnings. The report, the action and the
+// chirp status change in one transaction.
+func (cfg *ApiConfig) HandleResolveReport(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	moderator, ok := cfg.requireRole(w, r, auth.RoleModerator, auth.RoleAdmin)
+	if !ok {
+		return
+	}
+
+	reportID, err := uuid.Parse(r.PathValue("reportID"))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.BadRequest("Invalid report ID format"))
+		return
+	}
+
+	params := resolveReportRequest{}
+	if err := utils.DecodeJSON(w, r, &params); err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
+
+	report, err := cfg.Db.GetReportByID(r.Context(), reportID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.LookupError(err, "Report not found"))
+		return
+	}
+
+	if report.Status == "resolved" {
+		utils.RespondWithError(w, r, utils.Conflict("Report is already resolved"))
+		return
+	}
+
+	if report.ClaimedBy.Valid && report.ClaimedBy.UUID != moderator.ID && moderator.Role != auth.RoleAdmin {
+		utils.RespondWithError(w, r, utils.Conflict("Report is claimed by another moderator"))
+		return
+	}
+
+	chirp, err := cfg.Db.GetChirpByID(r.Context(), report.ChirpID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.LookupError(err, "Chirp not found"))
+		return
+	}
+
+	resolvedBy := uuid.NullUUID{UUID: moderator.ID, Valid: true}
+	resolution := sql.NullString{String: params.Action, Valid: true}
+	err = cfg.Db.InTx(r.Context(), func(q database.Store) error {
+		resolved, err := q.ResolveReport(r.Context(), database.ResolveReportParams{
+			ResolvedBy:    resolvedBy,
+			Resolution:    resolution,
+			ID:            report.ID,
+			OverrideClaim: moderator.Role == auth.RoleAdmin,
+		})
+		if err != nil {
+			return utils.Internal("Error resolving report", err)
+		}
+		if resolved == 0 {
+			return utils.Conflict("Report was resolved or claimed by another moderator")
+		}
+
+		switch params.Action {
+		case resolutionRemoveChirp:
+			err = q.UpdateChirpStatus(r.Context(), database.UpdateChirpStatusParams{
+				ID:     chirp.ID,
+				Status: service.ChirpRemoved,
+			})
+		case resolutionWarnUser:
+			_, err = q.CreateUserWarning(r.Context(), database.CreateUserWarningParams{
+				ID:      uuid.New(),
+				UserID:  chirp.UserID,
+				ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+				Reason:  report.Reason,
+				Note:    params.Note,
+			})
+		case resolutionSuspendUser:
+			hours := params.SuspendHours
+			if hours <= 0 {
+				hours = defaultSuspendHours
+			}
+			err = q.SuspendUser(r.Context(), database.SuspendUserParams{
+				ID:             chirp.UserID,
+				SuspendedUntil: sql.NullTime{Time: time.Now().Add(time.Duration(hours) * time.Hour), Valid: true},
+			})
+			if params.Note == "" {
+				params.Note = "suspended for " + strconv.Itoa(hours) + " hours"
+			}
+		}
+		if err != nil {
+			return utils.Internal("Error applying resolution", err)
+		}
+
+		if params.Action != resolutionRemoveChirp {
+			_, err = q.TransitionChirpStatus(r.Context(), database.TransitionChirpStatusParams{
+				NewStatus: service.ChirpPublished,
+				ID:        chirp.ID,
+				OldStatus: service.ChirpHidden,
+			})
+			if err != nil {
+				return utils.Internal("Error restoring chirp", err)
+			}
+		}
+
+		err = q.ResolveReportsForChirp(r.Context(), database.ResolveReportsForChirpParams{
+			ChirpID:    chirp.ID,
+			ResolvedBy: resolvedBy,
+			Resolution: resolution,
+		})
+		if err != nil {
+			return utils.Internal("Error resolving reports", err)
+		}
+		return nil
+	})
+	if err != nil {
+		utils.RespondWithError(w, r, err)
+		return
+	}
+
+	cfg.writeAuditEntry(r, database.CreateModerationAuditEntryParams{
+		ModeratorID:  moderator.ID,
+		Action:       params.Action,
+		ReportID:     uuid.NullUUID{UUID: report.ID, Valid: true},
+		ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		Note:         params.Note,
+	})
+
+	report, err = cfg.Db.GetReportByID(r.Context(), reportID)
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Unable to fetch resolved report", err))
+		return
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, toReportResponse(report))
+}
+
+func (cfg *ApiConfig) HandleListModerationAudit(w http.ResponseWriter, r *http.Request) {
+	if _, ok := cfg.requireRole(w, r, auth.RoleAdmin); !ok {
+		return
+	}
+
+	limit := 100
+	if limitParam := r.URL.Query().Get("limit"); limitParam != "" {
+		parsed, err := strconv.Atoi(limitParam)
+		if err != nil || parsed <= 0 || parsed > 1000 {
+			utils.RespondWithError(w, r, utils.BadRequest("Invalid limit"))
+			return
+		}
+		limit = parsed
+	}
+
+	entries, err := cfg.Db.ListModerationAuditEntries(r.Context(), int32(limit))
+	if err != nil {
+		utils.RespondWithError(w, r, utils.Internal("Error fetching audit log", err))
+		return
+	}
+
+	nullable := func(id uuid.NullUUID) *uuid.UUID {
+		if !id.Valid {
+			return nil
+		}
+		return &id.UUID
+	}
+
+	result := []auditEntryResponse{}
+	for _, entry := range entries {
+		result = append(result, auditEntryResponse{
+			Id:           entry.ID,
+			CreatedAt:    entry.CreatedAt,
+			ModeratorId:  entry.ModeratorID,
+			Action:       entry.Action,
+			ReportId:     nullable(entry.ReportID),
+			ChirpId:      nullable(entry.ChirpID),
+			TargetUserId: nullable(entry.TargetUserID),
+			Note:         entry.Note,
+		})
+	}
+
+	utils.RespondWithJSONHelper(w, r, 200, result)
+}
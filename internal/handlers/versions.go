@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// APIVersion selects the response shapes a route serves. Handlers write
+// the same data in every version; the functions below map it to each
+// version's shape.
+type APIVersion int
+
+const (
+	APIv1 APIVersion = 1
+	APIv2 APIVersion = 2
+)
+
+// V1 is deprecated and will be removed at V1Sunset.
+var (
+	V1Deprecated = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+	V1Sunset     = time.Date(2027, time.April, 19, 0, 0, 0, 0, time.UTC)
+)
+
+const (
+	// UnversionedPrefix serves v1, as it did before versioning.
+	UnversionedPrefix = "/api"
+	V1Prefix          = "/api/v1"
+	V2Prefix          = "/api/v2"
+)
+
+type APIPrefix struct {
+	Prefix  string
+	Version APIVersion
+}
+
+// APIPrefixes lists where the versioned routes are served.
+var APIPrefixes = []APIPrefix{
+	{UnversionedPrefix, APIv1},
+	{V1Prefix, APIv1},
+	{V2Prefix, APIv2},
+}
+
+type apiVersionKey struct{}
+
+// Versioned serves next as version v of the API under prefix. V1 responses
+// carry Deprecation (RFC 9745) and Sunset (RFC 8594) headers and link to
+// the same resource in v2.
+func Versioned(v APIVersion, prefix string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v == APIv1 {
+			successor := V2Prefix + strings.TrimPrefix(r.URL.Path, prefix)
+			w.Header().Set("Deprecation", "@"+strconv.FormatInt(V1Deprecated.Unix(), 10))
+			w.Header().Set("Sunset", V1Sunset.Format(http.TimeFormat))
+			w.Header().Set("Link", "<"+successor+`>; rel="successor-version"`)
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), apiVersionKey{}, v)))
+	})
+}
+
+// apiVersion is the version r was routed to. Routes outside the versioned
+// API count as v1.
+func apiVersion(r *http.Request) APIVersion {
+	if v, ok := r.Context().Value(apiVersionKey{}).(APIVersion); ok {
+		return v
+	}
+	return APIv1
+}
+
+// chirpV2Response is a chirp with its author's Chirpy Red status, which v1
+// only sent back to the author of a new chirp.
+type chirpV2Response struct {
+	chirpResponse
+	IsChirpyRed bool `json:"is_chirpy_red"`
+}
+
+func toChirpV2Response(chirp database.Chirp, author database.User) chirpV2Response {
+	return chirpV2Response{chirpResponse: toChirpResponse(chirp), IsChirpyRed: author.IsChirpyRed}
+}
+
+// chirpETag is a chirp's strong validator: its id and updated_at, plus, in
+// v2, the author's Chirpy Red status that the response also carries.
+func chirpETag(r *http.Request, chirp database.Chirp, author database.User) string {
+	return utils.StrongETag(chirpValidator(r, chirp, author)...)
+}
+
+func chirpValidator(r *http.Request, chirp database.Chirp, author database.User) []string {
+	parts := []string{chirp.ID.String(), chirp.UpdatedAt.UTC().Format(time.RFC3339Nano)}
+	if apiVersion(r) != APIv1 {
+		parts = append(parts, strconv.FormatBool(author.IsChirpyRed))
+	}
+	return parts
+}
+
+// notModified sets the validators of a chirp response and answers a
+// conditional GET with 304. What a viewer sees depends on who they are,
+// so responses are private, and clients must revalidate before reuse.
+// list says whether the response is a list of chirps.
+func notModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time, list bool) bool {
+	w.Header().Set("Cache-Control", "private, no-cache")
+	return utils.NotModified(w, r, etag, lastModified, list)
+}
+
+// respondChirp writes one chirp in the request's version. author may be
+// the zero User for v1, which doesn't need it.
+func respondChirp(w http.ResponseWriter, r *http.Request, chirp database.Chirp, author database.User) {
+	if notModified(w, r, chirpETag(r, chirp, author), chirp.UpdatedAt, false) {
+		return
+	}
+	if apiVersion(r) == APIv1 {
+		utils.RespondWithJSONHelper(w, r, http.StatusOK, toChirpResponse(chirp))
+		return
+	}
+	utils.RespondWithJSONHelper(w, r, http.StatusOK, toChirpV2Response(chirp, author))
+}
+
+// respondChirps writes a list of chirps in the request's version, looking
+// up their authors in one query for v2. The list's weak ETag covers every
+// chirp's validator in order. It has no Last-Modified: a deleted chirp
+// changes the list without making it any newer.
+func (cfg *ApiConfig) respondChirps(w http.ResponseWriter, r *http.Request, chirps []database.Chirp) {
+	authors := map[uuid.UUID]database.User{}
+	if apiVersion(r) != APIv1 {
+		var err error
+		authors, err = cfg.svc().ChirpAuthors(r.Context(), chirps)
+		if err != nil {
+			utils.RespondWithError(w, r, err)
+			return
+		}
+	}
+
+	var parts []string
+	for _, chirp := range chirps {
+		parts = append(parts, chirpValidator(r, chirp, authors[chirp.UserID])...)
+	}
+	if notModified(w, r, utils.WeakETag(parts...), time.Time{}, true) {
+		return
+	}
+
+	if apiVersion(r) == APIv1 {
+		result := make([]chirpResponse, 0, len(chirps))
+		for _, chirp := range chirps {
+			result = append(result, toChirpResponse(chirp))
+		}
+		utils.RespondWithJSONHelper(w, r, http.StatusOK, result)
+		return
+	}
+	result := make([]chirpV2Response, 0, len(chirps))
+	for _, chirp := range chirps {
+		result = append(result, toChirpV2Response(chirp, authors[chirp.UserID]))
+	}
+	utils.RespondWithJSONHelper(w, r, http.StatusOK, result)
+}
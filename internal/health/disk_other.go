@@ -0,0 +1,9 @@
+//go:build !(linux || darwin || freebsd)
+
+package health
+
+import "errors"
+
+func freeBytes(dir string) (uint64, error) {
+	return 0, errors.New("free disk space is not available on this platform")
+}
@@ -0,0 +1,144 @@
+// Package health runs the readiness checks behind /api/readyz.
+package health
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// DefaultTimeout bounds a check registered without its own timeout.
+const DefaultTimeout = 2 * time.Second
+
+// CheckFunc reports a problem by returning an error. It must give up when
+// ctx is done.
+type CheckFunc func(ctx context.Context) error
+
+type check struct {
+	name    string
+	timeout time.Duration
+	run     CheckFunc
+}
+
+// Checker holds the registered readiness checks. The zero value has none
+// and is always ready.
+type Checker struct {
+	mu     sync.RWMutex
+	checks []check
+}
+
+// Register adds a check. A timeout of zero means DefaultTimeout.
+func (c *Checker) Register(name string, timeout time.Duration, run CheckFunc) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, check{name: name, timeout: timeout, run: run})
+}
+
+// Result is the outcome of one check.
+type Result struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMS float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+// Report is the outcome of every check, in registration order.
+type Report struct {
+	Status string   `json:"status"`
+	Checks []Result `json:"checks"`
+}
+
+// Ready reports whether every check passed.
+func (r Report) Ready() bool {
+	return r.Status == StatusOK
+}
+
+// Run runs every check concurrently, each under its own timeout.
+func (c *Checker) Run(ctx context.Context) Report {
+	c.mu.RLock()
+	checks := c.checks
+	c.mu.RUnlock()
+
+	report := Report{Status: StatusOK, Checks: make([]Result, len(checks))}
+	var wg sync.WaitGroup
+	for i, ch := range checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.Checks[i] = ch.execute(ctx)
+		}()
+	}
+	wg.Wait()
+
+	for _, result := range report.Checks {
+		if result.Status != StatusOK {
+			report.Status = StatusFail
+		}
+	}
+	return report
+}
+
+func (ch check) execute(ctx context.Context) Result {
+	ctx, cancel := context.WithTimeout(ctx, ch.timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				errc <- fmt.Errorf("panic: %v", p)
+			}
+		}()
+		errc <- ch.run(ctx)
+	}()
+
+	// A check that ignores ctx still can't hold up the probe.
+	var err error
+	select {
+	case err = <-errc:
+	case <-ctx.Done():
+		err = fmt.Errorf("timed out after %s", ch.timeout)
+	}
+
+	result := Result{
+		Name:      ch.name,
+		Status:    StatusOK,
+		LatencyMS: float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if err != nil {
+		result.Status = StatusFail
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// Ping checks that the database answers.
+func Ping(db *sql.DB) CheckFunc {
+	return db.PingContext
+}
+
+// DiskSpace checks that the file system holding dir has at least minFree
+// bytes available to unprivileged users.
+func DiskSpace(dir string, minFree uint64) CheckFunc {
+	return func(ctx context.Context) error {
+		free, err := freeBytes(dir)
+		if err != nil {
+			return err
+		}
+		if free < minFree {
+			return fmt.Errorf("%s has %d MiB free, need %d MiB", dir, free>>20, minFree>>20)
+		}
+		return nil
+	}
+}
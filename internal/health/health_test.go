@@ -0,0 +1,65 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestRun(t *testing.T) {
+	var c Checker
+	if report := c.Run(context.Background()); !report.Ready() || len(report.Checks) != 0 {
+		t.Fatalf("empty checker = %+v, want ready with no checks", report)
+	}
+
+	c.Register("ok", 0, func(ctx context.Context) error { return nil })
+	c.Register("broken", 0, func(ctx context.Context) error { return errors.New("connection refused") })
+	c.Register("slow", 20*time.Millisecond, func(ctx context.Context) error {
+		time.Sleep(time.Second) // ignores ctx on purpose
+		return nil
+	})
+	c.Register("panics", 0, func(ctx context.Context) error { panic("boom") })
+
+	start := time.Now()
+	report := c.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("Run took %s, want the slow check cut off at its timeout", elapsed)
+	}
+	if report.Ready() {
+		t.Error("report is ready despite failing checks")
+	}
+
+	want := []struct{ name, status, err string }{
+		{"ok", StatusOK, ""},
+		{"broken", StatusFail, "connection refused"},
+		{"slow", StatusFail, "timed out after 20ms"},
+		{"panics", StatusFail, "panic: boom"},
+	}
+	if len(report.Checks) != len(want) {
+		t.Fatalf("got %d results, want %d", len(report.Checks), len(want))
+	}
+	for i, w := range want {
+		got := report.Checks[i]
+		if got.Name != w.name || got.Status != w.status || got.Error != w.err {
+			t.Errorf("check %d = %+v, want %s %s %q", i, got, w.name, w.status, w.err)
+		}
+	}
+}
+
+func TestDiskSpace(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := freeBytes(dir); err != nil {
+		t.Skip(err)
+	}
+	if err := DiskSpace(dir, 1)(context.Background()); err != nil {
+		t.Errorf("1 byte free: %v", err)
+	}
+	if err := DiskSpace(dir, math.MaxUint64)(context.Background()); err == nil {
+		t.Error("no error for an impossible amount of free space")
+	}
+	if err := DiskSpace(dir+"/missing", 1)(context.Background()); err == nil {
+		t.Error("no error for a missing directory")
+	}
+}
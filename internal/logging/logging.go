@@ -0,0 +1,216 @@
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const redacted = "[REDACTED]"
+
+// RedactionPolicy lists the attribute and JSON field names whose values must
+// never reach the logs. Names are matched case-insensitively.
+type RedactionPolicy struct {
+	fields map[string]bool
+}
+
+// DefaultRedactedFields covers the credentials Chirpy handles today.
+var DefaultRedactedFields = []string{
+	"password",
+	"token",
+	"refresh_token",
+	"authorization",
+	"api_key",
+	"apikey",
+	"secret",
+}
+
+// NewRedactionPolicy builds a policy from DefaultRedactedFields plus extra.
+func NewRedactionPolicy(extra ...string) RedactionPolicy {
+	policy := RedactionPolicy{fields: map[string]bool{}}
+	for _, field := range append(DefaultRedactedFields, extra...) {
+		field = strings.ToLower(strings.TrimSpace(field))
+		if field != "" {
+			policy.fields[field] = true
+		}
+	}
+	return policy
+}
+
+func (p RedactionPolicy) Redacts(name string) bool {
+	return p.fields[strings.ToLower(name)]
+}
+
+// ReplaceAttr plugs the policy into a slog handler.
+func (p RedactionPolicy) ReplaceAttr(groups []string, a slog.Attr) slog.Attr {
+	if p.Redacts(a.Key) {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// RedactJSON decodes body and masks every field covered by the policy, at
+// any depth. Bodies that aren't JSON are summarised by their size only.
+func (p RedactionPolicy) RedactJSON(body []byte) any {
+	var value any
+	if err := json.Unmarshal(body, &value); err != nil {
+		return "<" + strconv.Itoa(len(body)) + " bytes>"
+	}
+	return p.redactValue(value)
+}
+
+func (p RedactionPolicy) redactValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, inner := range v {
+			if p.Redacts(key) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = p.redactValue(inner)
+		}
+		return v
+	case []any:
+		for i, inner := range v {
+			v[i] = p.redactValue(inner)
+		}
+		return v
+	}
+	return value
+}
+
+// New returns a JSON logger that applies policy to every record.
+func New(w io.Writer, level slog.Level, policy RedactionPolicy) *slog.Logger {
+	return slog.New(slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: policy.ReplaceAttr,
+	}))
+}
+
+// ParseLevel maps LOG_LEVEL style names to slog levels, defaulting to info.
+func ParseLevel(name string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(name)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type contextKey int
+
+const (
+	loggerKey contextKey = iota
+	requestKey
+)
+
+// RequestInfo is shared by everything handling one request. Handlers and
+// middleware fill in what they learn so the access log can report it.
+type RequestInfo struct {
+	ID string
+
+	mu      sync.Mutex
+	userID  uuid.UUID
+	route   string
+	traceID string
+}
+
+func (info *RequestInfo) UserID() uuid.UUID {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.userID
+}
+
+func (info *RequestInfo) Route() string {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.route
+}
+
+func (info *RequestInfo) TraceID() string {
+	info.mu.Lock()
+	defer info.mu.Unlock()
+	return info.traceID
+}
+
+// NewRequestID returns a random 128-bit hex id.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return uuid.NewString()
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRequest stores the request info and a logger tagged with its id.
+func WithRequest(ctx context.Context, logger *slog.Logger, info *RequestInfo) context.Context {
+	ctx = context.WithValue(ctx, requestKey, info)
+	return WithLogger(ctx, logger.With("request_id", info.ID))
+}
+
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// FromContext returns the request logger, or the default logger outside a request.
+func FromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+func RequestFromContext(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestKey).(*RequestInfo)
+	return info
+}
+
+// RequestID returns the id of the current request, or "" outside a request.
+func RequestID(ctx context.Context) string {
+	if info := RequestFromContext(ctx); info != nil {
+		return info.ID
+	}
+	return ""
+}
+
+// SetUserID records the authenticated user for the access log.
+func SetUserID(ctx context.Context, userID uuid.UUID) {
+	info := RequestFromContext(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	info.userID = userID
+	info.mu.Unlock()
+}
+
+// SetRoute records the pattern the mux matched. Middleware that passed on a
+// copy of the request never sees the mux set its Pattern, so the access
+// log reads the route from here.
+func SetRoute(ctx context.Context, route string) {
+	info := RequestFromContext(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	info.route = route
+	info.mu.Unlock()
+}
+
+// SetTraceID records the trace the request belongs to for the access log.
+func SetTraceID(ctx context.Context, traceID string) {
+	info := RequestFromContext(ctx)
+	if info == nil {
+		return
+	}
+	info.mu.Lock()
+	info.traceID = traceID
+	info.mu.Unlock()
+}
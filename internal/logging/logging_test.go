@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestRedactionPolicy(t *testing.T) {
+	policy := NewRedactionPolicy("email")
+
+	var buf bytes.Buffer
+	logger := New(&buf, slog.LevelDebug, policy)
+	logger.Info("login",
+		"Password", "hunter2",
+		"email", "a@example.com",
+		"body", policy.RedactJSON([]byte(`{"user":{"token":"abc","name":"kev"},"items":[{"api_key":"k"}]}`)),
+	)
+
+	out := buf.String()
+	for _, secret := range []string{"hunter2", "a@example.com", "abc", `"k"`} {
+		if strings.Contains(out, secret) {
+			t.Errorf("log output leaks %s: %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "kev") {
+		t.Errorf("log output lost a field that isn't redacted: %s", out)
+	}
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("log output isn't JSON: %v", err)
+	}
+	if record["Password"] != redacted {
+		t.Errorf("Password = %v, want %s", record["Password"], redacted)
+	}
+
+	if got := policy.RedactJSON([]byte("not json")); got != "<8 bytes>" {
+		t.Errorf("RedactJSON(non-JSON) = %v", got)
+	}
+}
@@ -0,0 +1,942 @@
+// Package memstore is an in-memory database.Store for tests. It mirrors the
+// Postgres schema closely enough that handler tests exercise the same paths
+// they would against a real database: unique constraints and foreign keys
+// fail with the same pq error codes, deletes cascade, missing rows come back
+// as sql.ErrNoRows and refresh tokens expire.
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/lib/pq"
+)
+
+// RefreshTokenLifetime matches the INTERVAL in CreateRefreshToken.
+const RefreshTokenLifetime = 60 * 24 * time.Hour
+
+type Store struct {
+	// Now is the clock used for NOW(); tests move it to expire tokens.
+	Now func() time.Time
+
+	mu sync.Mutex
+	// txMu runs InTx calls one at a time.
+	txMu sync.Mutex
+	tables
+}
+
+// tables holds every row; InTx copies it to roll back.
+type tables struct {
+	users         []database.User
+	chirps        []database.Chirp
+	refreshTokens []database.RefreshToken
+	rules         []database.ModerationRule
+	hits          []database.ModerationHit
+	reports       []database.Report
+	audit         []database.ModerationAuditLog
+	warnings      []database.UserWarning
+}
+
+func (t tables) clone() tables {
+	return tables{
+		users:         slices.Clone(t.users),
+		chirps:        slices.Clone(t.chirps),
+		refreshTokens: slices.Clone(t.refreshTokens),
+		rules:         slices.Clone(t.rules),
+		hits:          slices.Clone(t.hits),
+		reports:       slices.Clone(t.reports),
+		audit:         slices.Clone(t.audit),
+		warnings:      slices.Clone(t.warnings),
+	}
+}
+
+var _ database.Store = (*Store)(nil)
+
+func New() *Store {
+	return &Store{Now: time.Now}
+}
+
+func uniqueViolation(constraint string) error {
+	return &pq.Error{Code: "23505", Message: "duplicate key value violates unique constraint \"" + constraint + "\"", Constraint: constraint}
+}
+
+func foreignKeyViolation(constraint string) error {
+	return &pq.Error{Code: "23503", Message: "insert or update violates foreign key constraint \"" + constraint + "\"", Constraint: constraint}
+}
+
+func checkViolation(constraint string) error {
+	return &pq.Error{Code: "23514", Message: "new row violates check constraint \"" + constraint + "\"", Constraint: constraint}
+}
+
+func (s *Store) now() time.Time {
+	return s.Now().UTC()
+}
+
+// InTx runs fn against s and, if fn fails, puts every row back as it was.
+// Transactions don't see each other's writes half done, but writes made
+// outside InTx meanwhile are rolled back with them.
+func (s *Store) InTx(ctx context.Context, fn func(q database.Store) error) error {
+	s.txMu.Lock()
+	defer s.txMu.Unlock()
+
+	s.mu.Lock()
+	saved := s.tables.clone()
+	s.mu.Unlock()
+
+	if err := fn(s); err != nil {
+		s.mu.Lock()
+		s.tables = saved
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// The helpers below expect s.mu to be held.
+
+func (s *Store) userIndex(id uuid.UUID) int {
+	for i := range s.users {
+		if s.users[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) chirpIndex(id uuid.UUID) int {
+	for i := range s.chirps {
+		if s.chirps[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) ruleIndex(id uuid.UUID) int {
+	for i := range s.rules {
+		if s.rules[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) reportIndex(id uuid.UUID) int {
+	for i := range s.reports {
+		if s.reports[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Store) emailTaken(email string, except uuid.UUID) bool {
+	for _, user := range s.users {
+		if user.Email == email && user.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func filter[T any](items []T, keep func(T) bool) []T {
+	kept := items[:0]
+	for _, item := range items {
+		if keep(item) {
+			kept = append(kept, item)
+		}
+	}
+	return kept
+}
+
+// deleteChirps removes the chirps matching drop along with the reports and
+// moderation hits that reference them. Warnings about them lose their
+// chirp_id.
+func (s *Store) deleteChirps(drop func(database.Chirp) bool) {
+	gone := map[uuid.UUID]bool{}
+	s.chirps = filter(s.chirps, func(c database.Chirp) bool {
+		if drop(c) {
+			gone[c.ID] = true
+			return false
+		}
+		return true
+	})
+	s.reports = filter(s.reports, func(r database.Report) bool { return !gone[r.ChirpID] })
+	s.hits = filter(s.hits, func(h database.ModerationHit) bool { return !h.ChirpID.Valid || !gone[h.ChirpID.UUID] })
+	for i := range s.warnings {
+		if gone[s.warnings[i].ChirpID.UUID] {
+			s.warnings[i].ChirpID = uuid.NullUUID{}
+		}
+	}
+}
+
+// users
+
+func (s *Store) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userIndex(arg.ID) >= 0 {
+		return database.User{}, uniqueViolation("users_pkey")
+	}
+	if s.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, uniqueViolation("users_email_key")
+	}
+
+	user := database.User{
+		ID:             arg.ID,
+		CreatedAt:      arg.CreatedAt,
+		UpdatedAt:      arg.UpdatedAt,
+		Email:          arg.Email,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+	}
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+// DeleteAllUsers cascades to every chirp, token, report, moderation hit and
+// warning, since all of them reference a user. The audit log has no foreign keys and
+// is left alone.
+func (s *Store) DeleteAllUsers(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users = nil
+	s.refreshTokens = nil
+	s.chirps = nil
+	s.reports = nil
+	s.hits = nil
+	s.warnings = nil
+	return nil
+}
+
+func (s *Store) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (s *Store) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.userIndex(id); i >= 0 {
+		return s.users[i], nil
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+// GetUsersByIDs returns the users that exist, in no particular order.
+func (s *Store) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []database.User
+	for _, user := range s.users {
+		if slices.Contains(ids, user.ID) {
+			users = append(users, user)
+		}
+	}
+	return users, nil
+}
+
+// updateUser applies fn to the user if it exists; like an UPDATE, a missing
+// row is not an error.
+func (s *Store) updateUser(id uuid.UUID, fn func(*database.User)) {
+	if i := s.userIndex(id); i >= 0 {
+		fn(&s.users[i])
+		s.users[i].UpdatedAt = s.now()
+	}
+}
+
+func (s *Store) SetUserShadowBanned(ctx context.Context, arg database.SetUserShadowBannedParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updateUser(arg.ID, func(u *database.User) { u.ShadowBanned = arg.ShadowBanned })
+	return nil
+}
+
+func (s *Store) SuspendUser(ctx context.Context, arg database.SuspendUserParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updateUser(arg.ID, func(u *database.User) { u.SuspendedUntil = arg.SuspendedUntil })
+	return nil
+}
+
+func (s *Store) UpdateUserEmailAndPassword(ctx context.Context, arg database.UpdateUserEmailAndPasswordParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.emailTaken(arg.Email, arg.ID) {
+		return uniqueViolation("users_email_key")
+	}
+	s.updateUser(arg.ID, func(u *database.User) {
+		u.Email = arg.Email
+		u.HashedPassword = arg.HashedPassword
+	})
+	return nil
+}
+
+// UpgradeUserToChirpyRed leaves updated_at alone, as the query does.
+func (s *Store) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.userIndex(id); i >= 0 {
+		s.users[i].IsChirpyRed = true
+	}
+	return nil
+}
+
+// refresh tokens
+
+func (s *Store) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userIndex(arg.UserID) < 0 {
+		return foreignKeyViolation("fk_user")
+	}
+	for _, token := range s.refreshTokens {
+		if token.Token == arg.Token {
+			return uniqueViolation("refresh_tokens_pkey")
+		}
+	}
+
+	now := s.now()
+	s.refreshTokens = append(s.refreshTokens, database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		ExpiresAt: now.Add(RefreshTokenLifetime),
+	})
+	return nil
+}
+
+func (s *Store) GetUserFromRefreshToken(ctx context.Context, token string) (database.GetUserFromRefreshTokenRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.refreshTokens {
+		if t.Token != token || !t.ExpiresAt.After(s.now()) || t.RevokedAt.Valid {
+			continue
+		}
+		i := s.userIndex(t.UserID)
+		if i < 0 {
+			break
+		}
+		user := s.users[i]
+		return database.GetUserFromRefreshTokenRow{
+			ID:             user.ID,
+			Email:          user.Email,
+			CreatedAt:      user.CreatedAt,
+			UpdatedAt:      user.UpdatedAt,
+			SuspendedUntil: user.SuspendedUntil,
+		}, nil
+	}
+	return database.GetUserFromRefreshTokenRow{}, sql.ErrNoRows
+}
+
+func (s *Store) RevokeRefreshToken(ctx context.Context, token string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.refreshTokens {
+		if s.refreshTokens[i].Token == token {
+			s.refreshTokens[i].RevokedAt = sql.NullTime{Time: s.now(), Valid: true}
+		}
+	}
+	return nil
+}
+
+// chirps
+
+func (s *Store) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.chirpIndex(arg.ID) >= 0 {
+		return database.Chirp{}, uniqueViolation("chirps_pkey")
+	}
+	if s.userIndex(arg.UserID) < 0 {
+		return database.Chirp{}, foreignKeyViolation("fk_user")
+	}
+
+	chirp := database.Chirp{
+		ID:        arg.ID,
+		CreatedAt: arg.CreatedAt,
+		UpdatedAt: arg.UpdatedAt,
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		Status:    arg.Status,
+	}
+	s.chirps = append(s.chirps, chirp)
+	return chirp, nil
+}
+
+func (s *Store) DeleteChirpByID(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.deleteChirps(func(c database.Chirp) bool { return c.ID == id })
+	return nil
+}
+
+func (s *Store) DeleteChirpIfUnchanged(ctx context.Context, arg database.DeleteChirpIfUnchangedParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	s.deleteChirps(func(c database.Chirp) bool {
+		if c.ID == arg.ID && c.UpdatedAt.Equal(arg.UpdatedAt) {
+			n++
+			return true
+		}
+		return false
+	})
+	return n, nil
+}
+
+// visibleChirps mirrors the WHERE clause shared by GetAllChirps and
+// GetChirpsByAuthorID, ordered by created_at.
+func (s *Store) visibleChirps(viewerID uuid.UUID, keep func(database.Chirp) bool) []database.Chirp {
+	var result []database.Chirp
+	for _, chirp := range s.chirps {
+		if chirp.Status != "published" || !keep(chirp) {
+			continue
+		}
+		i := s.userIndex(chirp.UserID)
+		if i < 0 || (s.users[i].ShadowBanned && chirp.UserID != viewerID) {
+			continue
+		}
+		result = append(result, chirp)
+	}
+	sort.SliceStable(result, func(a, b int) bool { return result[a].CreatedAt.Before(result[b].CreatedAt) })
+	return result
+}
+
+func (s *Store) GetAllChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.visibleChirps(viewerID, func(database.Chirp) bool { return true }), nil
+}
+
+func (s *Store) GetChirpByID(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.chirpIndex(id); i >= 0 {
+		return s.chirps[i], nil
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (s *Store) GetChirpsByAuthorID(ctx context.Context, arg database.GetChirpsByAuthorIDParams) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.visibleChirps(arg.ViewerID, func(c database.Chirp) bool { return c.UserID == arg.UserID }), nil
+}
+
+func (s *Store) ListChirpsByStatus(ctx context.Context, status string) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result []database.Chirp
+	for _, chirp := range s.chirps {
+		if chirp.Status == status {
+			result = append(result, chirp)
+		}
+	}
+	sort.SliceStable(result, func(a, b int) bool { return result[a].CreatedAt.Before(result[b].CreatedAt) })
+	return result, nil
+}
+
+func (s *Store) TransitionChirpStatus(ctx context.Context, arg database.TransitionChirpStatusParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.chirpIndex(arg.ID)
+	if i < 0 || s.chirps[i].Status != arg.OldStatus {
+		return 0, nil
+	}
+	s.chirps[i].Status = arg.NewStatus
+	s.chirps[i].UpdatedAt = s.now()
+	return 1, nil
+}
+
+func (s *Store) UpdateChirpStatus(ctx context.Context, arg database.UpdateChirpStatusParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.chirpIndex(arg.ID); i >= 0 {
+		s.chirps[i].Status = arg.Status
+		s.chirps[i].UpdatedAt = s.now()
+	}
+	return nil
+}
+
+// moderation rules and hits
+
+func validRule(kind, action string) error {
+	if kind != "word" && kind != "regex" {
+		return checkViolation("moderation_rules_kind_check")
+	}
+	if action != "mask" && action != "reject" && action != "hold" {
+		return checkViolation("moderation_rules_action_check")
+	}
+	return nil
+}
+
+func (s *Store) ruleTaken(kind, pattern string, except uuid.UUID) bool {
+	for _, rule := range s.rules {
+		if rule.Kind == kind && rule.Pattern == pattern && rule.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Store) CreateModerationRule(ctx context.Context, arg database.CreateModerationRuleParams) (database.ModerationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := validRule(arg.Kind, arg.Action); err != nil {
+		return database.ModerationRule{}, err
+	}
+	if s.ruleIndex(arg.ID) >= 0 {
+		return database.ModerationRule{}, uniqueViolation("moderation_rules_pkey")
+	}
+	if s.ruleTaken(arg.Kind, arg.Pattern, uuid.Nil) {
+		return database.ModerationRule{}, uniqueViolation("moderation_rules_kind_pattern_key")
+	}
+
+	now := s.now()
+	rule := database.ModerationRule{
+		ID:        arg.ID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Kind:      arg.Kind,
+		Pattern:   arg.Pattern,
+		Action:    arg.Action,
+		Enabled:   arg.Enabled,
+	}
+	s.rules = append(s.rules, rule)
+	return rule, nil
+}
+
+func (s *Store) DeleteModerationRule(ctx context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.rules = filter(s.rules, func(r database.ModerationRule) bool { return r.ID != id })
+	s.hits = filter(s.hits, func(h database.ModerationHit) bool { return h.RuleID != id })
+	return nil
+}
+
+func (s *Store) GetModerationRuleByID(ctx context.Context, id uuid.UUID) (database.ModerationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.ruleIndex(id); i >= 0 {
+		return s.rules[i], nil
+	}
+	return database.ModerationRule{}, sql.ErrNoRows
+}
+
+func (s *Store) ListModerationRules(ctx context.Context) ([]database.ModerationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]database.ModerationRule(nil), s.rules...), nil
+}
+
+func (s *Store) ListEnabledModerationRules(ctx context.Context) ([]database.ModerationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rules []database.ModerationRule
+	for _, rule := range s.rules {
+		if rule.Enabled {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, nil
+}
+
+func (s *Store) UpdateModerationRule(ctx context.Context, arg database.UpdateModerationRuleParams) (database.ModerationRule, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.ruleIndex(arg.ID)
+	if i < 0 {
+		return database.ModerationRule{}, sql.ErrNoRows
+	}
+	if err := validRule(arg.Kind, arg.Action); err != nil {
+		return database.ModerationRule{}, err
+	}
+	if s.ruleTaken(arg.Kind, arg.Pattern, arg.ID) {
+		return database.ModerationRule{}, uniqueViolation("moderation_rules_kind_pattern_key")
+	}
+
+	rule := &s.rules[i]
+	rule.Kind = arg.Kind
+	rule.Pattern = arg.Pattern
+	rule.Action = arg.Action
+	rule.Enabled = arg.Enabled
+	rule.UpdatedAt = s.now()
+	return *rule, nil
+}
+
+func (s *Store) CreateModerationHit(ctx context.Context, arg database.CreateModerationHitParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.ruleIndex(arg.RuleID) < 0 {
+		return foreignKeyViolation("fk_rule")
+	}
+	if arg.ChirpID.Valid && s.chirpIndex(arg.ChirpID.UUID) < 0 {
+		return foreignKeyViolation("fk_chirp")
+	}
+	if s.userIndex(arg.UserID) < 0 {
+		return foreignKeyViolation("fk_user")
+	}
+
+	s.hits = append(s.hits, database.ModerationHit{
+		ID:        arg.ID,
+		CreatedAt: s.now(),
+		RuleID:    arg.RuleID,
+		ChirpID:   arg.ChirpID,
+		UserID:    arg.UserID,
+		Matched:   arg.Matched,
+		Action:    arg.Action,
+	})
+	return nil
+}
+
+func (s *Store) GetModerationHitsByChirpID(ctx context.Context, chirpID uuid.NullUUID) ([]database.ModerationHit, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var hits []database.ModerationHit
+	for _, hit := range s.hits {
+		// NULL = NULL is not true in SQL either.
+		if chirpID.Valid && hit.ChirpID.Valid && hit.ChirpID.UUID == chirpID.UUID {
+			hits = append(hits, hit)
+		}
+	}
+	return hits, nil
+}
+
+// reports and the audit log
+
+var reportReasons = map[string]bool{
+	"spam":           true,
+	"harassment":     true,
+	"hate_speech":    true,
+	"violence":       true,
+	"sexual_content": true,
+	"misinformation": true,
+	"other":          true,
+}
+
+func (s *Store) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !reportReasons[arg.Reason] {
+		return database.Report{}, checkViolation("reports_reason_check")
+	}
+	if s.chirpIndex(arg.ChirpID) < 0 {
+		return database.Report{}, foreignKeyViolation("fk_chirp")
+	}
+	if s.userIndex(arg.ReporterID) < 0 {
+		return database.Report{}, foreignKeyViolation("fk_reporter")
+	}
+	for _, report := range s.reports {
+		if report.ID == arg.ID {
+			return database.Report{}, uniqueViolation("reports_pkey")
+		}
+		if report.ChirpID == arg.ChirpID && report.ReporterID == arg.ReporterID {
+			return database.Report{}, uniqueViolation("reports_chirp_id_reporter_id_key")
+		}
+	}
+
+	now := s.now()
+	report := database.Report{
+		ID:         arg.ID,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		ChirpID:    arg.ChirpID,
+		ReporterID: arg.ReporterID,
+		Reason:     arg.Reason,
+		Details:    arg.Details,
+		Status:     "open",
+	}
+	s.reports = append(s.reports, report)
+	return report, nil
+}
+
+func (s *Store) CountUnresolvedReportsForChirp(ctx context.Context, chirpID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var count int64
+	for _, report := range s.reports {
+		if report.ChirpID == chirpID && report.Status != "resolved" {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (s *Store) GetReportByID(ctx context.Context, id uuid.UUID) (database.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := s.reportIndex(id); i >= 0 {
+		return s.reports[i], nil
+	}
+	return database.Report{}, sql.ErrNoRows
+}
+
+func (s *Store) ListReportsByStatus(ctx context.Context, status string) ([]database.ListReportsByStatusRow, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var rows []database.ListReportsByStatusRow
+	for _, report := range s.reports {
+		i := s.chirpIndex(report.ChirpID)
+		if report.Status != status || i < 0 {
+			continue
+		}
+		chirp := s.chirps[i]
+		rows = append(rows, database.ListReportsByStatusRow{
+			ID:            report.ID,
+			CreatedAt:     report.CreatedAt,
+			ChirpID:       report.ChirpID,
+			ReporterID:    report.ReporterID,
+			Reason:        report.Reason,
+			Details:       report.Details,
+			Status:        report.Status,
+			ClaimedBy:     report.ClaimedBy,
+			ChirpBody:     chirp.Body,
+			ChirpAuthorID: chirp.UserID,
+			ChirpStatus:   chirp.Status,
+		})
+	}
+	sort.SliceStable(rows, func(a, b int) bool { return rows[a].CreatedAt.Before(rows[b].CreatedAt) })
+	return rows, nil
+}
+
+func (s *Store) ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.reportIndex(arg.ID)
+	if i < 0 || s.reports[i].Status != "open" {
+		return database.Report{}, sql.ErrNoRows
+	}
+
+	now := s.now()
+	report := &s.reports[i]
+	report.Status = "claimed"
+	report.ClaimedBy = arg.ClaimedBy
+	report.ClaimedAt = sql.NullTime{Time: now, Valid: true}
+	report.UpdatedAt = now
+	return *report, nil
+}
+
+func (s *Store) ResolveReport(ctx context.Context, arg database.ResolveReportParams) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i := s.reportIndex(arg.ID)
+	if i < 0 || s.reports[i].Status == "resolved" {
+		return 0, nil
+	}
+	report := &s.reports[i]
+	if report.ClaimedBy.Valid && report.ClaimedBy != arg.ResolvedBy && !arg.OverrideClaim {
+		return 0, nil
+	}
+
+	now := s.now()
+	report.Status = "resolved"
+	report.ResolvedBy = arg.ResolvedBy
+	report.ResolvedAt = sql.NullTime{Time: now, Valid: true}
+	report.Resolution = arg.Resolution
+	report.UpdatedAt = now
+	return 1, nil
+}
+
+// ResolveReportsForChirp leaves reports other moderators claimed alone.
+func (s *Store) ResolveReportsForChirp(ctx context.Context, arg database.ResolveReportsForChirpParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for i := range s.reports {
+		report := &s.reports[i]
+		mine := report.Status == "claimed" && report.ClaimedBy.Valid && report.ClaimedBy == arg.ResolvedBy
+		if report.ChirpID != arg.ChirpID || (report.Status != "open" && !mine) {
+			continue
+		}
+		report.Status = "resolved"
+		report.ResolvedBy = arg.ResolvedBy
+		report.ResolvedAt = sql.NullTime{Time: now, Valid: true}
+		report.Resolution = arg.Resolution
+		report.UpdatedAt = now
+	}
+	return nil
+}
+
+func (s *Store) CreateModerationAuditEntry(ctx context.Context, arg database.CreateModerationAuditEntryParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.audit = append(s.audit, database.ModerationAuditLog{
+		ID:           arg.ID,
+		CreatedAt:    s.now(),
+		ModeratorID:  arg.ModeratorID,
+		Action:       arg.Action,
+		ReportID:     arg.ReportID,
+		ChirpID:      arg.ChirpID,
+		TargetUserID: arg.TargetUserID,
+		Note:         arg.Note,
+	})
+	return nil
+}
+
+// ListModerationAuditEntries returns the newest entries first.
+func (s *Store) ListModerationAuditEntries(ctx context.Context, limit int32) ([]database.ModerationAuditLog, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var entries []database.ModerationAuditLog
+	for i := len(s.audit) - 1; i >= 0 && int32(len(entries)) < limit; i-- {
+		entries = append(entries, s.audit[i])
+	}
+	sort.SliceStable(entries, func(a, b int) bool { return entries[a].CreatedAt.After(entries[b].CreatedAt) })
+	return entries, nil
+}
+
+// warnings
+
+func (s *Store) CreateUserWarning(ctx context.Context, arg database.CreateUserWarningParams) (database.UserWarning, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.userIndex(arg.UserID) < 0 {
+		return database.UserWarning{}, foreignKeyViolation("fk_user")
+	}
+	if arg.ChirpID.Valid && s.chirpIndex(arg.ChirpID.UUID) < 0 {
+		return database.UserWarning{}, foreignKeyViolation("fk_chirp")
+	}
+	for _, warning := range s.warnings {
+		if warning.ID == arg.ID {
+			return database.UserWarning{}, uniqueViolation("user_warnings_pkey")
+		}
+	}
+
+	warning := database.UserWarning{
+		ID:        arg.ID,
+		CreatedAt: s.now(),
+		UserID:    arg.UserID,
+		ChirpID:   arg.ChirpID,
+		Reason:    arg.Reason,
+		Note:      arg.Note,
+	}
+	s.warnings = append(s.warnings, warning)
+	return warning, nil
+}
+
+// ListUserWarnings returns the newest warnings first.
+func (s *Store) ListUserWarnings(ctx context.Context, userID uuid.UUID) ([]database.UserWarning, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var warnings []database.UserWarning
+	for i := len(s.warnings) - 1; i >= 0; i-- {
+		if s.warnings[i].UserID == userID {
+			warnings = append(warnings, s.warnings[i])
+		}
+	}
+	sort.SliceStable(warnings, func(a, b int) bool { return warnings[a].CreatedAt.After(warnings[b].CreatedAt) })
+	return warnings, nil
+}
+
+// SetUserRole is not part of database.Store, since no handler changes roles,
+// but tests need it to create moderators and admins.
+func (s *Store) SetUserRole(ctx context.Context, arg database.SetUserRoleParams) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.updateUser(arg.ID, func(u *database.User) { u.Role = arg.Role })
+	return nil
+}
+
+// admin commands; like SetUserRole, these are only used by the chirpy CLI.
+
+func (s *Store) ListUsers(ctx context.Context) ([]database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	users := slices.Clone(s.users)
+	sort.SliceStable(users, func(a, b int) bool { return users[a].CreatedAt.Before(users[b].CreatedAt) })
+	return users, nil
+}
+
+func (s *Store) ListAllChirps(ctx context.Context) ([]database.Chirp, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	chirps := slices.Clone(s.chirps)
+	sort.SliceStable(chirps, func(a, b int) bool { return chirps[a].CreatedAt.Before(chirps[b].CreatedAt) })
+	return chirps, nil
+}
+
+func (s *Store) DeleteChirpsByAuthorID(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	s.deleteChirps(func(c database.Chirp) bool {
+		if c.UserID == userID {
+			n++
+			return true
+		}
+		return false
+	})
+	return n, nil
+}
+
+func (s *Store) RevokeRefreshTokensForUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for i := range s.refreshTokens {
+		if s.refreshTokens[i].UserID == userID && !s.refreshTokens[i].RevokedAt.Valid {
+			s.refreshTokens[i].RevokedAt = sql.NullTime{Time: s.now(), Valid: true}
+			n++
+		}
+	}
+	return n, nil
+}
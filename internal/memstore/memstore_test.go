@@ -0,0 +1,180 @@
+package memstore
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/lib/pq"
+)
+
+func pqCode(err error) string {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return string(pqErr.Code)
+	}
+	return ""
+}
+
+func createUser(t *testing.T, s *Store, email string) database.User {
+	t.Helper()
+	user, err := s.CreateUser(context.Background(), database.CreateUserParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Email:     email,
+	})
+	if err != nil {
+		t.Fatalf("CreateUser(%s): %v", email, err)
+	}
+	return user
+}
+
+func TestUniqueEmail(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	alice := createUser(t, s, "alice@example.com")
+	bob := createUser(t, s, "bob@example.com")
+
+	_, err := s.CreateUser(ctx, database.CreateUserParams{ID: uuid.New(), Email: "alice@example.com"})
+	if pqCode(err) != "23505" {
+		t.Errorf("duplicate CreateUser error = %v, want unique violation", err)
+	}
+
+	err = s.UpdateUserEmailAndPassword(ctx, database.UpdateUserEmailAndPasswordParams{ID: bob.ID, Email: alice.Email})
+	if pqCode(err) != "23505" {
+		t.Errorf("UpdateUserEmailAndPassword to a taken email error = %v, want unique violation", err)
+	}
+
+	err = s.UpdateUserEmailAndPassword(ctx, database.UpdateUserEmailAndPasswordParams{ID: alice.ID, Email: alice.Email})
+	if err != nil {
+		t.Errorf("keeping your own email failed: %v", err)
+	}
+}
+
+func TestCascadingDeletes(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	alice := createUser(t, s, "alice@example.com")
+	bob := createUser(t, s, "bob@example.com")
+
+	chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), Body: "hi", UserID: alice.ID, Status: "published"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), UserID: uuid.New()}); pqCode(err) != "23503" {
+		t.Errorf("chirp by unknown user error = %v, want foreign key violation", err)
+	}
+
+	rule, err := s.CreateModerationRule(ctx, database.CreateModerationRuleParams{ID: uuid.New(), Kind: "word", Pattern: "hi", Action: "mask", Enabled: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = s.CreateModerationHit(ctx, database.CreateModerationHitParams{ID: uuid.New(), RuleID: rule.ID, ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true}, UserID: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateReport(ctx, database.CreateReportParams{ID: uuid.New(), ChirpID: chirp.ID, ReporterID: bob.ID, Reason: "spam"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteChirpByID(ctx, chirp.ID); err != nil {
+		t.Fatal(err)
+	}
+	if count, _ := s.CountUnresolvedReportsForChirp(ctx, chirp.ID); count != 0 {
+		t.Errorf("%d reports survived their chirp", count)
+	}
+	if hits, _ := s.GetModerationHitsByChirpID(ctx, uuid.NullUUID{UUID: chirp.ID, Valid: true}); len(hits) != 0 {
+		t.Errorf("%d moderation hits survived their chirp", len(hits))
+	}
+
+	if _, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), UserID: alice.ID, Status: "published"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "t", UserID: alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteAllUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if chirps, _ := s.GetAllChirps(ctx, uuid.Nil); len(chirps) != 0 {
+		t.Errorf("%d chirps survived their author", len(chirps))
+	}
+	if _, err := s.GetUserFromRefreshToken(ctx, "t"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("refresh token survived its user: %v", err)
+	}
+}
+
+func TestRefreshTokenExpiry(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	s := New()
+	s.Now = func() time.Time { return now }
+	alice := createUser(t, s, "alice@example.com")
+
+	if err := s.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "t", UserID: alice.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetUserFromRefreshToken(ctx, "t"); err != nil {
+		t.Fatalf("fresh token rejected: %v", err)
+	}
+
+	now = now.Add(RefreshTokenLifetime)
+	if _, err := s.GetUserFromRefreshToken(ctx, "t"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expired token accepted: %v", err)
+	}
+}
+
+func TestInTxRollback(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	alice := createUser(t, s, "alice@example.com")
+	chirp, err := s.CreateChirp(ctx, database.CreateChirpParams{ID: uuid.New(), Body: "hi", UserID: alice.ID, Status: "published"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("failed")
+	err = s.InTx(ctx, func(q database.Store) error {
+		if err := q.UpdateChirpStatus(ctx, database.UpdateChirpStatusParams{ID: chirp.ID, Status: "removed"}); err != nil {
+			return err
+		}
+		if _, err := q.CreateUserWarning(ctx, database.CreateUserWarningParams{ID: uuid.New(), UserID: alice.ID, Reason: "spam"}); err != nil {
+			return err
+		}
+		return failed
+	})
+	if !errors.Is(err, failed) {
+		t.Fatalf("InTx error = %v, want fn's error", err)
+	}
+	if got, _ := s.GetChirpByID(ctx, chirp.ID); got.Status != "published" {
+		t.Errorf("chirp status = %q after rollback, want published", got.Status)
+	}
+	if warnings, _ := s.ListUserWarnings(ctx, alice.ID); len(warnings) != 0 {
+		t.Errorf("%d warnings survived the rollback", len(warnings))
+	}
+
+	err = s.InTx(ctx, func(q database.Store) error {
+		_, err := q.CreateUserWarning(ctx, database.CreateUserWarningParams{
+			ID:      uuid.New(),
+			UserID:  alice.ID,
+			ChirpID: uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			Reason:  "spam",
+		})
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DeleteChirpByID(ctx, chirp.ID); err != nil {
+		t.Fatal(err)
+	}
+	warnings, _ := s.ListUserWarnings(ctx, alice.ID)
+	if len(warnings) != 1 || warnings[0].ChirpID.Valid {
+		t.Errorf("warnings = %+v, want one that outlived its chirp", warnings)
+	}
+}
@@ -0,0 +1,167 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const namespace = "chirpy"
+
+// Outcomes recorded by the Logins counter.
+const (
+	LoginSucceeded = "succeeded"
+	LoginFailed    = "failed"
+)
+
+// Outcomes recorded by the Webhooks counter.
+const (
+	WebhookUpgraded     = "upgraded"
+	WebhookIgnored      = "ignored"
+	WebhookUnauthorized = "unauthorized"
+	WebhookBadRequest   = "bad_request"
+	WebhookUnknownUser  = "unknown_user"
+)
+
+// Metrics owns a registry so tests can build as many as they like without
+// colliding on the global one.
+type Metrics struct {
+	Registry *prometheus.Registry
+
+	FileServerHits   prometheus.Counter
+	RequestsTotal    *prometheus.CounterVec
+	RequestDuration  *prometheus.HistogramVec
+	RequestsInFlight prometheus.Gauge
+	ChirpsCreated    prometheus.Counter
+	Logins           *prometheus.CounterVec
+	Webhooks         *prometheus.CounterVec
+}
+
+// New registers every Chirpy metric. db may be nil, in which case no pool
+// statistics are exported.
+func New(db *sql.DB) *Metrics {
+	m := &Metrics{
+		Registry: prometheus.NewRegistry(),
+		FileServerHits: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "fileserver_hits_total",
+			Help:      "Requests served from /app/.",
+		}),
+		RequestsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route pattern and status code.",
+		}, []string{"method", "route", "code"}),
+		RequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route pattern.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		RequestsInFlight: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "HTTP requests currently being served.",
+		}),
+		ChirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "chirps_created_total",
+			Help:      "Chirps stored, including ones held for moderation.",
+		}),
+		Logins: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "logins_total",
+			Help:      "Login attempts by result.",
+		}, []string{"result"}),
+		Webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhooks_total",
+			Help:      "Polka webhook deliveries by outcome.",
+		}, []string{"outcome"}),
+	}
+
+	m.Registry.MustRegister(
+		m.FileServerHits,
+		m.RequestsTotal,
+		m.RequestDuration,
+		m.RequestsInFlight,
+		m.ChirpsCreated,
+		m.Logins,
+		m.Webhooks,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if db != nil {
+		m.Registry.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+	}
+
+	// Make the labelled series show up at zero before the first event.
+	for _, result := range []string{LoginSucceeded, LoginFailed} {
+		m.Logins.WithLabelValues(result)
+	}
+	for _, outcome := range []string{WebhookUpgraded, WebhookIgnored, WebhookUnauthorized, WebhookBadRequest, WebhookUnknownUser} {
+		m.Webhooks.WithLabelValues(outcome)
+	}
+
+	return m
+}
+
+// Handler serves the registry in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.Registry, promhttp.HandlerOpts{Registry: m.Registry})
+}
+
+// Sample is one exported value, flattened for display.
+type Sample struct {
+	Name   string
+	Labels string
+	Value  float64
+}
+
+// Snapshot returns the current value of every Chirpy series. Histograms are
+// reported as their _count and _sum, which is what a human wants to read.
+func (m *Metrics) Snapshot() ([]Sample, error) {
+	families, err := m.Registry.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []Sample
+	for _, family := range families {
+		name := family.GetName()
+		if !strings.HasPrefix(name, namespace+"_") {
+			continue
+		}
+		for _, metric := range family.GetMetric() {
+			labels := formatLabels(metric.GetLabel())
+			switch family.GetType() {
+			case dto.MetricType_COUNTER:
+				samples = append(samples, Sample{name, labels, metric.GetCounter().GetValue()})
+			case dto.MetricType_GAUGE:
+				samples = append(samples, Sample{name, labels, metric.GetGauge().GetValue()})
+			case dto.MetricType_HISTOGRAM:
+				histogram := metric.GetHistogram()
+				samples = append(samples,
+					Sample{name + "_count", labels, float64(histogram.GetSampleCount())},
+					Sample{name + "_sum", labels, histogram.GetSampleSum()},
+				)
+			}
+		}
+	}
+	return samples, nil
+}
+
+func formatLabels(pairs []*dto.LabelPair) string {
+	parts := make([]string, 0, len(pairs))
+	for _, pair := range pairs {
+		parts = append(parts, pair.GetName()+"="+pair.GetValue())
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
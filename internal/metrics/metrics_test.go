@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSnapshotAndHandler(t *testing.T) {
+	m := New(nil)
+	m.FileServerHits.Inc()
+	m.ChirpsCreated.Add(2)
+	m.Logins.WithLabelValues(LoginFailed).Inc()
+	m.RequestDuration.WithLabelValues("GET", "GET /api/chirps").Observe(0.25)
+
+	samples, err := m.Snapshot()
+	if err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+
+	got := map[string]float64{}
+	for _, sample := range samples {
+		got[sample.Name+"{"+sample.Labels+"}"] = sample.Value
+	}
+	want := map[string]float64{
+		"chirpy_fileserver_hits_total{}":                                               1,
+		"chirpy_chirps_created_total{}":                                                2,
+		"chirpy_logins_total{result=failed}":                                           1,
+		"chirpy_logins_total{result=succeeded}":                                        0,
+		"chirpy_webhooks_total{outcome=upgraded}":                                      0,
+		"chirpy_http_request_duration_seconds_count{method=GET,route=GET /api/chirps}": 1,
+		"chirpy_http_request_duration_seconds_sum{method=GET,route=GET /api/chirps}":   0.25,
+	}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("%s = %v, want %v", key, got[key], value)
+		}
+	}
+	for key := range got {
+		if strings.HasPrefix(key, "go_") || strings.HasPrefix(key, "process_") {
+			t.Errorf("Snapshot includes runtime series %s", key)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body, _ := io.ReadAll(rec.Body)
+	for _, line := range []string{
+		"chirpy_fileserver_hits_total 1",
+		`chirpy_logins_total{result="failed"} 1`,
+		"go_goroutines",
+	} {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("/metrics output missing %q", line)
+		}
+	}
+}
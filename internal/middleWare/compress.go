@@ -0,0 +1,272 @@
+package middleWare
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressMinSize is the smallest body worth compressing; shorter ones
+// barely shrink once the encoding's framing is added.
+const compressMinSize = 1024
+
+type encoder interface {
+	io.Writer
+	Flush() error
+	Close() error
+	Reset(io.Writer)
+}
+
+// encodings lists the supported Content-Encodings in the order the server
+// prefers them when a client rates several equally.
+var encodings = []struct {
+	name string
+	pool *sync.Pool
+}{
+	{"zstd", &sync.Pool{New: func() any {
+		// Browsers refuse windows over 8MiB; responses are far smaller.
+		enc, _ := zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(1<<20))
+		return enc
+	}}},
+	{"br", &sync.Pool{New: func() any { return brotli.NewWriterLevel(nil, brotli.DefaultCompression) }}},
+	{"gzip", &sync.Pool{New: func() any { return gzip.NewWriter(nil) }}},
+}
+
+// negotiateEncoding picks the encoding Accept-Encoding rates highest, or
+// "" for an uncompressed response.
+func negotiateEncoding(header string) (string, *sync.Pool) {
+	accepted := map[string]float64{}
+	for _, a := range utils.ParseAccept(header) {
+		if a.Value == "x-gzip" {
+			a.Value = "gzip"
+		}
+		if _, seen := accepted[a.Value]; !seen {
+			accepted[a.Value] = a.Q
+		}
+	}
+
+	var best string
+	var bestPool *sync.Pool
+	bestQ := 0.0
+	for _, e := range encodings {
+		q, ok := accepted[e.name]
+		if !ok {
+			q = accepted["*"]
+		}
+		if q > bestQ {
+			best, bestPool, bestQ = e.name, e.pool, q
+		}
+	}
+	return best, bestPool
+}
+
+// compressible reports whether a Content-Type is worth compressing. Images,
+// archives and the like already are.
+func compressible(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+	if strings.HasPrefix(mediaType, "text/") {
+		return true
+	}
+	for _, kind := range []string{"json", "xml", "javascript", "msgpack", "cbor"} {
+		if strings.Contains(mediaType, kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// MiddlewareCompression compresses responses with zstd, brotli or gzip as
+// Accept-Encoding allows. Bodies are held back until they reach
+// compressMinSize, so small responses go out as they are; a handler that
+// flushes starts compression straight away. Strong ETags get the
+// encoding as a variant, since the bytes differ. Short compressible
+// bodies and 304s get it too, so a response's validators don't depend on
+// its length and a 304 carries the same ones as the 200 it stands for.
+func MiddlewareCompression(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		name, pool := negotiateEncoding(r.Header.Get("Accept-Encoding"))
+		if name == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		cw := &compressWriter{ResponseWriter: w, encoding: name, pool: pool}
+		defer cw.close()
+		next.ServeHTTP(cw, r)
+	})
+}
+
+// compressWriter decides whether to compress once it knows the status,
+// the headers and either the length or enough of the body.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	pool     *sync.Pool
+
+	status int
+	// buf holds the start of the body while undecided.
+	buf []byte
+	// decided is set once headers are sent; enc is nil if the response
+	// went out uncompressed.
+	decided bool
+	enc     encoder
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if code < http.StatusOK {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	if cw.decided || cw.status != 0 {
+		return
+	}
+	cw.status = code
+
+	h := cw.Header()
+	switch {
+	case code == http.StatusNotModified:
+		cw.tagETag()
+		cw.passThrough()
+	case code == http.StatusNoContent, code == http.StatusPartialContent,
+		h.Get("Content-Encoding") != "", h.Get("Content-Range") != "",
+		h.Get("Content-Type") != "" && !compressible(h.Get("Content-Type")):
+		cw.passThrough()
+	default:
+		if length, err := strconv.Atoi(h.Get("Content-Length")); err == nil {
+			if length < compressMinSize {
+				cw.tagETag()
+				cw.passThrough()
+			} else {
+				cw.startCompression()
+			}
+		}
+	}
+}
+
+func (cw *compressWriter) Write(p []byte) (int, error) {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	switch {
+	case cw.enc != nil:
+		return cw.enc.Write(p)
+	case cw.decided:
+		return cw.ResponseWriter.Write(p)
+	}
+
+	cw.buf = append(cw.buf, p...)
+	if len(cw.buf) >= compressMinSize {
+		if err := cw.startOrPassThrough(); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush sends what has been written so far, compressing if the response
+// is compressible: a handler only flushes when more is coming.
+func (cw *compressWriter) Flush() {
+	if cw.status == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.startOrPassThrough()
+	}
+	if cw.enc != nil {
+		cw.enc.Flush()
+	}
+	http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// startOrPassThrough decides on the body buffered so far, sniffing its
+// type as net/http would when the handler didn't set one.
+func (cw *compressWriter) startOrPassThrough() error {
+	if cw.compressibleBody() {
+		cw.startCompression()
+	} else {
+		cw.passThrough()
+	}
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.enc != nil {
+		_, err = cw.enc.Write(buf)
+	} else {
+		_, err = cw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// compressibleBody reports whether the response's type, sniffed from the
+// body buffered so far if the handler didn't set one, is compressible.
+func (cw *compressWriter) compressibleBody() bool {
+	h := cw.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	return compressible(h.Get("Content-Type"))
+}
+
+// tagETag gives a strong ETag the encoding as a variant. Weak ones
+// already allow for encodings.
+func (cw *compressWriter) tagETag() {
+	h := cw.Header()
+	if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set("ETag", utils.ETagVariant(etag, cw.encoding))
+	}
+}
+
+func (cw *compressWriter) passThrough() {
+	cw.decided = true
+	cw.ResponseWriter.WriteHeader(cw.status)
+}
+
+func (cw *compressWriter) startCompression() {
+	cw.decided = true
+	h := cw.Header()
+	h.Del("Content-Length")
+	h.Del("Accept-Ranges")
+	h.Set("Content-Encoding", cw.encoding)
+	cw.tagETag()
+	cw.ResponseWriter.WriteHeader(cw.status)
+
+	cw.enc = cw.pool.Get().(encoder)
+	cw.enc.Reset(cw.ResponseWriter)
+}
+
+// close finishes the response once the handler returns: a short body goes
+// out as it is, and a compressed one gets its trailer.
+func (cw *compressWriter) close() {
+	switch {
+	case cw.enc != nil:
+		cw.enc.Close()
+		cw.enc.Reset(nil)
+		cw.pool.Put(cw.enc)
+	case cw.status == 0:
+		// Nothing written; net/http sends an empty 200.
+	case !cw.decided:
+		if cw.compressibleBody() {
+			cw.tagETag()
+		}
+		cw.passThrough()
+		if len(cw.buf) > 0 {
+			cw.ResponseWriter.Write(cw.buf)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package middleWare
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+func decompress(t *testing.T, encoding string, body []byte) string {
+	t.Helper()
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(body))
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(body))
+	case "zstd":
+		var dec *zstd.Decoder
+		dec, err = zstd.NewReader(bytes.NewReader(body))
+		if err == nil {
+			defer dec.Close()
+			r = dec
+		}
+	default:
+		return string(body)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("decoding %s: %v", encoding, err)
+	}
+	return string(data)
+}
+
+func TestMiddlewareCompression(t *testing.T) {
+	large := strings.Repeat(`{"body":"hello"}`, 200)
+	serve := func(contentType, body string) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", contentType)
+			w.Header().Set("ETag", `"abc"`)
+			io.WriteString(w, body)
+		})
+	}
+
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+		body           string
+		want           string
+	}{
+		{"gzip", "gzip", "application/json", large, "gzip"},
+		{"brotli", "br", "application/json", large, "br"},
+		{"zstd", "zstd", "application/json", large, "zstd"},
+		{"server preference", "gzip, br, zstd", "application/json", large, "zstd"},
+		{"client weights", "gzip;q=0.5, br;q=0.8", "text/html", large, "br"},
+		{"wildcard", "*;q=0.5, zstd;q=0", "application/json", large, "br"},
+		{"x-gzip", "x-gzip", "application/json", large, "gzip"},
+		{"identity", "identity", "application/json", large, ""},
+		{"no header", "", "application/json", large, ""},
+		{"small body", "gzip", "application/json", `{"ok":true}`, ""},
+		{"already compressed type", "gzip", "image/png", large, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			rec := httptest.NewRecorder()
+			MiddlewareCompression(serve(tt.contentType, tt.body)).ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Content-Encoding"); got != tt.want {
+				t.Fatalf("Content-Encoding = %q, want %q", got, tt.want)
+			}
+			if got := decompress(t, tt.want, rec.Body.Bytes()); got != tt.body {
+				t.Errorf("body = %.40q..., want %.40q...", got, tt.body)
+			}
+			if rec.Header().Get("Vary") != "Accept-Encoding" {
+				t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+			}
+			// Short bodies are tagged as if compressed, so the ETag
+			// doesn't depend on the length.
+			wantETag := `"abc"`
+			if tt.want != "" {
+				wantETag = `"abc-` + tt.want + `"`
+			} else if tt.name == "small body" {
+				wantETag = `"abc-gzip"`
+			}
+			if got := rec.Header().Get("ETag"); got != wantETag {
+				t.Errorf("ETag = %s, want %s", got, wantETag)
+			}
+		})
+	}
+}
+
+func TestMiddlewareCompressionPassesThrough(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		handler http.HandlerFunc
+		status  int
+	}{
+		{"not modified", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("ETag", `"abc"`)
+			w.WriteHeader(http.StatusNotModified)
+		}, http.StatusNotModified},
+		{"already encoded", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(bytes.Repeat([]byte("x"), 2*compressMinSize))
+		}, http.StatusOK},
+		{"short body with a status", func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{}`))
+		}, http.StatusCreated},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", "br")
+			rec := httptest.NewRecorder()
+			MiddlewareCompression(tt.handler).ServeHTTP(rec, req)
+			if rec.Code != tt.status || rec.Header().Get("Content-Encoding") == "br" {
+				t.Errorf("got %d with Content-Encoding %q", rec.Code, rec.Header().Get("Content-Encoding"))
+			}
+			// A 304 carries the ETag of the compressed 200.
+			if tt.status == http.StatusNotModified && rec.Header().Get("ETag") != `"abc-br"` {
+				t.Errorf("304 ETag = %s, want \"abc-br\"", rec.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+func TestMiddlewareCompressionFlush(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		io.WriteString(w, "{\"n\":1}\n")
+		if err := http.NewResponseController(w).Flush(); err != nil {
+			t.Errorf("Flush: %v", err)
+		}
+		io.WriteString(w, "{\"n\":2}\n")
+	})
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	rec := httptest.NewRecorder()
+	MiddlewareCompression(handler).ServeHTTP(rec, req)
+
+	if !rec.Flushed || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("flushed = %v, Content-Encoding = %q", rec.Flushed, rec.Header().Get("Content-Encoding"))
+	}
+	if got := decompress(t, "gzip", rec.Body.Bytes()); got != "{\"n\":1}\n{\"n\":2}\n" {
+		t.Errorf("body = %q", got)
+	}
+}
@@ -0,0 +1,126 @@
+package middleWare
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy says which browser origins may call the API and how.
+type CORSPolicy struct {
+	// AllowedOrigins are exact origins such as "https://chirpy.app",
+	// patterns with one "*" for any subdomains such as
+	// "https://*.chirpy.app", or "*" for every origin.
+	AllowedOrigins []string
+	AllowedMethods []string
+	// AllowedHeaders may be sent by scripts; "*" allows any.
+	AllowedHeaders []string
+	// ExposedHeaders may be read by scripts, beyond the safelisted ones.
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache a preflight; 0 leaves it to
+	// them.
+	MaxAge time.Duration
+}
+
+// matchOrigin reports whether origin fits pattern. A "*" stands for one or
+// more host labels, never a port or path.
+func matchOrigin(pattern, origin string) bool {
+	if pattern == "*" {
+		return true
+	}
+	prefix, suffix, wildcard := strings.Cut(pattern, "*")
+	if !wildcard {
+		return pattern == origin
+	}
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	return !strings.ContainsAny(origin[len(prefix):len(origin)-len(suffix)], "/:@")
+}
+
+// Middleware adds CORS headers for allowed origins and answers their
+// preflight requests. Requests from other origins are served without
+// them, so browsers keep their responses from scripts; their preflights
+// get an empty 204.
+func (p CORSPolicy) Middleware(next http.Handler) http.Handler {
+	origins := make([]string, len(p.AllowedOrigins))
+	for i, origin := range p.AllowedOrigins {
+		origins[i] = strings.ToLower(origin)
+	}
+	// "*" can't be combined with credentials; the origin is echoed instead.
+	anyOrigin := slices.Contains(origins, "*") && !p.AllowCredentials
+	headers := map[string]bool{}
+	for _, header := range p.AllowedHeaders {
+		headers[strings.ToLower(header)] = true
+	}
+	allowMethods := strings.Join(p.AllowedMethods, ", ")
+	exposeHeaders := strings.Join(p.ExposedHeaders, ", ")
+
+	allowed := func(origin string) bool {
+		origin = strings.ToLower(origin)
+		return slices.ContainsFunc(origins, func(pattern string) bool { return matchOrigin(pattern, origin) })
+	}
+	allowHeaders := func(requested string) bool {
+		if headers["*"] {
+			return true
+		}
+		for _, header := range strings.Split(requested, ",") {
+			if header = strings.ToLower(strings.TrimSpace(header)); header != "" && !headers[header] {
+				return false
+			}
+		}
+		return true
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Add("Vary", "Origin")
+		origin := r.Header.Get("Origin")
+		requestMethod := r.Header.Get("Access-Control-Request-Method")
+		preflight := r.Method == http.MethodOptions && requestMethod != ""
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !preflight {
+			if allowed(origin) {
+				p.allowOrigin(h, origin, anyOrigin)
+				if exposeHeaders != "" {
+					h.Set("Access-Control-Expose-Headers", exposeHeaders)
+				}
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h.Add("Vary", "Access-Control-Request-Method")
+		h.Add("Vary", "Access-Control-Request-Headers")
+		requestHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if allowed(origin) && slices.Contains(p.AllowedMethods, requestMethod) && allowHeaders(requestHeaders) {
+			p.allowOrigin(h, origin, anyOrigin)
+			h.Set("Access-Control-Allow-Methods", allowMethods)
+			if requestHeaders != "" {
+				h.Set("Access-Control-Allow-Headers", requestHeaders)
+			}
+			if p.MaxAge > 0 {
+				h.Set("Access-Control-Max-Age", strconv.Itoa(int(p.MaxAge.Seconds())))
+			}
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (p CORSPolicy) allowOrigin(h http.Header, origin string, anyOrigin bool) {
+	if anyOrigin {
+		h.Set("Access-Control-Allow-Origin", "*")
+	} else {
+		h.Set("Access-Control-Allow-Origin", origin)
+	}
+	if p.AllowCredentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
@@ -0,0 +1,128 @@
+package middleWare
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCORSMiddleware(t *testing.T) {
+	policy := CORSPolicy{
+		AllowedOrigins:   []string{"https://chirpy.app", "https://*.chirpy.dev"},
+		AllowedMethods:   []string{"GET", "POST", "DELETE"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"ETag"},
+		AllowCredentials: true,
+		MaxAge:           time.Hour,
+	}
+	served := false
+	handler := policy.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	send := func(method, origin string, headers map[string]string) *httptest.ResponseRecorder {
+		served = false
+		req := httptest.NewRequest(method, "/api/chirps", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		return send("OPTIONS", origin, map[string]string{
+			"Access-Control-Request-Method":  method,
+			"Access-Control-Request-Headers": headers,
+		})
+	}
+
+	rec := send("GET", "https://chirpy.app", nil)
+	if !served || rec.Header().Get("Access-Control-Allow-Origin") != "https://chirpy.app" ||
+		rec.Header().Get("Access-Control-Allow-Credentials") != "true" || rec.Header().Get("Access-Control-Expose-Headers") != "ETag" {
+		t.Errorf("allowed origin got %v", rec.Header())
+	}
+	if vary := rec.Header().Values("Vary"); len(vary) != 1 || vary[0] != "Origin" {
+		t.Errorf("Vary = %v", vary)
+	}
+
+	for _, origin := range []string{"https://api.chirpy.dev", "https://a.b.chirpy.dev", "HTTPS://API.CHIRPY.DEV"} {
+		if rec := send("GET", origin, nil); rec.Header().Get("Access-Control-Allow-Origin") != origin {
+			t.Errorf("%s wasn't allowed", origin)
+		}
+	}
+	for _, origin := range []string{"https://evil.example", "http://chirpy.app", "https://chirpy.dev", "https://evil.com/.chirpy.dev", "https://chirpy.app.evil.example"} {
+		if rec := send("GET", origin, nil); !served || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("%s was allowed or not served: %v", origin, rec.Header())
+		}
+	}
+	if rec := send("GET", "", nil); !served || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("same-origin request got %v", rec.Header())
+	}
+
+	rec = preflight("https://chirpy.app", "DELETE", "authorization, content-type")
+	if served || rec.Code != http.StatusNoContent {
+		t.Fatalf("preflight was served by the handler or got %d", rec.Code)
+	}
+	want := map[string]string{
+		"Access-Control-Allow-Origin":      "https://chirpy.app",
+		"Access-Control-Allow-Methods":     "GET, POST, DELETE",
+		"Access-Control-Allow-Headers":     "authorization, content-type",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Max-Age":           "3600",
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("preflight %s = %q, want %q", name, got, value)
+		}
+	}
+	if vary := strings.Join(rec.Header().Values("Vary"), ","); vary != "Origin,Access-Control-Request-Method,Access-Control-Request-Headers" {
+		t.Errorf("preflight Vary = %s", vary)
+	}
+
+	for _, tt := range []struct{ origin, method, headers string }{
+		{"https://evil.example", "GET", ""},
+		{"https://chirpy.app", "PATCH", ""},
+		{"https://chirpy.app", "POST", "Authorization, X-Secret"},
+	} {
+		rec := preflight(tt.origin, tt.method, tt.headers)
+		if served || rec.Code != http.StatusNoContent || rec.Header().Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("preflight %+v was allowed: %d %v", tt, rec.Code, rec.Header())
+		}
+	}
+
+	// Plain OPTIONS requests aren't preflights.
+	if send("OPTIONS", "https://chirpy.app", nil); !served {
+		t.Error("OPTIONS without Access-Control-Request-Method wasn't served")
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	policy := CORSPolicy{
+		AllowedOrigins: []string{"*"},
+		AllowedMethods: []string{"GET", "PUT"},
+		AllowedHeaders: []string{"Authorization", "If-Match"},
+	}
+	handler := policy.Middleware(http.NotFoundHandler())
+	req := httptest.NewRequest("OPTIONS", "/api/users", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "Authorization, If-Match")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "*" || rec.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("default preflight got %v", rec.Header())
+	}
+
+	policy.AllowCredentials = true
+	rec = httptest.NewRecorder()
+	policy.Middleware(http.NotFoundHandler()).ServeHTTP(rec, req)
+	if rec.Header().Get("Access-Control-Allow-Origin") != "https://anywhere.example" {
+		t.Errorf("with credentials, Access-Control-Allow-Origin = %q, want the origin", rec.Header().Get("Access-Control-Allow-Origin"))
+	}
+}
@@ -0,0 +1,392 @@
+package middleWare
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+const (
+	// idempotencyMaxKey is the longest Idempotency-Key accepted.
+	idempotencyMaxKey = 255
+	// idempotencyMaxBody bounds the body read to hash it; handlers apply
+	// their own, smaller limits.
+	idempotencyMaxBody = 1 << 20
+	// idempotencyLock is how long a claim blocks retries before its
+	// response is stored, so a crashed request doesn't hold its key for
+	// the whole TTL.
+	idempotencyLock = time.Minute
+)
+
+// IdempotentResponse is a stored response, replayed to retries.
+type IdempotentResponse struct {
+	Status int
+	// Header holds only the headers the handler set.
+	Header http.Header
+	Body   []byte
+}
+
+// IdempotencyRecord is what a store holds for a key. Claim identifies the
+// request that stored it. Response is nil while that request is still being
+// served.
+type IdempotencyRecord struct {
+	RequestHash string
+	Claim       uuid.UUID
+	Response    *IdempotentResponse
+}
+
+// IdempotencyStore keeps the records. Claim stores a new record for key
+// until expires unless an unexpired one exists, which it returns instead
+// with claimed false. Complete and Release only touch the record while it
+// still belongs to claim: once it expires another request may take it over.
+type IdempotencyStore interface {
+	Claim(ctx context.Context, key, requestHash string, expires time.Time) (record IdempotencyRecord, claimed bool, err error)
+	Complete(ctx context.Context, key string, claim uuid.UUID, resp IdempotentResponse, expires time.Time) error
+	Release(ctx context.Context, key string, claim uuid.UUID) error
+}
+
+type idempotencyEntry struct {
+	record  IdempotencyRecord
+	expires time.Time
+}
+
+// MemoryIdempotencyStore keeps records in process memory. It is only
+// correct when a single instance serves all traffic.
+type MemoryIdempotencyStore struct {
+	mu      sync.Mutex
+	entries map[string]*idempotencyEntry
+	pruned  time.Time
+}
+
+func NewMemoryIdempotencyStore() *MemoryIdempotencyStore {
+	return &MemoryIdempotencyStore{
+		entries: map[string]*idempotencyEntry{},
+		pruned:  time.Now(),
+	}
+}
+
+func (s *MemoryIdempotencyStore) Claim(ctx context.Context, key, requestHash string, expires time.Time) (IdempotencyRecord, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	if e, ok := s.entries[key]; ok && now.Before(e.expires) {
+		return e.record, false, nil
+	}
+	record := IdempotencyRecord{RequestHash: requestHash, Claim: uuid.New()}
+	s.entries[key] = &idempotencyEntry{record: record, expires: expires}
+	return record, true, nil
+}
+
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, claim uuid.UUID, resp IdempotentResponse, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.record.Claim == claim {
+		e.record.Response = &resp
+		e.expires = expires
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string, claim uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if e, ok := s.entries[key]; ok && e.record.Claim == claim {
+		delete(s.entries, key)
+	}
+	return nil
+}
+
+// prune drops expired records, at most once a minute.
+func (s *MemoryIdempotencyStore) prune(now time.Time) {
+	if now.Sub(s.pruned) < time.Minute {
+		return
+	}
+	s.pruned = now
+	for key, e := range s.entries {
+		if !now.Before(e.expires) {
+			delete(s.entries, key)
+		}
+	}
+}
+
+// PostgresIdempotencyStore shares records between instances through the
+// idempotency_keys table. A claim is a single upsert that only takes over
+// expired rows, so two instances can't both serve a key. Expiry is judged
+// by the app's clock, which sets expires_at, rather than the database's.
+type PostgresIdempotencyStore struct {
+	Db *database.Queries
+}
+
+func (s *PostgresIdempotencyStore) Claim(ctx context.Context, key, requestHash string, expires time.Time) (IdempotencyRecord, bool, error) {
+	claim := uuid.New()
+	claimed, err := s.Db.ClaimIdempotencyKey(ctx, database.ClaimIdempotencyKeyParams{
+		Key:         key,
+		RequestHash: requestHash,
+		Claim:       claim,
+		CreatedAt:   time.Now(),
+		ExpiresAt:   expires,
+	})
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	if claimed > 0 {
+		return IdempotencyRecord{RequestHash: requestHash, Claim: claim}, true, nil
+	}
+
+	row, err := s.Db.GetIdempotencyKey(ctx, key)
+	if err != nil {
+		return IdempotencyRecord{}, false, err
+	}
+	record := IdempotencyRecord{RequestHash: row.RequestHash, Claim: row.Claim}
+	if row.Status != 0 {
+		var header http.Header
+		if err := json.Unmarshal(row.Headers, &header); err != nil {
+			return IdempotencyRecord{}, false, err
+		}
+		record.Response = &IdempotentResponse{Status: int(row.Status), Header: header, Body: row.Body}
+	}
+	return record, false, nil
+}
+
+func (s *PostgresIdempotencyStore) Complete(ctx context.Context, key string, claim uuid.UUID, resp IdempotentResponse, expires time.Time) error {
+	header, err := json.Marshal(resp.Header)
+	if err != nil {
+		return err
+	}
+	return s.Db.CompleteIdempotencyKey(ctx, database.CompleteIdempotencyKeyParams{
+		Key:       key,
+		Claim:     claim,
+		Status:    int32(resp.Status),
+		Headers:   header,
+		Body:      resp.Body,
+		ExpiresAt: expires,
+	})
+}
+
+func (s *PostgresIdempotencyStore) Release(ctx context.Context, key string, claim uuid.UUID) error {
+	return s.Db.DeleteIdempotencyKey(ctx, database.DeleteIdempotencyKeyParams{Key: key, Claim: claim})
+}
+
+// Prune deletes expired records; an expired key is free to be used again.
+func (s *PostgresIdempotencyStore) Prune(ctx context.Context) error {
+	return s.Db.DeleteExpiredIdempotencyKeys(ctx, time.Now())
+}
+
+// Idempotency replays responses to requests retried with the same
+// Idempotency-Key header, so a client that timed out can safely send a
+// POST again.
+type Idempotency struct {
+	Store IdempotencyStore
+	// Routes are the patterns that honour the header.
+	Routes map[string]bool
+	// TTL is how long a response is kept for retries.
+	TTL    time.Duration
+	JWTKEY string
+	// Canonical, if set, maps a matched pattern to the one Routes is keyed
+	// by, as for RateLimiter.
+	Canonical func(pattern string) string
+}
+
+// validIdempotencyKey accepts 1 to idempotencyMaxKey printable ASCII
+// characters, which covers UUIDs and the other keys clients generate.
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > idempotencyMaxKey {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// scope is whose keys a request's key is checked against: the user of a
+// valid JWT, else whoever holds the Authorization header, such as Polka's
+// API key, so one caller can't replay or block another's keys.
+func (idem *Idempotency) scope(r *http.Request) string {
+	if tokenString, err := auth.GetBearerToken(r.Header); err == nil {
+		if userID, err := auth.ValidateJWT(tokenString, idem.JWTKEY); err == nil {
+			return "user:" + userID.String()
+		}
+	}
+	if authorization := r.Header.Get("Authorization"); authorization != "" {
+		sum := sha256.Sum256([]byte(authorization))
+		return "auth:" + hex.EncodeToString(sum[:])
+	}
+	return "anon"
+}
+
+// idempotencyRequestHash identifies what a request asks for. The response
+// format is part of it so a retry that negotiates msgpack isn't replayed the
+// JSON body stored for the first attempt.
+func idempotencyRequestHash(r *http.Request, body []byte) string {
+	contentType := r.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mediaType
+	}
+	format := utils.NegotiateMediaType(r.Header.Get("Accept"), utils.MediaJSON, utils.MediaMsgPack, utils.MediaCBOR, utils.MediaNDJSON)
+
+	hash := sha256.New()
+	for _, part := range []string{r.URL.Path, contentType, format} {
+		io.WriteString(hash, part)
+		hash.Write([]byte{0})
+	}
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// Middleware stores the first response to each Idempotency-Key on the
+// routes of mux in Routes, per caller, with a hash of the request path,
+// Content-Type, negotiated response format and body. A retry with the same body gets the stored response with an
+// Idempotent-Replayed header; a different body is rejected with 422, and a
+// retry while the first request is still running with 409. Server errors
+// aren't stored, so they can be retried. Requests without the header pass
+// through, as do all requests if the store fails.
+func (idem *Idempotency) Middleware(mux RouteMatcher, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if idem.Canonical != nil {
+			pattern = idem.Canonical(pattern)
+		}
+		values, sent := r.Header["Idempotency-Key"]
+		if !idem.Routes[pattern] || !sent {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(values) != 1 || !validIdempotencyKey(values[0]) {
+			utils.RespondWithError(w, r, utils.BadRequest("Idempotency-Key must be one value of 1 to 255 printable ASCII characters"))
+			return
+		}
+
+		body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, idempotencyMaxBody))
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				utils.RespondWithError(w, r, utils.NewError(http.StatusRequestEntityTooLarge, utils.CodeBodyTooLarge, "Request body is too large"))
+			} else {
+				utils.RespondWithError(w, r, utils.BadRequest("Request body could not be read"))
+			}
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := idempotencyRequestHash(r, body)
+
+		// Records outlive the request, which may be cancelled by a client
+		// that gave up on it.
+		ctx := context.WithoutCancel(r.Context())
+		log := logging.FromContext(r.Context())
+		key := pattern + "|" + idem.scope(r) + "|" + values[0]
+		record, claimed, err := idem.Store.Claim(ctx, key, requestHash, time.Now().Add(idempotencyLock))
+		if err != nil {
+			log.Error("idempotency store", "err", err)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		switch {
+		case !claimed && record.RequestHash != requestHash:
+			utils.RespondWithError(w, r, utils.NewError(http.StatusUnprocessableEntity, utils.CodeIdempotencyReused,
+				"Idempotency-Key was already used for a different request"))
+			return
+		case !claimed && record.Response == nil:
+			w.Header().Set("Retry-After", "1")
+			utils.RespondWithError(w, r, utils.NewError(http.StatusConflict, utils.CodeIdempotencyInUse,
+				"A request with this Idempotency-Key is still being processed"))
+			return
+		case !claimed:
+			h := w.Header()
+			for name, values := range record.Response.Header {
+				h[name] = values
+			}
+			h.Set("Idempotent-Replayed", "true")
+			w.WriteHeader(record.Response.Status)
+			w.Write(record.Response.Body)
+			return
+		}
+
+		rec := &idempotencyRecorder{ResponseWriter: w, before: w.Header().Clone()}
+		completed := false
+		defer func() {
+			if completed {
+				return
+			}
+			// Server errors and panics leave the key free for a retry.
+			if err := idem.Store.Release(ctx, key, record.Claim); err != nil {
+				log.Error("idempotency store", "err", err)
+			}
+		}()
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.WriteHeader(http.StatusOK)
+		}
+		if rec.status >= http.StatusInternalServerError {
+			return
+		}
+		resp := IdempotentResponse{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+		if err := idem.Store.Complete(ctx, key, record.Claim, resp, time.Now().Add(idem.TTL)); err != nil {
+			log.Error("idempotency store", "err", err)
+			return
+		}
+		completed = true
+	})
+}
+
+// idempotencyRecorder passes a response through while keeping a copy of
+// its status, body and the headers the handler changed.
+type idempotencyRecorder struct {
+	http.ResponseWriter
+	before http.Header
+
+	status int
+	header http.Header
+	body   bytes.Buffer
+}
+
+func (rec *idempotencyRecorder) WriteHeader(code int) {
+	if code < http.StatusOK || rec.status != 0 {
+		rec.ResponseWriter.WriteHeader(code)
+		return
+	}
+	rec.status = code
+	rec.header = http.Header{}
+	for name, values := range rec.Header() {
+		if !slices.Equal(values, rec.before[name]) {
+			rec.header[name] = slices.Clone(values)
+		}
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *idempotencyRecorder) Write(p []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+	rec.body.Write(p)
+	return rec.ResponseWriter.Write(p)
+}
+
+func (rec *idempotencyRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,221 @@
+package middleWare
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+func TestIdempotencyMiddleware(t *testing.T) {
+	created := 0
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		created++
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("reading body: %v", err)
+		}
+		w.Header().Set("Location", "/api/chirps/"+strconv.Itoa(created))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"n":` + strconv.Itoa(created) + `,"body":` + strconv.Quote(string(body)) + `}`))
+	})
+	mux.HandleFunc("POST /api/login", func(w http.ResponseWriter, r *http.Request) {
+		created++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	idem := &Idempotency{
+		Store:  NewMemoryIdempotencyStore(),
+		Routes: map[string]bool{"POST /api/chirps": true},
+		TTL:    time.Hour,
+		JWTKEY: "test-secret-key",
+	}
+	handler := idem.Middleware(mux, mux)
+
+	post := func(path, key, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		// Headers set by outer middleware aren't part of the stored response.
+		rec.Header().Set("RateLimit-Remaining", "9")
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	alice, err := auth.MakeJWT(uuid.New(), "test-secret-key", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := auth.MakeJWT(uuid.New(), "test-secret-key", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first := post("/api/chirps", "k1", alice, "hello")
+	if first.Code != http.StatusCreated || first.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("first request got %d %v", first.Code, first.Header())
+	}
+	retry := post("/api/chirps", "k1", alice, "hello")
+	if retry.Code != http.StatusCreated || retry.Body.String() != first.Body.String() ||
+		retry.Header().Get("Location") != "/api/chirps/1" || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry got %d %v %s", retry.Code, retry.Header(), retry.Body)
+	}
+	if created != 1 {
+		t.Errorf("handler ran %d times, want 1", created)
+	}
+	if stored := idem.Store.(*MemoryIdempotencyStore).entries; len(stored) != 1 {
+		t.Fatalf("%d records", len(stored))
+	} else {
+		for _, e := range stored {
+			if _, ok := e.record.Response.Header["Ratelimit-Remaining"]; ok {
+				t.Errorf("stored headers set outside the handler: %v", e.record.Response.Header)
+			}
+		}
+	}
+
+	rec := post("/api/chirps", "k1", alice, "goodbye")
+	if rec.Code != http.StatusUnprocessableEntity || !strings.Contains(rec.Body.String(), utils.CodeIdempotencyReused) {
+		t.Errorf("reused key got %d %s", rec.Code, rec.Body)
+	}
+
+	// The same body sent as another type, or asking for another response
+	// format, is a different request too.
+	for name, value := range map[string]string{"Content-Type": "text/plain", "Accept": utils.MediaMsgPack} {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader("hello"))
+		req.Header.Set("Idempotency-Key", "k1")
+		req.Header.Set("Authorization", "Bearer "+alice)
+		req.Header.Set(name, value)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("retry with %s: %s got %d %s", name, value, rec.Code, rec.Body)
+		}
+	}
+	// Parameters and case don't change the Content-Type.
+	req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader("hello"))
+	req.Header.Set("Idempotency-Key", "k2")
+	req.Header.Set("Authorization", "Bearer "+alice)
+	req.Header.Set("Content-Type", "application/json")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	req = httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader("hello"))
+	req.Header.Set("Idempotency-Key", "k2")
+	req.Header.Set("Authorization", "Bearer "+alice)
+	req.Header.Set("Content-Type", "Application/JSON; charset=utf-8")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if rec.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry with charset got %d %v", rec.Code, rec.Header())
+	}
+
+	// Keys are per user, so another user's key never replays.
+	if rec := post("/api/chirps", "k1", bob, "hello"); rec.Code != http.StatusCreated || rec.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("another user's request got %d %v", rec.Code, rec.Header())
+	}
+	// Without the header, or on other routes, nothing is stored.
+	post("/api/chirps", "", alice, "hello")
+	post("/api/chirps", "", alice, "hello")
+	post("/api/login", "k1", alice, "")
+	post("/api/login", "k1", alice, "")
+	if created != 7 {
+		t.Errorf("handler ran %d times, want 7", created)
+	}
+
+	for _, key := range []string{strings.Repeat("k", 256), "bad\nkey"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/chirps", strings.NewReader("hello"))
+		req.Header["Idempotency-Key"] = []string{key}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("key %.10q got %d", key, rec.Code)
+		}
+	}
+}
+
+func TestIdempotencyServerErrorsAndInFlight(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	calls := 0
+	var inFlight func()
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/users", func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if inFlight != nil {
+			inFlight()
+		}
+		w.WriteHeader(status)
+	})
+	idem := &Idempotency{
+		Store:  NewMemoryIdempotencyStore(),
+		Routes: map[string]bool{"POST /api/users": true},
+		TTL:    time.Hour,
+	}
+	handler := idem.Middleware(mux, mux)
+	post := func() *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/api/users", strings.NewReader(`{}`))
+		req.Header.Set("Idempotency-Key", "signup")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A server error isn't stored, so the retry runs the handler again.
+	post()
+	status = http.StatusCreated
+	if rec := post(); rec.Code != http.StatusCreated || calls != 2 {
+		t.Errorf("retry after a 503 got %d after %d calls", rec.Code, calls)
+	}
+
+	// A retry while the first request is running is told to wait.
+	idem.Store = NewMemoryIdempotencyStore()
+	var concurrent *httptest.ResponseRecorder
+	inFlight = func() {
+		inFlight = nil
+		concurrent = post()
+	}
+	post()
+	if concurrent == nil || concurrent.Code != http.StatusConflict || concurrent.Header().Get("Retry-After") == "" {
+		t.Errorf("concurrent retry got %+v", concurrent)
+	}
+}
+
+func TestMemoryIdempotencyStoreExpiry(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryIdempotencyStore()
+	first, claimed, _ := store.Claim(ctx, "k", "a", time.Now().Add(time.Minute))
+	if !claimed {
+		t.Fatal("first claim failed")
+	}
+	if err := store.Complete(ctx, "k", first.Claim, IdempotentResponse{Status: http.StatusCreated}, time.Now().Add(-time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	second, claimed, _ := store.Claim(ctx, "k", "b", time.Now().Add(time.Minute))
+	if !claimed || second.RequestHash != "b" || second.Response != nil || second.Claim == first.Claim {
+		t.Errorf("expired key: claimed = %v, record = %+v", claimed, second)
+	}
+
+	// The first request's claim is gone, so it can't touch the new record.
+	store.Complete(ctx, "k", first.Claim, IdempotentResponse{Status: http.StatusOK}, time.Now().Add(time.Hour))
+	store.Release(ctx, "k", first.Claim)
+	record, claimed, _ := store.Claim(ctx, "k", "b", time.Now().Add(time.Minute))
+	if claimed || record.Claim != second.Claim || record.Response != nil {
+		t.Errorf("stale claim changed the record: claimed = %v, record = %+v", claimed, record)
+	}
+
+	store.Release(ctx, "k", second.Claim)
+	if _, claimed, _ := store.Claim(ctx, "k", "c", time.Now().Add(time.Minute)); !claimed {
+		t.Error("released key couldn't be claimed")
+	}
+}
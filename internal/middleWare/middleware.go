@@ -3,41 +3,221 @@ package middleWare
 import (
 	"bytes"
 	"io"
-	"log"
+	"log/slog"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/tracing"
 	"github.com/k3vwdd/chirpyWS/internal/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type ApiConfig struct {
 	*types.ApiConfig
 }
 
-func MiddlewareLogging(next http.Handler) http.Handler {
+// maxLoggedBody caps how much of a request body is kept for debug logging.
+const maxLoggedBody = 4096
+
+// statusRecorder remembers the status code and size of a response.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	n, err := rec.ResponseWriter.Write(b)
+	rec.bytes += n
+	return n, err
+}
+
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// cappedBuffer keeps at most limit bytes and silently drops the rest.
+type cappedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	if room := b.limit - b.Len(); room > 0 {
+		if len(p) > room {
+			b.Buffer.Write(p[:room])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// MiddlewareLogging assigns every request an id (taken from X-Request-ID when
+// the client sends one), puts a logger carrying that id in the request
+// context and writes one access log line per request. Request bodies are only
+// logged at debug level and always pass through the redaction policy.
+func MiddlewareLogging(logger *slog.Logger, policy logging.RedactionPolicy, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// read the data while simultaneously writing it to a buffer for logging.
-		// This allows you to pass the original stream to the next handler without needing to reassemble it completely.
-		var buff bytes.Buffer
-		tee := io.TeeReader(r.Body, &buff)
-		r.Body = io.NopCloser(tee)
-		next.ServeHTTP(w, r)
-		log.Printf("Request body: %s\n", buff.String())
-		//bodyBytes, err := io.ReadAll(r.Body)
-		//if err != nil {
-		//    http.Error(w, "Failed to read request body", http.StatusInternalServerError)
-		//    return
-		//}
-		//log.Printf("Request body: %s\n", string(bodyBytes))
-		//// reset the body and Put it back so the handler can read it again. 'No operation' a nil 'Close'
-		//// stuff the request body back with the input
-		//r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-		//next.ServeHTTP(w, r)
+		start := time.Now()
+
+		requestID := r.Header.Get("X-Request-ID")
+		if requestID == "" || len(requestID) > 128 {
+			requestID = logging.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", requestID)
+
+		info := &logging.RequestInfo{ID: requestID}
+		r = r.WithContext(logging.WithRequest(r.Context(), logger, info))
+
+		debug := logger.Enabled(r.Context(), slog.LevelDebug)
+		body := &cappedBuffer{limit: maxLoggedBody}
+		if debug && r.Body != nil {
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.TeeReader(r.Body, body), r.Body}
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		route := info.Route()
+		if route == "" {
+			route = r.Pattern
+		}
+		attrs := []slog.Attr{
+			slog.String("method", r.Method),
+			slog.String("route", route),
+			slog.String("path", r.URL.Path),
+			slog.Int("status", rec.status),
+			slog.Float64("duration_ms", float64(time.Since(start).Microseconds())/1000),
+			slog.Int("bytes", rec.bytes),
+		}
+		if userID := info.UserID(); userID != uuid.Nil {
+			attrs = append(attrs, slog.String("user_id", userID.String()))
+		}
+		if traceID := info.TraceID(); traceID != "" {
+			attrs = append(attrs, slog.String("trace_id", traceID))
+		}
+		if debug && body.Len() > 0 {
+			attrs = append(attrs, slog.Any("body", policy.RedactJSON(body.Bytes())))
+		}
+
+		level := slog.LevelInfo
+		switch {
+		case rec.status >= 500:
+			level = slog.LevelError
+		case rec.status >= 400:
+			level = slog.LevelWarn
+		}
+		logging.FromContext(r.Context()).LogAttrs(r.Context(), level, "request", attrs...)
 	})
 }
 
 func (cfg *ApiConfig) MiddlewareMetricsInc(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		cfg.FileServerHits.Add(1)
+		cfg.Metrics.FileServerHits.Inc()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// MiddlewareRequestMetrics counts and times every request by the route
+// pattern it was served under, so path parameters don't explode the number
+// of series.
+func MiddlewareRequestMetrics(m *metrics.Metrics, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.RequestsInFlight.Inc()
+		defer m.RequestsInFlight.Dec()
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		route := r.Pattern
+		if route == "" {
+			route = "unmatched"
+		}
+
+		m.RequestsTotal.WithLabelValues(r.Method, route, strconv.Itoa(status)).Inc()
+		m.RequestDuration.WithLabelValues(r.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// MiddlewareRecordRoute goes innermost, around the mux, and records the
+// pattern it matched on the request's logging.RequestInfo. Middleware
+// further out may hold an earlier copy of the request, whose Pattern the
+// mux never sets.
+func MiddlewareRecordRoute(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		next.ServeHTTP(w, r)
+		logging.SetRoute(r.Context(), r.Pattern)
+	})
+}
+
+// MiddlewareTracing starts the server span for a request, continuing the
+// caller's trace when it sent a traceparent header. The span is renamed to
+// the route pattern once the mux has matched it.
+func MiddlewareTracing(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+		ctx, span := tracing.Tracer().Start(ctx, r.Method,
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				attribute.String("http.request.method", r.Method),
+				attribute.String("url.path", r.URL.Path),
+				attribute.String("client.address", r.RemoteAddr),
+			),
+		)
+		defer span.End()
+
+		if span.SpanContext().IsValid() {
+			traceID := span.SpanContext().TraceID().String()
+			ctx = logging.WithLogger(ctx, logging.FromContext(ctx).With("trace_id", traceID))
+			logging.SetTraceID(ctx, traceID)
+		}
+
+		rec := &statusRecorder{ResponseWriter: w}
+		r = r.WithContext(ctx)
+		next.ServeHTTP(rec, r)
+
+		status := rec.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+		if r.Pattern != "" {
+			span.SetName(r.Pattern)
+			span.SetAttributes(attribute.String("http.route", r.Pattern))
+		}
+		span.SetAttributes(attribute.Int("http.response.status_code", status))
+		if status >= 500 {
+			span.SetStatus(codes.Error, http.StatusText(status))
+		}
 	})
 }
@@ -0,0 +1,328 @@
+package middleWare
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// RateLimitRule is a token bucket: Limit requests per Window, refilled
+// continuously. RedLimit replaces Limit for Chirpy Red members when set.
+type RateLimitRule struct {
+	Limit    int
+	RedLimit int
+	Window   time.Duration
+}
+
+// RateLimitResult describes the bucket after a request has been counted.
+type RateLimitResult struct {
+	Allowed   bool
+	Remaining float64
+}
+
+// RateLimitStore keeps the buckets. burst is the bucket size and rate the
+// refill in tokens per second.
+type RateLimitStore interface {
+	Take(ctx context.Context, key string, burst, rate float64) (RateLimitResult, error)
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// MemoryRateLimitStore keeps buckets in process memory. It is only correct
+// when a single instance serves all traffic.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{
+		buckets: map[string]*bucket{},
+		pruned:  time.Now(),
+	}
+}
+
+func (s *MemoryRateLimitStore) Take(ctx context.Context, key string, burst, rate float64) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.prune(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, updated: now}
+		s.buckets[key] = b
+	}
+
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.updated).Seconds()*rate)
+	b.updated = now
+	if b.tokens < 1 {
+		return RateLimitResult{Allowed: false, Remaining: b.tokens}, nil
+	}
+	b.tokens--
+	return RateLimitResult{Allowed: true, Remaining: b.tokens}, nil
+}
+
+// prune drops buckets that haven't been touched for an hour, at most once a minute.
+func (s *MemoryRateLimitStore) prune(now time.Time) {
+	if now.Sub(s.pruned) < time.Minute {
+		return
+	}
+	s.pruned = now
+	for key, b := range s.buckets {
+		if now.Sub(b.updated) > time.Hour {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+// PostgresRateLimitStore shares buckets between instances through the
+// rate_limit_buckets table. Each take is a single atomic upsert.
+type PostgresRateLimitStore struct {
+	Db *database.Queries
+}
+
+func (s *PostgresRateLimitStore) Take(ctx context.Context, key string, burst, rate float64) (RateLimitResult, error) {
+	row, err := s.Db.TakeRateLimitToken(ctx, database.TakeRateLimitTokenParams{
+		Key:   key,
+		Burst: burst,
+		Rate:  rate,
+	})
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+	return RateLimitResult{Allowed: row.Allowed, Remaining: row.Tokens}, nil
+}
+
+// Prune deletes buckets idle for longer than maxAge; a missing bucket is the
+// same as a full one.
+func (s *PostgresRateLimitStore) Prune(ctx context.Context, maxAge time.Duration) error {
+	return s.Db.DeleteStaleRateLimitBuckets(ctx, time.Now().Add(-maxAge))
+}
+
+// RouteMatcher is satisfied by *http.ServeMux and lets the limiter find the
+// pattern a request will be routed to.
+type RouteMatcher interface {
+	Handler(r *http.Request) (http.Handler, string)
+}
+
+type RateLimiter struct {
+	Store  RateLimitStore
+	Rules  map[string]RateLimitRule
+	JWTKEY string
+	// TrustedProxies lists the networks whose X-Forwarded-For header is
+	// believed. Requests from anywhere else are keyed by RemoteAddr.
+	TrustedProxies []netip.Prefix
+	// IsChirpyRed reports whether a user gets the higher limits.
+	IsChirpyRed func(ctx context.Context, userID uuid.UUID) (bool, error)
+	// Canonical, if set, maps a matched pattern to the one Rules and the
+	// buckets are keyed by, so aliases of a route share its limit.
+	Canonical func(pattern string) string
+
+	redMu     sync.Mutex
+	redCache  map[uuid.UUID]redEntry
+	redPruned time.Time
+}
+
+type redEntry struct {
+	red     bool
+	expires time.Time
+}
+
+func (rl *RateLimiter) trusted(addr netip.Addr) bool {
+	for _, prefix := range rl.TrustedProxies {
+		if prefix.Contains(addr.Unmap()) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientIP returns the address of the client. X-Forwarded-For is walked from
+// the right, skipping trusted proxies, so a client can't spoof its address by
+// sending the header itself.
+func (rl *RateLimiter) ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !rl.trusted(remote) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	client := remote
+	for i := len(hops) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		client = addr
+		if !rl.trusted(addr) {
+			break
+		}
+	}
+	return client.Unmap().String()
+}
+
+func (rl *RateLimiter) isRed(ctx context.Context, userID uuid.UUID) bool {
+	if rl.IsChirpyRed == nil {
+		return false
+	}
+
+	rl.redMu.Lock()
+	entry, ok := rl.redCache[userID]
+	rl.redMu.Unlock()
+	if ok && time.Now().Before(entry.expires) {
+		return entry.red
+	}
+
+	red, err := rl.IsChirpyRed(ctx, userID)
+	if err != nil {
+		return false
+	}
+
+	now := time.Now()
+	rl.redMu.Lock()
+	if rl.redCache == nil {
+		rl.redCache = map[uuid.UUID]redEntry{}
+	}
+	rl.pruneRed(now)
+	rl.redCache[userID] = redEntry{red: red, expires: now.Add(5 * time.Minute)}
+	rl.redMu.Unlock()
+	return red
+}
+
+// pruneRed drops expired Chirpy Red lookups, at most once a minute. The
+// caller holds redMu.
+func (rl *RateLimiter) pruneRed(now time.Time) {
+	if now.Sub(rl.redPruned) < time.Minute {
+		return
+	}
+	rl.redPruned = now
+	for userID, e := range rl.redCache {
+		if !now.Before(e.expires) {
+			delete(rl.redCache, userID)
+		}
+	}
+}
+
+// rateLimitOutcome is a request counted against its rule.
+type rateLimitOutcome struct {
+	limit  int
+	window time.Duration
+	rate   float64
+	result RateLimitResult
+}
+
+// take counts a request to pattern by userID, or by clientIP when userID is
+// uuid.Nil. ok is false when pattern has no rule or the store failed, and the
+// request goes through uncounted.
+func (rl *RateLimiter) take(ctx context.Context, pattern, clientIP string, userID uuid.UUID) (rateLimitOutcome, bool) {
+	rule, ok := rl.Rules[pattern]
+	if !ok || rule.Limit <= 0 || rule.Window <= 0 {
+		return rateLimitOutcome{}, false
+	}
+
+	limit := rule.Limit
+	key := pattern + "|ip:" + clientIP
+	if userID != uuid.Nil {
+		key = pattern + "|user:" + userID.String()
+		if rule.RedLimit > 0 && rl.isRed(ctx, userID) {
+			limit = rule.RedLimit
+		}
+	}
+
+	rate := float64(limit) / rule.Window.Seconds()
+	result, err := rl.Store.Take(ctx, key, float64(limit), rate)
+	if err != nil {
+		logging.FromContext(ctx).Error("rate limit store", "err", err)
+		return rateLimitOutcome{}, false
+	}
+	return rateLimitOutcome{limit: limit, window: rule.Window, rate: rate, result: result}, true
+}
+
+// retryAfter is how many seconds until the bucket has a token again.
+func (o rateLimitOutcome) retryAfter() int {
+	return int(math.Ceil((1 - o.result.Remaining) / o.rate))
+}
+
+func rateLimited() *utils.Error {
+	return utils.NewError(http.StatusTooManyRequests, utils.CodeRateLimited, "Too many requests")
+}
+
+// Limit counts a call that doesn't go through Middleware, such as a GraphQL
+// mutation or an RPC, against the rule of the REST route pattern it stands
+// for, sharing that route's buckets. Callers are keyed by userID, or by
+// clientIP when userID is uuid.Nil. It returns a 429 *utils.Error once the
+// bucket is empty.
+func (rl *RateLimiter) Limit(ctx context.Context, pattern, clientIP string, userID uuid.UUID) error {
+	outcome, ok := rl.take(ctx, pattern, clientIP, userID)
+	if ok && !outcome.result.Allowed {
+		return rateLimited()
+	}
+	return nil
+}
+
+// Middleware limits requests to the routes of mux that have a rule. Callers
+// with a valid JWT are limited per user, everyone else per client IP. If the
+// store fails the request is let through rather than taking the API down.
+func (rl *RateLimiter) Middleware(mux RouteMatcher, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		if rl.Canonical != nil {
+			pattern = rl.Canonical(pattern)
+		}
+		if _, ok := rl.Rules[pattern]; !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var userID uuid.UUID
+		if tokenString, err := auth.GetBearerToken(r.Header); err == nil {
+			if id, err := auth.ValidateJWT(tokenString, rl.JWTKEY); err == nil {
+				userID = id
+			}
+		}
+		outcome, ok := rl.take(r.Context(), pattern, rl.ClientIP(r), userID)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		limit, result := outcome.limit, outcome.result
+		remaining := int(math.Max(0, math.Floor(result.Remaining)))
+		reset := int(math.Ceil((float64(limit) - result.Remaining) / outcome.rate))
+		w.Header().Set("RateLimit-Policy", strconv.Itoa(limit)+";w="+strconv.Itoa(int(outcome.window.Seconds())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(reset))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(outcome.retryAfter()))
+			utils.RespondWithError(w, r, rateLimited())
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,145 @@
+package middleWare
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+)
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+	mux.HandleFunc("GET /api/chirps", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("POST /api/v2/chirps", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	})
+
+	limiter := &RateLimiter{
+		Store:  NewMemoryRateLimitStore(),
+		JWTKEY: "test-secret-key",
+		Rules: map[string]RateLimitRule{
+			"POST /api/chirps": {Limit: 2, Window: time.Minute},
+		},
+		Canonical: func(pattern string) string {
+			return strings.Replace(pattern, "/api/v2/", "/api/", 1)
+		},
+	}
+	handler := limiter.Middleware(mux, mux)
+
+	postTo := func(path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.RemoteAddr = "203.0.113.7:4000"
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+	post := func(token string) *httptest.ResponseRecorder {
+		return postTo("/api/chirps", token)
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := post(""); rec.Code != http.StatusCreated {
+			t.Fatalf("request %d: got status %d, want %d", i, rec.Code, http.StatusCreated)
+		}
+	}
+
+	rec := post("")
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+	if rec.Header().Get("RateLimit-Remaining") != "0" || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("missing rate limit headers: %v", rec.Header())
+	}
+
+	// an alias of the route shares its bucket
+	if rec := postTo("/api/v2/chirps", ""); rec.Code != http.StatusTooManyRequests {
+		t.Errorf("aliased route: got status %d, want %d", rec.Code, http.StatusTooManyRequests)
+	}
+
+	// an authenticated user from the same address has a bucket of their own
+	token, err := auth.MakeJWT(uuid.New(), "test-secret-key", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT() error = %v", err)
+	}
+	if rec := post(token); rec.Code != http.StatusCreated {
+		t.Errorf("authenticated request: got status %d, want %d", rec.Code, http.StatusCreated)
+	}
+
+	// routes without a rule are never limited
+	for i := 0; i < 5; i++ {
+		req := httptest.NewRequest(http.MethodGet, "/api/chirps", nil)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || rec.Header().Get("RateLimit-Limit") != "" {
+			t.Fatalf("unlimited route: got status %d headers %v", rec.Code, rec.Header())
+		}
+	}
+}
+
+func TestRedCachePrunes(t *testing.T) {
+	lookups := 0
+	limiter := &RateLimiter{IsChirpyRed: func(ctx context.Context, userID uuid.UUID) (bool, error) {
+		lookups++
+		return true, nil
+	}}
+	alice, bob := uuid.New(), uuid.New()
+	if !limiter.isRed(context.Background(), alice) || !limiter.isRed(context.Background(), alice) || lookups != 1 {
+		t.Fatalf("alice looked up %d times, want once", lookups)
+	}
+
+	// Let alice's entry expire and the last prune fall over a minute ago.
+	limiter.redCache[alice] = redEntry{red: true, expires: time.Now().Add(-time.Second)}
+	limiter.redPruned = time.Now().Add(-2 * time.Minute)
+	limiter.isRed(context.Background(), bob)
+	if _, ok := limiter.redCache[alice]; ok || len(limiter.redCache) != 1 {
+		t.Errorf("cache after pruning = %v, want only bob", limiter.redCache)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	limiter := &RateLimiter{TrustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.168.1.1/32"),
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:4000", "", "203.0.113.7"},
+		{"untrusted proxy is ignored", "203.0.113.7:4000", "198.51.100.1", "203.0.113.7"},
+		{"trusted proxy", "10.1.2.3:4000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed left entry", "10.1.2.3:4000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chain of trusted proxies", "10.1.2.3:4000", "198.51.100.1, 192.168.1.1, 10.9.9.9", "198.51.100.1"},
+		{"garbage header", "10.1.2.3:4000", "not-an-ip", "10.1.2.3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := limiter.ClientIP(req); got != tt.want {
+				t.Errorf("ClientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
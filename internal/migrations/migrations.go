@@ -0,0 +1,139 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+
+	"github.com/k3vwdd/chirpyWS/sql/schema"
+	"github.com/pressly/goose/v3"
+)
+
+// lockID is the Postgres advisory lock every Chirpy instance takes before
+// touching the schema, so two instances starting together don't race.
+const lockID = 0x63686972 // "chir"
+
+// Runner applies the embedded goose migrations. It uses goose's own
+// goose_db_version table, so databases migrated by hand with the goose CLI
+// carry on where they left off.
+type Runner struct {
+	db       *sql.DB
+	provider *goose.Provider
+}
+
+func New(db *sql.DB) (*Runner, error) {
+	return NewFromFS(db, schema.FS)
+}
+
+// NewFromFS is New with a different set of migrations, for tests.
+func NewFromFS(db *sql.DB, fsys fs.FS) (*Runner, error) {
+	provider, err := goose.NewProvider(goose.DialectPostgres, db, fsys)
+	if err != nil {
+		return nil, err
+	}
+	return &Runner{db: db, provider: provider}, nil
+}
+
+// withLock runs fn while holding the advisory lock on a dedicated
+// connection. The lock is released when that session ends, even if the
+// unlock itself fails.
+func (r *Runner) withLock(ctx context.Context, fn func() error) error {
+	conn, err := r.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", lockID); err != nil {
+		return fmt.Errorf("taking migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", lockID)
+
+	return fn()
+}
+
+// Expected is the newest migration compiled into the binary.
+func (r *Runner) Expected() int64 {
+	sources := r.provider.ListSources()
+	if len(sources) == 0 {
+		return 0
+	}
+	return sources[len(sources)-1].Version
+}
+
+// Version is the newest migration applied to the database.
+func (r *Runner) Version(ctx context.Context) (int64, error) {
+	return r.provider.GetDBVersion(ctx)
+}
+
+// Up applies every pending migration.
+func (r *Runner) Up(ctx context.Context) ([]*goose.MigrationResult, error) {
+	var results []*goose.MigrationResult
+	err := r.withLock(ctx, func() (err error) {
+		results, err = r.provider.Up(ctx)
+		return err
+	})
+	return results, err
+}
+
+// Down rolls back the newest applied migration.
+func (r *Runner) Down(ctx context.Context) (*goose.MigrationResult, error) {
+	var result *goose.MigrationResult
+	err := r.withLock(ctx, func() (err error) {
+		result, err = r.provider.Down(ctx)
+		return err
+	})
+	return result, err
+}
+
+// Redo rolls back the newest migration and applies it again, without
+// letting another instance in between.
+func (r *Runner) Redo(ctx context.Context) ([]*goose.MigrationResult, error) {
+	var results []*goose.MigrationResult
+	err := r.withLock(ctx, func() error {
+		down, err := r.provider.Down(ctx)
+		if err != nil {
+			return err
+		}
+		results = append(results, down)
+		up, err := r.provider.UpByOne(ctx)
+		if err != nil {
+			return err
+		}
+		results = append(results, up)
+		return nil
+	})
+	return results, err
+}
+
+// Status lists every embedded migration and whether it has been applied.
+func (r *Runner) Status(ctx context.Context) ([]*goose.MigrationStatus, error) {
+	return r.provider.Status(ctx)
+}
+
+// VersionError means the database and the binary disagree on the schema.
+type VersionError struct {
+	Database int64
+	Expected int64
+}
+
+func (e *VersionError) Error() string {
+	if e.Database < e.Expected {
+		return fmt.Sprintf("database schema is at version %d but this build needs %d; run migrations (--migrate)", e.Database, e.Expected)
+	}
+	return fmt.Sprintf("database schema is at version %d, newer than the %d this build knows; deploy a newer build or roll back", e.Database, e.Expected)
+}
+
+// Check returns a *VersionError unless the database is at exactly the
+// version the binary expects.
+func (r *Runner) Check(ctx context.Context) error {
+	version, err := r.Version(ctx)
+	if err != nil {
+		return err
+	}
+	if version != r.Expected() {
+		return &VersionError{Database: version, Expected: r.Expected()}
+	}
+	return nil
+}
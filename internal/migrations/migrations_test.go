@@ -0,0 +1,54 @@
+package migrations
+
+import (
+	"database/sql"
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/k3vwdd/chirpyWS/sql/schema"
+	_ "github.com/lib/pq"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	// sql.Open doesn't connect, which is all loading migrations needs.
+	db, err := sql.Open("postgres", "postgres://localhost/chirpy?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	runner, err := New(db)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+
+	files, err := fs.Glob(schema.FS, "*.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	if got := runner.Expected(); got != int64(len(files)) {
+		t.Errorf("Expected() = %d, want %d: migrations should be numbered without gaps", got, len(files))
+	}
+
+	for _, file := range files {
+		data, _ := fs.ReadFile(schema.FS, file)
+		if !strings.Contains(string(data), "-- +goose Down") {
+			t.Errorf("%s has no Down section, so it can't be rolled back", file)
+		}
+	}
+}
+
+func TestVersionError(t *testing.T) {
+	behind := (&VersionError{Database: 8, Expected: 10}).Error()
+	if !strings.Contains(behind, "--migrate") {
+		t.Errorf("behind error should suggest --migrate: %s", behind)
+	}
+	ahead := (&VersionError{Database: 11, Expected: 10}).Error()
+	if strings.Contains(ahead, "--migrate") {
+		t.Errorf("ahead error shouldn't suggest --migrate: %s", ahead)
+	}
+}
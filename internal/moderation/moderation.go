@@ -0,0 +1,278 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+)
+
+const (
+	KindWord  = "word"
+	KindRegex = "regex"
+
+	ActionMask   = "mask"
+	ActionReject = "reject"
+	ActionHold   = "hold"
+)
+
+const maskText = "****"
+
+// RuleSource is the part of the database the engine needs to (re)load its rules.
+type RuleSource interface {
+	ListEnabledModerationRules(ctx context.Context) ([]database.ModerationRule, error)
+}
+
+// Hit records a single rule match inside a chirp body.
+type Hit struct {
+	RuleID  uuid.UUID
+	Matched string
+	Action  string
+	start   int
+	end     int
+}
+
+// Result is the outcome of running a chirp body through the engine.
+// Action is the most severe action of all hits, or "" when nothing matched.
+type Result struct {
+	Body   string
+	Action string
+	Hits   []Hit
+}
+
+type compiledRule struct {
+	id     uuid.UUID
+	action string
+	re     *regexp.Regexp
+}
+
+// Engine keeps an in-memory copy of the enabled moderation rules.
+// Word rules are stored folded through the same normalization as chirp
+// bodies; regex rules run case-insensitively against the body after NFKC
+// with invisible characters stripped, so digits and symbols in them still
+// match.
+type Engine struct {
+	source RuleSource
+
+	mu    sync.RWMutex
+	words map[string]compiledRule
+	regex []compiledRule
+}
+
+func NewEngine(source RuleSource) *Engine {
+	return &Engine{
+		source: source,
+		words:  map[string]compiledRule{},
+	}
+}
+
+// Validate checks that a rule can be compiled before it is stored.
+func Validate(kind, pattern, action string) error {
+	if pattern == "" {
+		return errors.New("pattern is required")
+	}
+
+	switch action {
+	case ActionMask, ActionReject, ActionHold:
+	default:
+		return fmt.Errorf("unknown action %q", action)
+	}
+
+	switch kind {
+	case KindWord:
+		folded := foldString(pattern)
+		if folded == "" {
+			return errors.New("pattern is required")
+		}
+		for _, char := range folded {
+			if !unicode.IsLetter(char) {
+				return errors.New("word patterns may only contain letters")
+			}
+		}
+	case KindRegex:
+		if _, err := regexp.Compile("(?i)" + pattern); err != nil {
+			return fmt.Errorf("invalid regex: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown kind %q", kind)
+	}
+
+	return nil
+}
+
+// Reload replaces the cached rules with the enabled rules from the database.
+// Rules that fail to compile are skipped so one bad row can't disable moderation.
+func (e *Engine) Reload(ctx context.Context) error {
+	rules, err := e.source.ListEnabledModerationRules(ctx)
+	if err != nil {
+		return fmt.Errorf("couldn't load moderation rules: %w", err)
+	}
+
+	words := map[string]compiledRule{}
+	var regex []compiledRule
+	for _, r := range rules {
+		if err := Validate(r.Kind, r.Pattern, r.Action); err != nil {
+			slog.Warn("skipping moderation rule", "rule_id", r.ID, "err", err)
+			continue
+		}
+		compiled := compiledRule{id: r.ID, action: r.Action}
+		if r.Kind == KindWord {
+			word := foldString(r.Pattern)
+			if existing, ok := words[word]; ok && severity(existing.action) >= severity(r.Action) {
+				continue
+			}
+			words[word] = compiled
+			continue
+		}
+		compiled.re = regexp.MustCompile("(?i)" + r.Pattern)
+		regex = append(regex, compiled)
+	}
+
+	e.mu.Lock()
+	e.words = words
+	e.regex = regex
+	e.mu.Unlock()
+	return nil
+}
+
+// Watch reloads the rules every interval until ctx is cancelled, so rule
+// changes made by other instances are picked up without a restart.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := e.Reload(ctx); err != nil {
+				slog.Error("reloading moderation rules", "err", err)
+			}
+		}
+	}
+}
+
+// Check runs body through every cached rule. Matching happens on the
+// normalized text, leetspeak folded only for word rules, but hits are mapped back to the original so that spans
+// hit by mask rules are replaced with asterisks and everything else keeps
+// its formatting. Reject and hold rules leave the body untouched.
+func (e *Engine) Check(body string) Result {
+	e.mu.RLock()
+	wordRules := e.words
+	regex := e.regex
+	e.mu.RUnlock()
+
+	text := normalize(body)
+
+	var hits []Hit
+	for _, word := range words(text) {
+	candidateLoop:
+		for _, candidate := range candidates(word) {
+			for _, reading := range readings(candidate) {
+				r, ok := wordRules[reading]
+				if !ok {
+					continue
+				}
+				hits = append(hits, newHit(r, body, candidate))
+				break candidateLoop
+			}
+		}
+	}
+
+	if len(regex) > 0 {
+		var flat strings.Builder
+		offsets := make([]int, 0, len(text)+1)
+		for i, f := range text {
+			for range utf8.RuneLen(f.plain) {
+				offsets = append(offsets, i)
+			}
+			flat.WriteRune(f.plain)
+		}
+		offsets = append(offsets, len(text))
+
+		for _, r := range regex {
+			for _, loc := range r.re.FindAllStringIndex(flat.String(), -1) {
+				if loc[0] == loc[1] {
+					continue
+				}
+				hits = append(hits, newHit(r, body, text[offsets[loc[0]]:offsets[loc[1]-1]+1]))
+			}
+		}
+	}
+
+	result := Result{Body: body, Hits: hits}
+	for _, hit := range hits {
+		if severity(hit.Action) > severity(result.Action) {
+			result.Action = hit.Action
+		}
+	}
+	result.Body = mask(body, hits)
+	return result
+}
+
+func newHit(r compiledRule, body string, match []folded) Hit {
+	start := match[0].start
+	end := match[len(match)-1].end
+	// combining marks belong to the letter before them, so mask them too
+	for end < len(body) {
+		char, size := utf8.DecodeRuneInString(body[end:])
+		if !unicode.In(char, unicode.Mn, unicode.Me) {
+			break
+		}
+		end += size
+	}
+	return Hit{RuleID: r.id, Matched: body[start:end], Action: r.action, start: start, end: end}
+}
+
+func mask(body string, hits []Hit) string {
+	var spans [][2]int
+	for _, hit := range hits {
+		if hit.Action == ActionMask {
+			spans = append(spans, [2]int{hit.start, hit.end})
+		}
+	}
+	if len(spans) == 0 {
+		return body
+	}
+
+	sort.Slice(spans, func(i, j int) bool {
+		return spans[i][0] < spans[j][0]
+	})
+
+	var result strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span[1] <= last {
+			continue
+		}
+		if span[0] >= last {
+			result.WriteString(body[last:span[0]])
+			result.WriteString(maskText)
+		}
+		last = span[1]
+	}
+	result.WriteString(body[last:])
+	return result.String()
+}
+
+func severity(action string) int {
+	switch action {
+	case ActionMask:
+		return 1
+	case ActionHold:
+		return 2
+	case ActionReject:
+		return 3
+	}
+	return 0
+}
@@ -0,0 +1,148 @@
+package moderation
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+)
+
+type fakeSource []database.ModerationRule
+
+func (f fakeSource) ListEnabledModerationRules(ctx context.Context) ([]database.ModerationRule, error) {
+	return f, nil
+}
+
+func newTestEngine(t *testing.T, rules ...database.ModerationRule) *Engine {
+	t.Helper()
+	for i := range rules {
+		rules[i].ID = uuid.New()
+	}
+	engine := NewEngine(fakeSource(rules))
+	if err := engine.Reload(context.Background()); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	return engine
+}
+
+func TestEngineCheck(t *testing.T) {
+	engine := newTestEngine(t,
+		database.ModerationRule{Kind: KindWord, Pattern: "kerfuffle", Action: ActionMask},
+		database.ModerationRule{Kind: KindWord, Pattern: "sharbert", Action: ActionMask},
+		database.ModerationRule{Kind: KindRegex, Pattern: `buy\s+now`, Action: ActionHold},
+		database.ModerationRule{Kind: KindWord, Pattern: "fornax", Action: ActionReject},
+		database.ModerationRule{Kind: KindRegex, Pattern: `\d{4}-\d{4}`, Action: ActionMask},
+		database.ModerationRule{Kind: KindRegex, Pattern: `\S+@\S+\.com`, Action: ActionMask},
+		database.ModerationRule{Kind: KindRegex, Pattern: `\$\d+ off`, Action: ActionHold},
+	)
+
+	tests := []struct {
+		name       string
+		body       string
+		wantBody   string
+		wantAction string
+		wantHits   int
+	}{
+		{
+			name:     "clean chirp",
+			body:     "I had something interesting for breakfast",
+			wantBody: "I had something interesting for breakfast",
+		},
+		{
+			name:       "mask is case insensitive",
+			body:       "This is a Kerfuffle opinion I need to share with the world",
+			wantBody:   "This is a **** opinion I need to share with the world",
+			wantAction: ActionMask,
+			wantHits:   1,
+		},
+		{
+			name:       "punctuation is not a word boundary match",
+			body:       "Sharbert! is fine",
+			wantBody:   "****! is fine",
+			wantAction: ActionMask,
+			wantHits:   1,
+		},
+		{
+			name:       "hold keeps the body",
+			body:       "kerfuffle, BUY   now",
+			wantBody:   "****, BUY   now",
+			wantAction: ActionHold,
+			wantHits:   2,
+		},
+		{
+			name:       "regex with digits",
+			body:       "call 1234-5678 today",
+			wantBody:   "call **** today",
+			wantAction: ActionMask,
+			wantHits:   1,
+		},
+		{
+			name:       "regex with digits in full width",
+			body:       "call １２３４-５６７８ today",
+			wantBody:   "call **** today",
+			wantAction: ActionMask,
+			wantHits:   1,
+		},
+		{
+			name:       "regex with an at sign",
+			body:       "mail a@b.com now",
+			wantBody:   "mail **** now",
+			wantAction: ActionMask,
+			wantHits:   1,
+		},
+		{
+			name:       "regex with an invisible character",
+			body:       "mail a@\u200bb.com now",
+			wantBody:   "mail **** now",
+			wantAction: ActionMask,
+			wantHits:   1,
+		},
+		{
+			name:       "regex with a dollar sign",
+			body:       "$50 OFF everything",
+			wantBody:   "$50 OFF everything",
+			wantAction: ActionHold,
+			wantHits:   1,
+		},
+		{
+			name:     "leetspeak doesn't feed regex rules",
+			body:     "call iz34-s678",
+			wantBody: "call iz34-s678",
+		},
+		{
+			name:       "reject wins",
+			body:       "fornax buy now",
+			wantBody:   "fornax buy now",
+			wantAction: ActionReject,
+			wantHits:   2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := engine.Check(tt.body)
+			if got.Body != tt.wantBody {
+				t.Errorf("Check() body = %q, want %q", got.Body, tt.wantBody)
+			}
+			if got.Action != tt.wantAction {
+				t.Errorf("Check() action = %q, want %q", got.Action, tt.wantAction)
+			}
+			if len(got.Hits) != tt.wantHits {
+				t.Errorf("Check() hits = %d, want %d", len(got.Hits), tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := Validate(KindWord, "two words", ActionMask); err == nil {
+		t.Error("Validate() with a space in a word rule should return error, got nil")
+	}
+	if err := Validate(KindRegex, "(", ActionMask); err == nil {
+		t.Error("Validate() with an invalid regex should return error, got nil")
+	}
+	if err := Validate(KindWord, "fornax", "explode"); err == nil {
+		t.Error("Validate() with an unknown action should return error, got nil")
+	}
+}
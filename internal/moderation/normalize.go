@@ -0,0 +1,173 @@
+package moderation
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// confusables folds common look-alike letters from other scripts onto their
+// Latin counterparts so "ѕһаrbеrt" written in Cyrillic still matches.
+var confusables = map[rune]rune{
+	// Cyrillic
+	'а': 'a', 'в': 'b', 'е': 'e', 'ё': 'e', 'һ': 'h', 'і': 'i', 'ї': 'i',
+	'ј': 'j', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p', 'с': 'c',
+	'т': 't', 'у': 'y', 'х': 'x', 'ѕ': 's', 'ԁ': 'd', 'ԛ': 'q', 'ԝ': 'w',
+	'г': 'r', 'п': 'n', 'ь': 'b',
+	// Greek
+	'α': 'a', 'β': 'b', 'ε': 'e', 'η': 'n', 'ι': 'i', 'κ': 'k', 'ν': 'v',
+	'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u', 'χ': 'x', 'ω': 'w', 'ϲ': 'c',
+	// Latin look-alikes that survive NFKC and have no accent to strip
+	'ı': 'i', 'ł': 'l', 'ø': 'o', 'đ': 'd', 'ħ': 'h', 'ŧ': 't', 'ƒ': 'f',
+	'ß': 's', 'ɑ': 'a', 'ɡ': 'g', 'ʀ': 'r', 'ꞵ': 'b',
+}
+
+// leetspeak maps digits and symbols that are commonly swapped in for letters.
+var leetspeak = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'l', '€': 'e', '£': 'l',
+}
+
+// leetAlternates holds the second reading of ambiguous leetspeak characters:
+// "1" is as often an "l" as an "i".
+var leetAlternates = map[rune]rune{
+	'1': 'l',
+	'|': 'i',
+}
+
+// folded is one rune of normalized text together with the byte span of the
+// original input it was derived from. plain is the rune before case,
+// confusable and leetspeak folding, which regex rules match against.
+type folded struct {
+	char      rune
+	plain     rune
+	alternate rune
+	start     int
+	end       int
+	leet      bool
+}
+
+// isInvisible reports whether char carries no visible content and should be
+// dropped before matching: zero-width spaces and joiners, the BOM, other
+// format characters and combining marks.
+func isInvisible(char rune) bool {
+	switch char {
+	case '\u200b', '\u200c', '\u200d', '\u2060', '\ufeff', '\u00ad', '\u034f':
+		return true
+	}
+	return unicode.In(char, unicode.Mn, unicode.Me, unicode.Cf)
+}
+
+// normalize runs text through the matching pipeline: NFKC (so full-width
+// and stylised letters become plain ones), removal of invisible and
+// combining characters, including accents NFD splits off, confusable folding,
+// lowercasing and leetspeak mapping. Every output rune remembers where it
+// came from so matches can be masked in the original text.
+func normalize(text string) []folded {
+	result := make([]folded, 0, len(text))
+	for start, char := range text {
+		end := start + utf8.RuneLen(char)
+		if char == utf8.RuneError {
+			end = start + 1
+		}
+		if isInvisible(char) {
+			continue
+		}
+
+		for _, part := range norm.NFD.String(norm.NFKC.String(string(char))) {
+			if isInvisible(part) {
+				continue
+			}
+			plain := part
+			part = unicode.ToLower(part)
+			if latin, ok := confusables[part]; ok {
+				part = latin
+			}
+			if letter, ok := leetspeak[part]; ok {
+				result = append(result, folded{char: letter, plain: plain, alternate: leetAlternates[part], start: start, end: end, leet: true})
+				continue
+			}
+			result = append(result, folded{char: part, plain: plain, start: start, end: end})
+		}
+	}
+	return result
+}
+
+// foldString returns only the normalized text, used for rule patterns.
+func foldString(text string) string {
+	return runesToString(normalize(text))
+}
+
+// words splits normalized text into runs of letters. Leetspeak characters
+// count as letters so "k3rfuffle" stays one word.
+func words(text []folded) [][]folded {
+	var result [][]folded
+	start := -1
+	for i := 0; i <= len(text); i++ {
+		if i < len(text) && unicode.IsLetter(text[i].char) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			result = append(result, text[start:i])
+			start = -1
+		}
+	}
+	return result
+}
+
+// candidates returns the ways a word may be read. A trailing "!" or leading
+// "$" may be punctuation rather than leetspeak, so variants with leetspeak
+// characters trimmed from either end are tried after the full word.
+func candidates(word []folded) [][]folded {
+	result := [][]folded{word}
+	left, right := 0, len(word)
+	for left < right && word[left].leet {
+		left++
+	}
+	for right > left && word[right-1].leet {
+		right--
+	}
+	if right > left && right < len(word) {
+		result = append(result, word[:right])
+	}
+	if left > 0 && left < right {
+		result = append(result, word[left:])
+		if right < len(word) {
+			result = append(result, word[left:right])
+		}
+	}
+	return result
+}
+
+// readings returns the word as normalized and, when it contains ambiguous
+// leetspeak, the word with every ambiguous character read the other way.
+func readings(word []folded) []string {
+	primary := runesToString(word)
+	ambiguous := false
+	var builder strings.Builder
+	for _, f := range word {
+		if f.alternate != 0 {
+			ambiguous = true
+			builder.WriteRune(f.alternate)
+			continue
+		}
+		builder.WriteRune(f.char)
+	}
+	if !ambiguous {
+		return []string{primary}
+	}
+	return []string{primary, builder.String()}
+}
+
+func runesToString(text []folded) string {
+	var builder strings.Builder
+	for _, f := range text {
+		builder.WriteRune(f.char)
+	}
+	return builder.String()
+}
@@ -0,0 +1,172 @@
+package moderation
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/k3vwdd/chirpyWS/internal/database"
+)
+
+func newEvasionEngine(t *testing.T) *Engine {
+	return newTestEngine(t,
+		database.ModerationRule{Kind: KindWord, Pattern: "kerfuffle", Action: ActionMask},
+		database.ModerationRule{Kind: KindWord, Pattern: "sharbert", Action: ActionMask},
+		database.ModerationRule{Kind: KindWord, Pattern: "fornax", Action: ActionMask},
+	)
+}
+
+func TestCheckEvasionCorpus(t *testing.T) {
+	engine := newEvasionEngine(t)
+
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		// plain matches keep the original behaviour
+		{"plain", "kerfuffle", "****"},
+		{"upper case", "KERFUFFLE", "****"},
+		{"title case", "Sharbert", "****"},
+		{"mixed case", "fOrNaX", "****"},
+		{"in sentence", "what a kerfuffle today", "what a **** today"},
+		{"several words", "kerfuffle sharbert fornax", "**** **** ****"},
+		{"trailing punctuation", "Sharbert!", "****!"},
+		{"trailing punctuation run", "fornax?!", "****?!"},
+		{"leading punctuation", "(kerfuffle)", "(****)"},
+		{"quoted", `"fornax"`, `"****"`},
+		{"newline", "line one\nkerfuffle\nline three", "line one\n****\nline three"},
+		{"tab separated", "a\tsharbert\tb", "a\t****\tb"},
+
+		// leetspeak
+		{"leet digit e", "k3rfuffle", "****"},
+		{"leet digit o", "f0rnax", "****"},
+		{"leet at sign", "sh@rbert", "****"},
+		{"leet dollar leading", "$harbert", "****"},
+		{"leet many", "k3rfuff13", "****"},
+		{"leet four", "sh4rb3rt", "****"},
+		{"leet pipe", "kerfuff|e", "****"},
+		{"leet one as l", "kerfuff1e", "****"},
+		{"leet seven", "shar8er7", "****"},
+		{"leet with trailing digit", "fornax1 is here", "****1 is here"},
+		{"leet inside sentence", "total k3rfuffl3, honestly", "total ****, honestly"},
+
+		// full-width and stylised letters
+		{"full width", "ｆｏｒｎａｘ", "****"},
+		{"full width upper", "ＫＥＲＦＵＦＦＬＥ", "****"},
+		{"full width in sentence", "the ｓｈａｒｂｅｒｔ again", "the **** again"},
+		{"math bold", "𝐟𝐨𝐫𝐧𝐚𝐱", "****"},
+		{"math italic", "𝑠ℎ𝑎𝑟𝑏𝑒𝑟𝑡", "****"},
+		{"circled", "ⓕⓞⓡⓝⓐⓧ", "****"},
+		{"ligature", "ker\ufb00le", "ker\ufb00le"},
+		{"ligature match", "kerfu\ufb04e", "****"},
+
+		// zero-width and combining characters
+		{"zero width joiner", "ker\u200dfuffle", "****"},
+		{"zero width space", "f\u200bo\u200br\u200bn\u200ba\u200bx", "****"},
+		{"zero width non joiner", "sharb\u200cert", "****"},
+		{"word joiner", "forn\u2060ax", "****"},
+		{"byte order mark", "\ufefffornax", "\ufeff****"},
+		{"soft hyphen", "kerfuf\u00adfle", "****"},
+		{"combining acute", "fo\u0301rnax", "****"},
+		{"combining stacked", "f\u0301\u0302ornax", "****"},
+		{"precomposed accents", "k\u00e9rf\u00fcffl\u00e9", "****"},
+		{"zalgo", "s\u0336h\u0336a\u0336r\u0336b\u0336e\u0336r\u0336t\u0336", "****"},
+		{"zero width keeps surroundings", "hi ker\u200dfuffle!", "hi ****!"},
+
+		// confusables
+		{"cyrillic a", "sh\u0430rbert", "****"},
+		{"cyrillic o", "f\u043ernax", "****"},
+		{"cyrillic many", "\u0455\u04bb\u0430rb\u0435rt", "****"},
+		{"greek omicron", "f\u03bfrnax", "****"},
+		{"long s", "\u017fharbert", "****"},
+		{"mixed scripts and leet", "\u0455h@rb3rt", "****"},
+
+		// things that must stay untouched
+		{"clean", "I had something interesting for breakfast", "I had something interesting for breakfast"},
+		{"empty", "", ""},
+		{"substring", "kerfuffles", "kerfuffles"},
+		{"prefix", "prefornax", "prefornax"},
+		{"split by space", "forn ax", "forn ax"},
+		{"numbers", "I have 4 cats and 3 dogs", "I have 4 cats and 3 dogs"},
+		{"emoji", "🐦 chirp chirp 🐦", "🐦 chirp chirp 🐦"},
+		{"non latin text", "привет мир", "привет мир"},
+		{"accents elsewhere", "café crème", "café crème"},
+		{"full width clean", "ｈｅｌｌｏ", "ｈｅｌｌｏ"},
+		{"formatting kept", "  spaced   out  ", "  spaced   out  "},
+
+		// formatting around masks is preserved
+		{"emoji around", "🐦fornax🐦", "🐦****🐦"},
+		{"full width around ascii", "ｈｉ fornax ｈｉ", "ｈｉ **** ｈｉ"},
+		{"adjacent words", "fornax,sharbert", "****,****"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := engine.Check(tt.body)
+			if got.Body != tt.want {
+				t.Errorf("Check(%q) body = %q, want %q", tt.body, got.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeKeepsOffsets(t *testing.T) {
+	body := "\uff46\u200b0r-nax"
+	for _, f := range normalize(body) {
+		if f.start < 0 || f.end > len(body) || f.start >= f.end {
+			t.Fatalf("normalize(%q) produced invalid span [%d,%d)", body, f.start, f.end)
+		}
+	}
+	if got := foldString(body); got != "for-nax" {
+		t.Errorf("foldString(%q) = %q, want %q", body, got, "for-nax")
+	}
+}
+
+func FuzzCheck(f *testing.F) {
+	seeds := []string{
+		"",
+		"kerfuffle",
+		"Sharbert!",
+		"k3rfuffle",
+		"sh@rbert",
+		"ｆｏｒｎａｘ",
+		"ker\u200dfuffle",
+		"fo\u0301rnax",
+		"\u0455\u04bb\u0430rb\u0435rt",
+		"🐦fornax🐦",
+		"\xff\xfe fornax",
+	}
+	for _, seed := range seeds {
+		f.Add(seed)
+	}
+
+	engine := NewEngine(nil)
+	engine.words = map[string]compiledRule{
+		"kerfuffle": {action: ActionMask},
+		"sharbert":  {action: ActionMask},
+		"fornax":    {action: ActionMask},
+	}
+
+	f.Fuzz(func(t *testing.T, body string) {
+		got := engine.Check(body)
+
+		if len(got.Hits) == 0 && got.Body != body {
+			t.Fatalf("Check(%q) changed body %q without any hits", body, got.Body)
+		}
+		if utf8.ValidString(body) && !utf8.ValidString(got.Body) {
+			t.Fatalf("Check(%q) produced invalid UTF-8 %q", body, got.Body)
+		}
+		for _, hit := range got.Hits {
+			if !strings.Contains(body, hit.Matched) {
+				t.Fatalf("Check(%q) hit %q is not part of the body", body, hit.Matched)
+			}
+		}
+
+		// masking is stable: running the output again must not find more
+		again := engine.Check(got.Body)
+		if again.Body != got.Body {
+			t.Fatalf("Check() is not idempotent: %q -> %q -> %q", body, got.Body, again.Body)
+		}
+	})
+}
@@ -0,0 +1,306 @@
+// Package openapi builds an OpenAPI 3.1 document whose schemas are
+// reflected from the Go types the handlers actually encode and decode.
+package openapi
+
+import (
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+const Version = "3.1.0"
+
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem maps lower-case HTTP methods to operations.
+type PathItem map[string]*Operation
+
+type Operation struct {
+	OperationID string                `json:"operationId"`
+	Summary     string                `json:"summary,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]Response   `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+	Deprecated  bool                  `json:"deprecated,omitempty"`
+}
+
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]MediaType `json:"content"`
+}
+
+type Response struct {
+	Description string               `json:"description"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Components struct {
+	Schemas         map[string]*Schema        `json:"schemas"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+type SecurityScheme struct {
+	Type         string `json:"type"`
+	Scheme       string `json:"scheme,omitempty"`
+	BearerFormat string `json:"bearerFormat,omitempty"`
+	In           string `json:"in,omitempty"`
+	Name         string `json:"name,omitempty"`
+	Description  string `json:"description,omitempty"`
+}
+
+// Schema is the subset of JSON Schema 2020-12 Chirpy needs. Type is a
+// string, or a list of strings for nullable values.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 any                `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Direction decides which fields a schema requires. Input requires the
+// fields tagged validate:"required"; Output requires every field that
+// isn't omitempty, since the server always sends those. A named type
+// becomes one component, so use each type in one direction only.
+type Direction int
+
+const (
+	Input Direction = iota
+	Output
+)
+
+// Builder collects operations and the component schemas they refer to.
+type Builder struct {
+	doc   Document
+	names map[reflect.Type]string
+}
+
+func New(info Info) *Builder {
+	return &Builder{
+		doc: Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   map[string]PathItem{},
+			Components: Components{
+				Schemas:         map[string]*Schema{},
+				SecuritySchemes: map[string]SecurityScheme{},
+			},
+		},
+		names: map[reflect.Type]string{},
+	}
+}
+
+func (b *Builder) SecurityScheme(name string, scheme SecurityScheme) {
+	b.doc.Components.SecuritySchemes[name] = scheme
+}
+
+// Add registers op under method (any case) and path. Adding the same
+// method and path twice replaces the first.
+func (b *Builder) Add(method, path string, op *Operation) {
+	item, ok := b.doc.Paths[path]
+	if !ok {
+		item = PathItem{}
+		b.doc.Paths[path] = item
+	}
+	item[strings.ToLower(method)] = op
+}
+
+func (b *Builder) Document() Document {
+	return b.doc
+}
+
+// JSON is a request body or response content of the type of v.
+func (b *Builder) JSON(v any, dir Direction) map[string]MediaType {
+	return map[string]MediaType{"application/json": {Schema: b.Schema(v, dir)}}
+}
+
+// Schema reflects the type of v. Named struct types become components and
+// are referred to by $ref.
+func (b *Builder) Schema(v any, dir Direction) *Schema {
+	return b.schema(reflect.TypeOf(v), dir)
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	uuidType = reflect.TypeOf(uuid.UUID{})
+)
+
+func (b *Builder) schema(t reflect.Type, dir Direction) *Schema {
+	if t.Kind() == reflect.Pointer {
+		return nullable(b.schema(t.Elem(), dir))
+	}
+
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case uuidType:
+		return &Schema{Type: "string", Format: "uuid"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: b.schema(t.Elem(), dir)}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: b.schema(t.Elem(), dir)}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.object(t, dir)
+		}
+		return b.component(t, dir)
+	default:
+		return &Schema{}
+	}
+}
+
+func (b *Builder) component(t reflect.Type, dir Direction) *Schema {
+	name, ok := b.names[t]
+	if !ok {
+		name = componentName(t)
+		for i := 2; b.doc.Components.Schemas[name] != nil; i++ {
+			name = componentName(t) + strconv.Itoa(i)
+		}
+		b.names[t] = name
+		// Reserve the name before recursing, for self-referencing types.
+		b.doc.Components.Schemas[name] = &Schema{}
+		*b.doc.Components.Schemas[name] = *b.object(t, dir)
+	}
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// componentName turns createChirpRequest into CreateChirpRequest.
+func componentName(t reflect.Type) string {
+	runes := []rune(t.Name())
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func (b *Builder) object(t reflect.Type, dir Direction) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	b.addFields(s, t, dir)
+	return s
+}
+
+func (b *Builder) addFields(s *Schema, t reflect.Type, dir Direction) {
+	for i := range t.NumField() {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			b.addFields(s, field.Type, dir)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := b.schema(field.Type, dir)
+		rules := strings.Split(field.Tag.Get("validate"), ",")
+		if prop.Ref == "" {
+			applyRules(prop, rules)
+		}
+		s.Properties[name] = prop
+
+		omitempty := strings.Contains(options, "omitempty")
+		if (dir == Input && slices.Contains(rules, "required")) || (dir == Output && !omitempty) {
+			s.Required = append(s.Required, name)
+		}
+	}
+}
+
+// applyRules mirrors utils.Validate's tags in the schema.
+func applyRules(s *Schema, rules []string) {
+	isString := s.Type == "string"
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if isString {
+				one := 1
+				s.MinLength = &one
+			}
+		case "min", "max":
+			n, err := strconv.Atoi(arg)
+			if err != nil {
+				continue
+			}
+			switch {
+			case isString && name == "min":
+				s.MinLength = &n
+			case isString:
+				s.MaxLength = &n
+			case name == "min":
+				s.Minimum = &n
+			default:
+				s.Maximum = &n
+			}
+		case "email":
+			s.Format = "email"
+		case "uuid":
+			s.Format = "uuid"
+		case "oneof":
+			s.Enum = strings.Fields(arg)
+		}
+	}
+}
+
+func nullable(s *Schema) *Schema {
+	if typ, ok := s.Type.(string); ok && s.Ref == "" {
+		s.Type = []string{typ, "null"}
+		return s
+	}
+	return &Schema{OneOf: []*Schema{s, {Type: "null"}}}
+}
@@ -0,0 +1,80 @@
+package openapi
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type address struct {
+	City string `json:"city" validate:"required,max=50"`
+}
+
+type base struct {
+	ID uuid.UUID `json:"id"`
+}
+
+type signUp struct {
+	base
+	Email    string     `json:"email" validate:"required,email"`
+	Plan     string     `json:"plan,omitempty" validate:"oneof=free red"`
+	Age      int        `json:"age" validate:"min=13"`
+	Born     *time.Time `json:"born"`
+	Tags     []string   `json:"tags,omitempty"`
+	Home     *address   `json:"home"`
+	internal string
+	Skipped  string `json:"-"`
+}
+
+func TestSchema(t *testing.T) {
+	b := New(Info{Title: "test", Version: "1"})
+
+	if ref := b.Schema(signUp{}, Input).Ref; ref != "#/components/schemas/SignUp" {
+		t.Fatalf("ref = %q", ref)
+	}
+	s := b.Document().Components.Schemas["SignUp"]
+
+	var names []string
+	for name := range s.Properties {
+		names = append(names, name)
+	}
+	if len(names) != 7 {
+		t.Errorf("properties = %v, want id, email, plan, age, born, tags and home", names)
+	}
+	if !reflect.DeepEqual(s.Required, []string{"email"}) {
+		t.Errorf("input required = %v, want [email]", s.Required)
+	}
+
+	checks := []struct {
+		name string
+		got  any
+		want any
+	}{
+		{"id format", s.Properties["id"].Format, "uuid"},
+		{"email format", s.Properties["email"].Format, "email"},
+		{"email minLength", *s.Properties["email"].MinLength, 1},
+		{"plan enum", s.Properties["plan"].Enum, []string{"free", "red"}},
+		{"age minimum", *s.Properties["age"].Minimum, 13},
+		{"born type", s.Properties["born"].Type, []string{"string", "null"}},
+		{"tags items", s.Properties["tags"].Items.Type, "string"},
+		{"home", len(s.Properties["home"].OneOf), 2},
+		{"address maxLength", *b.Document().Components.Schemas["Address"].Properties["city"].MaxLength, 50},
+	}
+	for _, c := range checks {
+		if !reflect.DeepEqual(c.got, c.want) {
+			t.Errorf("%s = %v, want %v", c.name, c.got, c.want)
+		}
+	}
+}
+
+func TestSchemaOutputRequired(t *testing.T) {
+	b := New(Info{})
+	b.Schema([]signUp{}, Output)
+	s := b.Document().Components.Schemas["SignUp"]
+	want := []string{"id", "email", "age", "born", "home"}
+	if !reflect.DeepEqual(s.Required, want) {
+		t.Errorf("output required = %v, want %v", s.Required, want)
+	}
+}
@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// AccessTokenTTL is how long a JWT from LogIn or Refresh lasts.
+const AccessTokenTTL = time.Hour
+
+// Session is what logging in returns.
+type Session struct {
+	User         database.User
+	Token        string
+	RefreshToken string
+}
+
+// LogIn checks the credentials and issues an access and a refresh token.
+func (s *Service) LogIn(ctx context.Context, params Login) (Session, error) {
+	user, err := s.Db.GetUserByEmail(ctx, params.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		s.Metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+		return Session{}, invalidCredentials()
+	}
+	if err != nil {
+		return Session{}, utils.Internal("Unable to load user", err)
+	}
+
+	if auth.CheckPasswordHash(params.Password, user.HashedPassword) != nil {
+		s.Metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+		return Session{}, invalidCredentials()
+	}
+
+	if isSuspended(user.SuspendedUntil) {
+		s.Metrics.Logins.WithLabelValues(metrics.LoginFailed).Inc()
+		return Session{}, accountSuspended()
+	}
+
+	logging.SetUserID(ctx, user.ID)
+
+	refreshToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		return Session{}, utils.Internal("Failed to generate refresh token", err)
+	}
+	err = s.Db.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{
+		Token:  refreshToken,
+		UserID: user.ID,
+	})
+	if err != nil {
+		return Session{}, utils.Internal("Failed to create refresh token in db", err)
+	}
+
+	token, err := auth.MakeJWT(user.ID, s.JWTKEY, AccessTokenTTL)
+	if err != nil {
+		return Session{}, utils.Internal("Failed to generate JWT", err)
+	}
+
+	s.Metrics.Logins.WithLabelValues(metrics.LoginSucceeded).Inc()
+	return Session{User: user, Token: token, RefreshToken: refreshToken}, nil
+}
+
+// Refresh exchanges a refresh token for a new access token.
+func (s *Service) Refresh(ctx context.Context, refreshToken string) (string, error) {
+	user, err := s.Db.GetUserFromRefreshToken(ctx, refreshToken)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", utils.Unauthorized("Refresh token is invalid, expired or revoked")
+	}
+	if err != nil {
+		return "", utils.Internal("Unable to look up refresh token", err)
+	}
+
+	if isSuspended(user.SuspendedUntil) {
+		return "", accountSuspended()
+	}
+
+	logging.SetUserID(ctx, user.ID)
+
+	token, err := auth.MakeJWT(user.ID, s.JWTKEY, AccessTokenTTL)
+	if err != nil {
+		return "", utils.Internal("Failed to generate JWT", err)
+	}
+	return token, nil
+}
+
+func (s *Service) Revoke(ctx context.Context, refreshToken string) error {
+	if err := s.Db.RevokeRefreshToken(ctx, refreshToken); err != nil {
+		return utils.Internal("Unable to revoke refresh token", err)
+	}
+	return nil
+}
@@ -0,0 +1,274 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/feed"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// watchBuffer is how many chirps a watcher may fall behind before it is
+// disconnected.
+const watchBuffer = 64
+
+// PostChirp runs the body through moderation and stores it. A chirp the
+// rules hold comes back with Status ChirpHeld; published ones go out to
+// watchers.
+func (s *Service) PostChirp(ctx context.Context, user database.User, params NewChirp) (database.Chirp, error) {
+	verdict := s.Moderation.Check(params.Body)
+	if verdict.Action == moderation.ActionReject {
+		s.logModerationHits(ctx, verdict.Hits, uuid.NullUUID{}, user.ID)
+		return database.Chirp{}, utils.NewError(http.StatusBadRequest, utils.CodeContentRejected, "Chirp violates content rules")
+	}
+
+	status := ChirpPublished
+	if verdict.Action == moderation.ActionHold {
+		status = ChirpHeld
+	}
+
+	chirp, err := s.Db.CreateChirp(ctx, database.CreateChirpParams{
+		ID:        uuid.New(),
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+		Body:      verdict.Body,
+		UserID:    user.ID,
+		Status:    status,
+	})
+	if err != nil {
+		return database.Chirp{}, utils.Internal("Error creating chirp", err)
+	}
+
+	s.Metrics.ChirpsCreated.Inc()
+	s.logModerationHits(ctx, verdict.Hits, uuid.NullUUID{UUID: chirp.ID, Valid: true}, user.ID)
+	if status == ChirpPublished && s.ChirpFeed != nil {
+		s.ChirpFeed.Publish(feed.Entry{Chirp: chirp, Author: user})
+	}
+	return chirp, nil
+}
+
+// ReviewHeldChirp publishes a held chirp, sending it out to watchers, or
+// removes it. Chirps that aren't held, including ones another moderator
+// reviewed first, are a 409.
+func (s *Service) ReviewHeldChirp(ctx context.Context, id uuid.UUID, approve bool) (database.Chirp, error) {
+	status := ChirpRemoved
+	if approve {
+		status = ChirpPublished
+	}
+
+	n, err := s.Db.TransitionChirpStatus(ctx, database.TransitionChirpStatusParams{
+		NewStatus: status,
+		ID:        id,
+		OldStatus: ChirpHeld,
+	})
+	if err != nil {
+		return database.Chirp{}, utils.Internal("Error reviewing chirp", err)
+	}
+
+	chirp, err := s.Db.GetChirpByID(ctx, id)
+	if err != nil {
+		return database.Chirp{}, utils.LookupError(err, "Chirp not found")
+	}
+	if n == 0 {
+		return database.Chirp{}, utils.Conflict("Chirp is not held for review")
+	}
+
+	if approve && s.ChirpFeed != nil {
+		author, err := s.Db.GetUserByID(ctx, chirp.UserID)
+		if err != nil {
+			return database.Chirp{}, utils.Internal("Error loading chirp author", err)
+		}
+		s.ChirpFeed.Publish(feed.Entry{Chirp: chirp, Author: author})
+	}
+	return chirp, nil
+}
+
+// logModerationHits stores every rule hit. Failures are logged rather than
+// returned so that a logging problem never blocks the chirp itself.
+func (s *Service) logModerationHits(ctx context.Context, hits []moderation.Hit, chirpID uuid.NullUUID, userID uuid.UUID) {
+	for _, hit := range hits {
+		err := s.Db.CreateModerationHit(ctx, database.CreateModerationHitParams{
+			ID:      uuid.New(),
+			RuleID:  hit.RuleID,
+			ChirpID: chirpID,
+			UserID:  userID,
+			Matched: hit.Matched,
+			Action:  hit.Action,
+		})
+		if err != nil {
+			logging.FromContext(ctx).Error("logging moderation hit", "rule_id", hit.RuleID, "err", err)
+		}
+	}
+}
+
+// ListChirps returns the published chirps viewerID may see, optionally only
+// authorID's, sorted SortAsc or SortDesc by creation time. Shadow-banned
+// authors' chirps are only shown to themselves.
+func (s *Service) ListChirps(ctx context.Context, authorID, viewerID uuid.UUID, order string) ([]database.Chirp, error) {
+	var chirps []database.Chirp
+	var err error
+	if authorID != uuid.Nil {
+		chirps, err = s.Db.GetChirpsByAuthorID(ctx, database.GetChirpsByAuthorIDParams{
+			UserID:   authorID,
+			ViewerID: viewerID,
+		})
+	} else {
+		chirps, err = s.Db.GetAllChirps(ctx, viewerID)
+	}
+	if err != nil {
+		return nil, utils.Internal("Error fetching chirps", err)
+	}
+
+	switch order {
+	case SortDesc:
+		sort.Slice(chirps, func(i, j int) bool {
+			return chirps[i].CreatedAt.After(chirps[j].CreatedAt)
+		})
+	case SortAsc:
+		sort.Slice(chirps, func(i, j int) bool {
+			return chirps[i].CreatedAt.Before(chirps[j].CreatedAt)
+		})
+	}
+	return chirps, nil
+}
+
+// ChirpAuthors looks up the authors of chirps in one query.
+func (s *Service) ChirpAuthors(ctx context.Context, chirps []database.Chirp) (map[uuid.UUID]database.User, error) {
+	var ids []uuid.UUID
+	seen := map[uuid.UUID]bool{}
+	for _, chirp := range chirps {
+		if !seen[chirp.UserID] {
+			seen[chirp.UserID] = true
+			ids = append(ids, chirp.UserID)
+		}
+	}
+
+	authors := make(map[uuid.UUID]database.User, len(ids))
+	if len(ids) == 0 {
+		return authors, nil
+	}
+	users, err := s.Db.GetUsersByIDs(ctx, ids)
+	if err != nil {
+		return nil, utils.Internal("Unable to load chirp authors", err)
+	}
+	for _, user := range users {
+		authors[user.ID] = user
+	}
+	return authors, nil
+}
+
+// VisibleChirp loads a chirp and its author, hiding chirps that aren't
+// published and shadow-banned authors' chirps from everyone but them.
+func (s *Service) VisibleChirp(ctx context.Context, id, viewerID uuid.UUID) (database.Chirp, database.User, error) {
+	chirp, err := s.Db.GetChirpByID(ctx, id)
+	if err != nil {
+		return database.Chirp{}, database.User{}, utils.LookupError(err, "Chirp not found")
+	}
+	if chirp.Status != ChirpPublished {
+		return database.Chirp{}, database.User{}, utils.NotFound("Chirp not found")
+	}
+
+	author, err := s.Db.GetUserByID(ctx, chirp.UserID)
+	if err != nil {
+		return database.Chirp{}, database.User{}, utils.LookupError(err, "Chirp not found")
+	}
+	if author.ShadowBanned && chirp.UserID != viewerID {
+		return database.Chirp{}, database.User{}, utils.NotFound("Chirp not found")
+	}
+	return chirp, author, nil
+}
+
+// DeleteOwnChirp deletes one of user's chirps. A non-nil precondition sees
+// the chirp first and can refuse with an error; the chirp is then only
+// deleted if it hasn't changed since, or the error is a 412.
+func (s *Service) DeleteOwnChirp(ctx context.Context, user database.User, id uuid.UUID, precondition func(database.Chirp) error) error {
+	chirp, err := s.Db.GetChirpByID(ctx, id)
+	if err != nil {
+		return utils.LookupError(err, "Chirp not found")
+	}
+	if chirp.UserID != user.ID {
+		return utils.Forbidden("You can only delete your own chirps")
+	}
+
+	if precondition == nil {
+		if err := s.Db.DeleteChirpByID(ctx, chirp.ID); err != nil {
+			return utils.Internal("Unable to remove chirp", err)
+		}
+		return nil
+	}
+
+	if err := precondition(chirp); err != nil {
+		return err
+	}
+	deleted, err := s.Db.DeleteChirpIfUnchanged(ctx, database.DeleteChirpIfUnchangedParams{
+		ID:        chirp.ID,
+		UpdatedAt: chirp.UpdatedAt,
+	})
+	if err != nil {
+		return utils.Internal("Unable to remove chirp", err)
+	}
+	if deleted == 0 {
+		return utils.PreconditionFailed("Chirp changed while it was being deleted")
+	}
+	return nil
+}
+
+// ChirpWatch is a live subscription from WatchChirps.
+type ChirpWatch struct {
+	ctx      context.Context
+	streams  context.Context
+	sub      *feed.Subscription
+	authorID uuid.UUID
+	viewerID uuid.UUID
+}
+
+// WatchChirps subscribes to chirps published from now on that ListChirps
+// would show viewerID, optionally only authorID's. Close the watch when
+// done with it.
+func (s *Service) WatchChirps(ctx context.Context, authorID, viewerID uuid.UUID) (*ChirpWatch, error) {
+	if s.ChirpFeed == nil {
+		return nil, utils.Internal("Chirp feed isn't running", nil)
+	}
+	return &ChirpWatch{
+		ctx:      ctx,
+		streams:  s.StreamsCtx,
+		sub:      s.ChirpFeed.Subscribe(watchBuffer),
+		authorID: authorID,
+		viewerID: viewerID,
+	}, nil
+}
+
+// Next waits for the next chirp. It returns ctx's error once ctx is done,
+// and an unavailable error when the server shuts down or the watcher falls
+// too far behind.
+func (w *ChirpWatch) Next() (feed.Entry, error) {
+	for {
+		select {
+		case <-w.ctx.Done():
+			return feed.Entry{}, w.ctx.Err()
+		case <-w.streams.Done():
+			return feed.Entry{}, utils.NewError(http.StatusServiceUnavailable, utils.CodeUnavailable, "Server is shutting down")
+		case e, ok := <-w.sub.C():
+			if !ok {
+				return feed.Entry{}, utils.NewError(http.StatusServiceUnavailable, utils.CodeUnavailable, "Watcher fell behind; reconnect to resume")
+			}
+			if w.authorID != uuid.Nil && e.Author.ID != w.authorID {
+				continue
+			}
+			if e.Author.ShadowBanned && e.Author.ID != w.viewerID {
+				continue
+			}
+			return e, nil
+		}
+	}
+}
+
+func (w *ChirpWatch) Close() {
+	w.sub.Close()
+}
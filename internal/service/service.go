@@ -0,0 +1,83 @@
+// Package service holds the rules behind the user, auth and chirp APIs.
+// The REST and GraphQL handlers and the gRPC server are thin transports
+// over it, so they enforce the same ones.
+//
+// Methods take input the transport has already decoded and checked with
+// utils.Validate, and return *utils.Error values.
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/k3vwdd/chirpyWS/internal/types"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Service struct {
+	*types.ApiConfig
+}
+
+func New(cfg *types.ApiConfig) *Service {
+	return &Service{ApiConfig: cfg}
+}
+
+// Credentials signs a user up or changes their email and password.
+type Credentials struct {
+	Password string `json:"password" validate:"required"`
+	Email    string `json:"email" validate:"required,email,max=254"`
+}
+
+// Login doesn't check the email's format: a bad one just fails to log in.
+type Login struct {
+	Email    string `json:"email" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+type NewChirp struct {
+	Body string `json:"body" validate:"required,max=140"`
+}
+
+// Chirp statuses. Held chirps wait for a moderator; hidden ones were
+// reported often enough to come down until their reports are resolved.
+const (
+	ChirpPublished = "published"
+	ChirpHeld      = "held"
+	ChirpHidden    = "hidden"
+	ChirpRemoved   = "removed"
+)
+
+// Sort orders for ListChirps.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+func isSuspended(suspendedUntil sql.NullTime) bool {
+	return suspendedUntil.Valid && suspendedUntil.Time.After(time.Now())
+}
+
+func emailTaken() *utils.Error {
+	return utils.NewError(http.StatusConflict, utils.CodeEmailTaken, "Email is already registered")
+}
+
+func accountSuspended() *utils.Error {
+	return utils.NewError(http.StatusForbidden, utils.CodeAccountSuspended, "Account suspended")
+}
+
+// invalidCredentials doesn't say whether the email or the password was wrong.
+func invalidCredentials() *utils.Error {
+	return utils.NewError(http.StatusUnauthorized, utils.CodeInvalidCredentials, "Incorrect email or password")
+}
+
+// hashPasswordError maps a failed auth.HashPassword. bcrypt only looks at
+// 72 bytes, so longer passwords are a client error rather than a crash.
+func hashPasswordError(err error) *utils.Error {
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return utils.Validation(utils.FieldError{Field: "password", Message: "must be at most 72 bytes"})
+	}
+	return utils.Internal("Unable to hash password", err)
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+)
+
+// Authenticate resolves an access token to a user. Suspended accounts are
+// rejected here, so JWTs issued before a suspension stop working straight away.
+func (s *Service) Authenticate(ctx context.Context, token string) (database.User, error) {
+	userID, err := auth.ValidateJWT(token, s.JWTKEY)
+	if err != nil {
+		return database.User{}, utils.Unauthorized("Invalid token")
+	}
+
+	logging.SetUserID(ctx, userID)
+
+	user, err := s.Db.GetUserByID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return database.User{}, utils.Unauthorized("Unknown user")
+	}
+	if err != nil {
+		return database.User{}, utils.Internal("Unable to load user", err)
+	}
+
+	if isSuspended(user.SuspendedUntil) {
+		return database.User{}, accountSuspended()
+	}
+	return user, nil
+}
+
+// ViewerID returns the user behind an optional access token, or uuid.Nil
+// for anonymous callers and bad tokens. Reads use it to show users their
+// own shadow-banned chirps.
+func (s *Service) ViewerID(token string) uuid.UUID {
+	if token == "" {
+		return uuid.Nil
+	}
+	userID, err := auth.ValidateJWT(token, s.JWTKEY)
+	if err != nil {
+		return uuid.Nil
+	}
+	return userID
+}
+
+func (s *Service) SignUp(ctx context.Context, params Credentials) (database.User, error) {
+	hashPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		return database.User{}, hashPasswordError(err)
+	}
+
+	user, err := s.Db.CreateUser(ctx, database.CreateUserParams{
+		ID:             uuid.New(),
+		CreatedAt:      time.Now(),
+		UpdatedAt:      time.Now(),
+		Email:          params.Email,
+		HashedPassword: hashPassword,
+	})
+	if database.IsUniqueViolation(err) {
+		return database.User{}, emailTaken()
+	}
+	if err != nil {
+		return database.User{}, utils.Internal("Unable to create user", err)
+	}
+	return user, nil
+}
+
+func (s *Service) UpdateCredentials(ctx context.Context, user database.User, params Credentials) (database.User, error) {
+	hashPassword, err := auth.HashPassword(params.Password)
+	if err != nil {
+		return database.User{}, hashPasswordError(err)
+	}
+
+	err = s.Db.UpdateUserEmailAndPassword(ctx, database.UpdateUserEmailAndPasswordParams{
+		Email:          params.Email,
+		ID:             user.ID,
+		HashedPassword: hashPassword,
+	})
+	if database.IsUniqueViolation(err) {
+		return database.User{}, emailTaken()
+	}
+	if err != nil {
+		return database.User{}, utils.Internal("Error updating email and password", err)
+	}
+
+	updated, err := s.Db.GetUserByID(ctx, user.ID)
+	if err != nil {
+		return database.User{}, utils.Internal("Unable to fetch updated user", err)
+	}
+	return updated, nil
+}
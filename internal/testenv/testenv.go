@@ -0,0 +1,74 @@
+// Package testenv builds the API configuration that the REST, client and
+// gRPC tests run against: an in-memory store seeded as the migrations seed
+// a new database.
+package testenv
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/feed"
+	"github.com/k3vwdd/chirpyWS/internal/memstore"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
+	"github.com/k3vwdd/chirpyWS/internal/types"
+)
+
+const (
+	JWTKey   = "test-jwt-key-0123456789abcdef0123"
+	PolkaKey = "test-polka-key"
+)
+
+// seededWords are the words 007_moderation_rules.sql masks.
+var seededWords = []string{"kerfuffle", "sharbert", "fornax"}
+
+type Env struct {
+	Store  *memstore.Store
+	Config *types.ApiConfig
+	// CloseStreams ends watch streams as a server shutdown does. It also
+	// runs when the test ends.
+	CloseStreams context.CancelFunc
+}
+
+// New returns a dev configuration over a fresh store, with the seeded
+// moderation rules loaded and a feed for watchers. Tests change the config
+// before serving it.
+func New(t testing.TB) *Env {
+	t.Helper()
+	ctx := context.Background()
+	store := memstore.New()
+
+	for _, word := range seededWords {
+		_, err := store.CreateModerationRule(ctx, database.CreateModerationRuleParams{
+			ID: uuid.New(), Kind: moderation.KindWord, Pattern: word, Action: moderation.ActionMask, Enabled: true,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := moderation.NewEngine(store)
+	if err := engine.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	streamsCtx, closeStreams := context.WithCancel(ctx)
+	t.Cleanup(closeStreams)
+
+	return &Env{
+		Store: store,
+		Config: &types.ApiConfig{
+			Db:                  store,
+			Metrics:             metrics.New(nil),
+			Platform:            "dev",
+			JWTKEY:              JWTKey,
+			APIKEY:              PolkaKey,
+			Moderation:          engine,
+			ReportHideThreshold: 2,
+			StreamsCtx:          streamsCtx,
+			ChirpFeed:           feed.New(),
+		},
+		CloseStreams: closeStreams,
+	}
+}
@@ -0,0 +1,84 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// DB wraps a database.DBTX and starts a client span for every statement.
+// Pass it to database.New in place of the *sql.DB so the generated code
+// doesn't need to know about tracing.
+type DB struct {
+	database.DBTX
+}
+
+func WrapDB(db database.DBTX) *DB {
+	return &DB{DBTX: db}
+}
+
+// queryName pulls the name out of the "-- name: GetChirpByID :one" header
+// sqlc puts on every query.
+func queryName(query string) string {
+	rest, ok := strings.CutPrefix(query, "-- name: ")
+	if !ok {
+		return "query"
+	}
+	name, _, _ := strings.Cut(rest, " ")
+	return name
+}
+
+func startQuery(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return Tracer().Start(ctx, "db "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.operation.name", name),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+func endQuery(span trace.Span, err error) {
+	if err != nil && err != sql.ErrNoRows {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := startQuery(ctx, query)
+	result, err := db.DBTX.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return result, err
+}
+
+func (db *DB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := startQuery(ctx, query)
+	stmt, err := db.DBTX.PrepareContext(ctx, query)
+	endQuery(span, err)
+	return stmt, err
+}
+
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, query)
+	rows, err := db.DBTX.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+// QueryRowContext ends its span before the row is scanned, so the span covers
+// the round trip but a missing row only shows up in the caller.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := startQuery(ctx, query)
+	row := db.DBTX.QueryRowContext(ctx, query, args...)
+	endQuery(span, row.Err())
+	return row
+}
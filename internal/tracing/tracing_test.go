@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func recordSpans(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+	return recorder
+}
+
+type fakeDB struct {
+	queries []string
+}
+
+func (db *fakeDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	db.queries = append(db.queries, query)
+	return nil, nil
+}
+
+func (db *fakeDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return nil, nil
+}
+
+func (db *fakeDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return nil, sql.ErrConnDone
+}
+
+func (db *fakeDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestDBSpans(t *testing.T) {
+	recorder := recordSpans(t)
+	inner := &fakeDB{}
+	db := WrapDB(inner)
+
+	db.ExecContext(context.Background(), "-- name: DeleteChirpByID :exec\nDELETE FROM chirps WHERE id = $1", 1)
+	db.QueryContext(context.Background(), "SELECT 1")
+
+	if len(inner.queries) != 1 {
+		t.Fatalf("wrapped DB ran %d queries, want 1", len(inner.queries))
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+	if spans[0].Name() != "db DeleteChirpByID" {
+		t.Errorf("span name = %q", spans[0].Name())
+	}
+	if spans[1].Name() != "db query" || len(spans[1].Events()) == 0 {
+		t.Errorf("failed query span = %q with %d events, want the error recorded", spans[1].Name(), len(spans[1].Events()))
+	}
+}
@@ -1,15 +1,45 @@
 package types
 
 import (
-    "sync/atomic"
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+
 	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/feed"
+	"github.com/k3vwdd/chirpyWS/internal/health"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
 )
 
 
 type ApiConfig struct {
-	FileServerHits atomic.Int32
-    Db *database.Queries
+    Metrics *metrics.Metrics
+    Db database.Store
     Platform string
     JWTKEY  string
     APIKEY string
+    Moderation *moderation.Engine
+    ReportHideThreshold int
+    // Readiness holds the checks behind /api/readyz.
+    Readiness *health.Checker
+    // StreamsCtx is cancelled when the server starts shutting down.
+    // Long-lived streams (WebSocket, SSE, gRPC watches) must return
+    // once it is done.
+    StreamsCtx context.Context
+    // ChirpFeed carries newly published chirps to watch streams.
+    ChirpFeed *feed.Feed
+    // RateLimiter applies the REST routes' rate limits to GraphQL and
+    // gRPC calls; nil leaves them unlimited.
+    RateLimiter RateLimiter
+}
+
+// RateLimiter is implemented by middleWare.RateLimiter.
+type RateLimiter interface {
+    ClientIP(r *http.Request) string
+    // Limit counts a call against the rule of the REST route pattern,
+    // by userID or, when that is uuid.Nil, by clientIP. It returns a 429
+    // *utils.Error once the rule is used up.
+    Limit(ctx context.Context, pattern, clientIP string, userID uuid.UUID) error
 }
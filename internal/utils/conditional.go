@@ -0,0 +1,93 @@
+package utils
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// StrongETag derives an entity tag from parts, which together must change
+// whenever the response body does.
+func StrongETag(parts ...string) string {
+	return `"` + etagHash(parts) + `"`
+}
+
+// WeakETag is StrongETag for responses that are only semantically
+// equivalent while parts stay the same.
+func WeakETag(parts ...string) string {
+	return `W/"` + etagHash(parts) + `"`
+}
+
+func etagHash(parts []string) string {
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:16])
+}
+
+// NotModified sets ETag and, unless lastModified is zero, Last-Modified,
+// then evaluates If-None-Match and If-Modified-Since as RFC 9110 section
+// 13.2.2 orders them. If the client's copy is current it writes 304 and
+// returns true, and the caller must not write a body. The 304 carries the
+// ETag variant RespondWithJSONHelper would give the format r negotiates;
+// list says whether the response would be a list, for NDJSON.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time, list bool) bool {
+	w.Header().Set("ETag", etag)
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	current := false
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		current = matchETag(ifNoneMatch, etag, false)
+	} else if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.IsZero() {
+		// HTTP dates have whole seconds.
+		current = !lastModified.Truncate(time.Second).After(since)
+	}
+	if !current {
+		return false
+	}
+	w.Header().Add("Vary", "Accept")
+	if variant := formatETagVariant(negotiateFormat(r, list)); variant != "" {
+		setETagVariant(w, variant)
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// CheckIfMatch returns a precondition failure unless r has no If-Match
+// header or it lists etag, compared strongly. The resource is assumed to
+// exist, so "*" always matches.
+func CheckIfMatch(r *http.Request, etag string) error {
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || matchETag(ifMatch, etag, true) {
+		return nil
+	}
+	return PreconditionFailed("Resource has changed; fetch it again")
+}
+
+// matchETag reports whether the comma-separated list header contains etag
+// in any of its variants. Weak comparison ignores W/ prefixes; strong
+// comparison never matches a weak tag.
+func matchETag(header, etag string, strong bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = stripETagVariants(strings.TrimSpace(candidate))
+		if candidate == "*" {
+			return true
+		}
+		if strong {
+			if candidate == etag && !strings.HasPrefix(etag, "W/") {
+				return true
+			}
+			continue
+		}
+		if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
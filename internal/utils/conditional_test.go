@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNotModified(t *testing.T) {
+	etag := StrongETag("chirp", "1")
+	modified := time.Date(2026, time.October, 19, 12, 0, 0, 500, time.UTC)
+
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		want    bool
+	}{
+		{"no validators", "GET", nil, false},
+		{"matching etag", "GET", map[string]string{"If-None-Match": etag}, true},
+		{"weak form of the etag", "GET", map[string]string{"If-None-Match": "W/" + etag}, true},
+		{"one of several", "GET", map[string]string{"If-None-Match": `"other", ` + etag}, true},
+		{"any", "HEAD", map[string]string{"If-None-Match": "*"}, true},
+		{"stale etag", "GET", map[string]string{"If-None-Match": `"other"`}, false},
+		{"not a GET", "DELETE", map[string]string{"If-None-Match": etag}, false},
+		{"modified since", "GET", map[string]string{"If-Modified-Since": modified.Add(-time.Second).Format(http.TimeFormat)}, false},
+		{"not modified since", "GET", map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)}, true},
+		{"bad date", "GET", map[string]string{"If-Modified-Since": "yesterday"}, false},
+		{"If-None-Match wins", "GET", map[string]string{
+			"If-None-Match":     `"other"`,
+			"If-Modified-Since": modified.Format(http.TimeFormat),
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			if got := NotModified(rec, req, etag, modified, false); got != tt.want {
+				t.Fatalf("NotModified = %v, want %v", got, tt.want)
+			}
+			if tt.want && rec.Code != http.StatusNotModified {
+				t.Errorf("status = %d, want 304", rec.Code)
+			}
+			if rec.Header().Get("ETag") != etag || rec.Header().Get("Last-Modified") != modified.Format(http.TimeFormat) {
+				t.Errorf("validators = %v", rec.Header())
+			}
+		})
+	}
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	etag := StrongETag("chirp", "1")
+	tests := []struct {
+		ifMatch string
+		ok      bool
+	}{
+		{"", true},
+		{etag, true},
+		{`"other", ` + etag, true},
+		{"*", true},
+		{`"other"`, false},
+		{"W/" + etag, false},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("DELETE", "/", nil)
+		if tt.ifMatch != "" {
+			req.Header.Set("If-Match", tt.ifMatch)
+		}
+		err := CheckIfMatch(req, etag)
+		if tt.ok != (err == nil) {
+			t.Errorf("If-Match %q: err = %v", tt.ifMatch, err)
+		}
+		var apiErr *Error
+		if err != nil && (!errors.As(err, &apiErr) || apiErr.Status != http.StatusPreconditionFailed) {
+			t.Errorf("If-Match %q: err = %v, want a 412", tt.ifMatch, err)
+		}
+	}
+
+	if err := CheckIfMatch(httptest.NewRequest("DELETE", "/", nil), WeakETag("list")); err != nil {
+		t.Errorf("no If-Match against a weak tag = %v", err)
+	}
+}
@@ -0,0 +1,261 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/mail"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// MaxBodyBytes is the largest request body DecodeJSON reads by default.
+const MaxBodyBytes = 1 << 20
+
+// DecodeOptions loosens DecodeJSONWith for bodies Chirpy doesn't control.
+type DecodeOptions struct {
+	// MaxBytes defaults to MaxBodyBytes.
+	MaxBytes int64
+	// AllowUnknownFields accepts fields dst doesn't declare, for webhooks
+	// whose senders add fields without telling us.
+	AllowUnknownFields bool
+}
+
+// DecodeJSON reads exactly one JSON value from the request body into dst,
+// rejecting unknown fields, and then checks dst's validate tags. The error
+// is an *Error ready for RespondWithError.
+func DecodeJSON(w http.ResponseWriter, r *http.Request, dst any) error {
+	return DecodeJSONWith(w, r, dst, DecodeOptions{})
+}
+
+func DecodeJSONWith(w http.ResponseWriter, r *http.Request, dst any, opts DecodeOptions) error {
+	maxBytes := opts.MaxBytes
+	if maxBytes <= 0 {
+		maxBytes = MaxBodyBytes
+	}
+	body := http.MaxBytesReader(w, r.Body, maxBytes)
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	if !opts.AllowUnknownFields {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(dst); err != nil {
+		return decodeError(err)
+	}
+	if err := dec.Decode(&struct{}{}); err != io.EOF {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return decodeError(err)
+		}
+		return NewError(http.StatusBadRequest, CodeInvalidJSON, "Request body must contain a single JSON value")
+	}
+
+	if details := Validate(dst); len(details) > 0 {
+		return Validation(details...)
+	}
+	return nil
+}
+
+func decodeError(err error) *Error {
+	var tooLarge *http.MaxBytesError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &tooLarge):
+		return NewError(http.StatusRequestEntityTooLarge, CodeBodyTooLarge,
+			fmt.Sprintf("Request body is larger than %d bytes", tooLarge.Limit))
+	case errors.Is(err, io.EOF):
+		return NewError(http.StatusBadRequest, CodeInvalidJSON, "Request body is empty")
+	case errors.As(err, &typeErr) && typeErr.Field != "":
+		return Validation(FieldError{Field: typeErr.Field, Message: "must be " + jsonTypeName(typeErr.Type)})
+	}
+
+	// encoding/json has no typed error for unknown fields.
+	if field, ok := strings.CutPrefix(err.Error(), "json: unknown field "); ok {
+		if unquoted, err := strconv.Unquote(field); err == nil {
+			field = unquoted
+		}
+		return Validation(FieldError{Field: field, Message: "is not allowed"})
+	}
+	return InvalidJSON(err)
+}
+
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "a string"
+	case reflect.Bool:
+		return "a boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "an integer"
+	case reflect.Float32, reflect.Float64:
+		return "a number"
+	case reflect.Slice, reflect.Array:
+		return "an array"
+	default:
+		return "an object"
+	}
+}
+
+// Validate checks the validate struct tags of v, a struct or a pointer to
+// one, and returns every failing field. Fields are named by their JSON
+// path, such as "data.user_id". A tag is a comma separated list of rules:
+//
+//	required    not the zero value (for strings, not blank)
+//	min=N       strings: at least N characters; numbers: at least N
+//	max=N       strings: at most N characters; numbers: at most N
+//	email       a bare email address
+//	uuid        a UUID
+//	oneof=a b   one of the space separated values
+//
+// Rules other than required skip zero values, so optional fields only need
+// to be valid when present. An unknown rule is a programming error and
+// panics.
+func Validate(v any) []FieldError {
+	var details []FieldError
+	validateStruct(reflect.ValueOf(v), "", &details)
+	return details
+}
+
+func validateStruct(v reflect.Value, prefix string, details *[]FieldError) {
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	t := v.Type()
+	for i := range t.NumField() {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, hasName := jsonFieldName(field)
+		if name == "-" {
+			continue
+		}
+		value := v.Field(i)
+		if field.Anonymous && !hasName {
+			validateStruct(value, prefix, details)
+			continue
+		}
+
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		if message := checkRules(value, field.Tag.Get("validate")); message != "" {
+			*details = append(*details, FieldError{Field: path, Message: message})
+			continue
+		}
+		validateStruct(value, path, details)
+	}
+}
+
+func jsonFieldName(field reflect.StructField) (string, bool) {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "" {
+		return field.Name, false
+	}
+	return name, true
+}
+
+// checkRules returns a message for the first rule value breaks, or "".
+func checkRules(value reflect.Value, tag string) string {
+	if tag == "" {
+		return ""
+	}
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+
+	rules := strings.Split(tag, ",")
+	if isBlank(value) {
+		for _, rule := range rules {
+			if rule == "required" {
+				return "is required"
+			}
+		}
+		return ""
+	}
+
+	for _, rule := range rules {
+		name, arg, _ := strings.Cut(rule, "=")
+		var message string
+		switch name {
+		case "required":
+		case "min", "max":
+			message = checkBound(value, name, arg)
+		case "email":
+			address, err := mail.ParseAddress(value.String())
+			if err != nil || address.Address != value.String() {
+				message = "must be a valid email address"
+			}
+		case "uuid":
+			if _, err := uuid.Parse(value.String()); err != nil {
+				message = "must be a UUID"
+			}
+		case "oneof":
+			options := strings.Fields(arg)
+			if !slices.Contains(options, value.String()) {
+				message = "must be one of " + strings.Join(options, ", ")
+			}
+		default:
+			panic("utils: unknown validate rule " + strconv.Quote(rule))
+		}
+		if message != "" {
+			return message
+		}
+	}
+	return ""
+}
+
+func isBlank(value reflect.Value) bool {
+	if value.Kind() == reflect.Pointer {
+		return value.IsNil()
+	}
+	if value.Kind() == reflect.String {
+		return strings.TrimSpace(value.String()) == ""
+	}
+	return value.IsZero()
+}
+
+func checkBound(value reflect.Value, rule, arg string) string {
+	limit, err := strconv.Atoi(arg)
+	if err != nil {
+		panic("utils: validate rule " + rule + " needs an integer, got " + strconv.Quote(arg))
+	}
+
+	var n int64
+	unit := ""
+	switch value.Kind() {
+	case reflect.String:
+		n, unit = int64(utf8.RuneCountInString(value.String())), " characters"
+	case reflect.Slice, reflect.Map, reflect.Array:
+		n, unit = int64(value.Len()), " items"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n = value.Int()
+	default:
+		panic("utils: validate rule " + rule + " doesn't apply to " + value.Kind().String())
+	}
+
+	if rule == "min" && n < int64(limit) {
+		return "must be at least " + arg + unit
+	}
+	if rule == "max" && n > int64(limit) {
+		return "must be at most " + arg + unit
+	}
+	return ""
+}
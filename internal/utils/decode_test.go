@@ -0,0 +1,131 @@
+package utils
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type signUp struct {
+	Email    string `json:"email" validate:"required,email,max=254"`
+	Password string `json:"password" validate:"required,min=8"`
+	Role     string `json:"role" validate:"oneof=user admin"`
+	Age      int    `json:"age" validate:"max=150"`
+	Invite   *struct {
+		Code string `json:"code" validate:"required,uuid"`
+	} `json:"invite"`
+}
+
+func decode(t *testing.T, body string, dst any, opts DecodeOptions) *Error {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	err := DecodeJSONWith(httptest.NewRecorder(), req, dst, opts)
+	if err == nil {
+		return nil
+	}
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		t.Fatalf("error %v is not an *Error", err)
+	}
+	return apiErr
+}
+
+func TestDecodeJSON(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		opts   DecodeOptions
+		status int
+		code   string
+		fields map[string]string
+	}{
+		{name: "valid", body: `{"email":"a@example.com","password":"longenough","role":"admin","invite":{"code":"6f1c4c3e-8f7a-4c52-9d8e-0a2b1c3d4e5f"}}`},
+		{name: "optional fields omitted", body: `{"email":"a@example.com","password":"longenough"}`},
+		{
+			name: "every field error at once", body: `{"email":"not an email","password":"short","role":"root","age":200,"invite":{"code":"nope"}}`,
+			status: http.StatusBadRequest, code: CodeValidationFailed,
+			fields: map[string]string{
+				"email":       "must be a valid email address",
+				"password":    "must be at least 8 characters",
+				"role":        "must be one of user, admin",
+				"age":         "must be at most 150",
+				"invite.code": "must be a UUID",
+			},
+		},
+		{
+			name: "blank required", body: `{"email":"  ","invite":{}}`,
+			status: http.StatusBadRequest, code: CodeValidationFailed,
+			fields: map[string]string{"email": "is required", "password": "is required", "invite.code": "is required"},
+		},
+		{
+			name: "display name is not a bare address", body: `{"email":"Alice <a@example.com>","password":"longenough"}`,
+			status: http.StatusBadRequest, code: CodeValidationFailed,
+			fields: map[string]string{"email": "must be a valid email address"},
+		},
+		{
+			name: "unknown field", body: `{"email":"a@example.com","password":"longenough","admin":true}`,
+			status: http.StatusBadRequest, code: CodeValidationFailed,
+			fields: map[string]string{"admin": "is not allowed"},
+		},
+		{
+			name: "unknown field allowed", body: `{"email":"a@example.com","password":"longenough","admin":true}`,
+			opts: DecodeOptions{AllowUnknownFields: true},
+		},
+		{
+			name: "wrong type", body: `{"email":"a@example.com","password":"longenough","age":"old"}`,
+			status: http.StatusBadRequest, code: CodeValidationFailed,
+			fields: map[string]string{"age": "must be an integer"},
+		},
+		{name: "trailing data", body: `{"email":"a@example.com","password":"longenough"} {}`, status: http.StatusBadRequest, code: CodeInvalidJSON},
+		{name: "syntax error", body: `{"email":`, status: http.StatusBadRequest, code: CodeInvalidJSON},
+		{name: "empty", body: ``, status: http.StatusBadRequest, code: CodeInvalidJSON},
+		{
+			name: "too large", body: `{"email":"a@example.com","password":"` + strings.Repeat("x", 100) + `"}`,
+			opts: DecodeOptions{MaxBytes: 64}, status: http.StatusRequestEntityTooLarge, code: CodeBodyTooLarge,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var dst signUp
+			err := decode(t, tt.body, &dst, tt.opts)
+			if tt.code == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v (%+v)", err, err.Details)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %s", tt.code)
+			}
+			if err.Status != tt.status || err.Code != tt.code {
+				t.Errorf("got %d %s, want %d %s", err.Status, err.Code, tt.status, tt.code)
+			}
+			got := map[string]string{}
+			for _, detail := range err.Details {
+				got[detail.Field] = detail.Message
+			}
+			if len(got) != len(tt.fields) {
+				t.Errorf("field errors = %v, want %v", got, tt.fields)
+			}
+			for field, message := range tt.fields {
+				if got[field] != message {
+					t.Errorf("%s: %q, want %q", field, got[field], message)
+				}
+			}
+		})
+	}
+}
+
+func TestValidateUnknownRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for an unknown rule")
+		}
+	}()
+	Validate(struct {
+		Name string `validate:"required,shiny"`
+	}{Name: "x"})
+}
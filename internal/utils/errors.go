@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+)
+
+// Error codes are part of the API: clients switch on them, so existing
+// codes must never change meaning.
+const (
+	CodeBadRequest         = "bad_request"
+	CodeInvalidJSON        = "invalid_json"
+	CodeBodyTooLarge       = "body_too_large"
+	CodeValidationFailed   = "validation_failed"
+	CodeContentRejected    = "content_rejected"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeAccountSuspended   = "account_suspended"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeEmailTaken         = "email_taken"
+	CodePreconditionFailed = "precondition_failed"
+	CodeIdempotencyReused  = "idempotency_key_reused"
+	CodeIdempotencyInUse   = "idempotency_key_in_use"
+	CodeRateLimited        = "rate_limited"
+	CodeQueryTooComplex    = "query_too_complex"
+	CodeUnavailable        = "unavailable"
+	CodeInternal           = "internal_error"
+)
+
+// ProblemTypePrefix turns a code into the problem "type" URI.
+const ProblemTypePrefix = "urn:chirpy:problem:"
+
+// FieldError describes one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Error is an API error. Status, Code, Message and Details are sent to the
+// client; Err is the underlying cause and is only logged.
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+	Details []FieldError
+	Err     error
+}
+
+func NewError(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Wrap returns a copy of e caused by err.
+func (e *Error) Wrap(err error) *Error {
+	wrapped := *e
+	wrapped.Err = err
+	return &wrapped
+}
+
+func BadRequest(message string) *Error {
+	return NewError(http.StatusBadRequest, CodeBadRequest, message)
+}
+
+// InvalidJSON reports a body that isn't the JSON the endpoint expects.
+func InvalidJSON(err error) *Error {
+	return NewError(http.StatusBadRequest, CodeInvalidJSON, "Request body is not valid JSON").Wrap(err)
+}
+
+// Validation reports a well-formed body with invalid fields.
+func Validation(details ...FieldError) *Error {
+	e := NewError(http.StatusBadRequest, CodeValidationFailed, "Request has invalid fields")
+	e.Details = details
+	return e
+}
+
+func Unauthorized(message string) *Error {
+	return NewError(http.StatusUnauthorized, CodeUnauthorized, message)
+}
+
+func Forbidden(message string) *Error {
+	return NewError(http.StatusForbidden, CodeForbidden, message)
+}
+
+func NotFound(message string) *Error {
+	return NewError(http.StatusNotFound, CodeNotFound, message)
+}
+
+func Conflict(message string) *Error {
+	return NewError(http.StatusConflict, CodeConflict, message)
+}
+
+// PreconditionFailed reports an If-Match header that no longer matches.
+func PreconditionFailed(message string) *Error {
+	return NewError(http.StatusPreconditionFailed, CodePreconditionFailed, message)
+}
+
+// LookupError maps a failed single-row lookup: a missing row is a 404 with
+// the given message, anything else a 500.
+func LookupError(err error, notFound string) *Error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return NotFound(notFound)
+	}
+	return Internal("Database lookup failed", err)
+}
+
+// Internal hides err from the client; RespondWithError logs it.
+func Internal(message string, err error) *Error {
+	return NewError(http.StatusInternalServerError, CodeInternal, message).Wrap(err)
+}
+
+// Problem is the RFC 7807 application/problem+json body.
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	Instance  string       `json:"instance,omitempty"`
+	Code      string       `json:"code"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// RespondWithError writes err as a problem. Errors that aren't an *Error
+// become a generic 500; server errors are logged with their cause.
+func RespondWithError(w http.ResponseWriter, r *http.Request, err error) {
+	var apiErr *Error
+	if !errors.As(err, &apiErr) {
+		apiErr = Internal("Internal server error", err)
+	}
+
+	if apiErr.Status >= http.StatusInternalServerError {
+		logging.FromContext(r.Context()).Error(apiErr.Message, "code", apiErr.Code, "err", apiErr.Err)
+	}
+
+	problem := Problem{
+		Type:      ProblemTypePrefix + apiErr.Code,
+		Title:     http.StatusText(apiErr.Status),
+		Status:    apiErr.Status,
+		Detail:    apiErr.Message,
+		Instance:  r.URL.Path,
+		Code:      apiErr.Code,
+		RequestID: logging.RequestID(r.Context()),
+		Errors:    apiErr.Details,
+	}
+
+	response, err := json.Marshal(problem)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/problem+json")
+	w.WriteHeader(apiErr.Status)
+	w.Write(response)
+}
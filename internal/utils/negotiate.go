@@ -0,0 +1,264 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Media types RespondWithJSONHelper can answer with. NDJSON is only
+// offered for lists.
+const (
+	MediaJSON    = "application/json"
+	MediaMsgPack = "application/msgpack"
+	MediaCBOR    = "application/cbor"
+	MediaNDJSON  = "application/x-ndjson"
+)
+
+// ndjsonETagVariant tells NDJSON lists' ETags apart from JSON's.
+const ndjsonETagVariant = "ndjson"
+
+// ndjsonFlushEvery is how many lines an NDJSON response writes between
+// flushes.
+const ndjsonFlushEvery = 100
+
+// mediaAliases maps other names clients use to the types above.
+var mediaAliases = map[string]string{
+	"application/x-msgpack":   MediaMsgPack,
+	"application/vnd.msgpack": MediaMsgPack,
+	"application/ndjson":      MediaNDJSON,
+	"application/jsonl":       MediaNDJSON,
+}
+
+// Accepted is one entry of an Accept or Accept-Encoding header.
+type Accepted struct {
+	Value string
+	Q     float64
+}
+
+// ParseAccept splits an Accept-style header into lowercased values and
+// their q weights, highest first. Other parameters are dropped, and
+// entries with a malformed q count as q=0.
+func ParseAccept(header string) []Accepted {
+	var accepted []Accepted
+	for _, entry := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(entry, ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			name, raw, ok := strings.Cut(param, "=")
+			if !ok || strings.TrimSpace(strings.ToLower(name)) != "q" {
+				continue
+			}
+			parsed, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+			if err != nil || parsed < 0 || parsed > 1 {
+				parsed = 0
+			}
+			q = parsed
+		}
+		accepted = append(accepted, Accepted{Value: value, Q: q})
+	}
+	sort.SliceStable(accepted, func(i, j int) bool { return accepted[i].Q > accepted[j].Q })
+	return accepted
+}
+
+// NegotiateMediaType picks the offer the Accept header rates highest,
+// preferring earlier offers on ties. A client that accepts none of them
+// still gets the first: an API error is more useful to it than a 406.
+func NegotiateMediaType(accept string, offers ...string) string {
+	if accept == "" {
+		return offers[0]
+	}
+	ranges := ParseAccept(accept)
+	best, bestQ := offers[0], 0.0
+	for _, offer := range offers {
+		if q := mediaQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// negotiateFormat picks the media type to answer r with. NDJSON is only
+// offered when the response is a list.
+func negotiateFormat(r *http.Request, list bool) string {
+	offers := []string{MediaJSON, MediaMsgPack, MediaCBOR}
+	if list {
+		offers = append(offers, MediaNDJSON)
+	}
+	return NegotiateMediaType(r.Header.Get("Accept"), offers...)
+}
+
+// mediaQuality is the q of the most specific range matching offer.
+func mediaQuality(ranges []Accepted, offer string) float64 {
+	major, _, _ := strings.Cut(offer, "/")
+	q, specificity := 0.0, -1
+	for _, r := range ranges {
+		value := r.Value
+		if alias, ok := mediaAliases[value]; ok {
+			value = alias
+		}
+		s := -1
+		switch value {
+		case offer:
+			s = 2
+		case major + "/*":
+			s = 1
+		case "*/*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = r.Q, s
+		}
+	}
+	return q
+}
+
+// responseFormat is how one media type is written.
+type responseFormat struct {
+	mediaType string
+	// etagVariant tells this representation's ETags apart from JSON's.
+	etagVariant string
+	marshal     func(payload any) ([]byte, error)
+}
+
+var cborMode = func() cbor.EncMode {
+	mode, err := cbor.CoreDetEncOptions().EncMode()
+	if err != nil {
+		panic(err)
+	}
+	return mode
+}()
+
+var responseFormats = map[string]responseFormat{
+	MediaJSON: {mediaType: MediaJSON, marshal: json.Marshal},
+	MediaMsgPack: {mediaType: MediaMsgPack, etagVariant: "msgpack", marshal: func(payload any) ([]byte, error) {
+		doc, err := jsonDocument(payload)
+		if err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetSortMapKeys(true)
+		if err := enc.Encode(doc); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}},
+	MediaCBOR: {mediaType: MediaCBOR, etagVariant: "cbor", marshal: func(payload any) ([]byte, error) {
+		doc, err := jsonDocument(payload)
+		if err != nil {
+			return nil, err
+		}
+		return cborMode.Marshal(doc)
+	}},
+}
+
+// formatETagVariant is the ETag variant of responses in mediaType, or ""
+// for JSON.
+func formatETagVariant(mediaType string) string {
+	if mediaType == MediaNDJSON {
+		return ndjsonETagVariant
+	}
+	return responseFormats[mediaType].etagVariant
+}
+
+// jsonDocument turns payload into the document its JSON encodes, so that
+// MessagePack and CBOR have the same field names and value types: ids and
+// times stay strings, and integers stay integers.
+func jsonDocument(payload any) (any, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var doc any
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return resolveNumbers(doc), nil
+}
+
+func resolveNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n
+		}
+		f, _ := v.Float64()
+		return f
+	case map[string]any:
+		for key, value := range v {
+			v[key] = resolveNumbers(value)
+		}
+	case []any:
+		for i, value := range v {
+			v[i] = resolveNumbers(value)
+		}
+	}
+	return v
+}
+
+// isList reports whether payload encodes as a JSON array.
+func isList(payload any) bool {
+	v := reflect.ValueOf(payload)
+	return v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8
+}
+
+// writeNDJSON streams list one JSON value per line, flushing as it goes
+// so clients can start on the first lines before the last are written.
+func writeNDJSON(w http.ResponseWriter, statuscode int, list any) error {
+	w.Header().Set("Content-Type", MediaNDJSON)
+	setETagVariant(w, ndjsonETagVariant)
+	w.WriteHeader(statuscode)
+
+	rc := http.NewResponseController(w)
+	enc := json.NewEncoder(w)
+	items := reflect.ValueOf(list)
+	for i := range items.Len() {
+		if err := enc.Encode(items.Index(i).Interface()); err != nil {
+			return err
+		}
+		if (i+1)%ndjsonFlushEvery == 0 {
+			rc.Flush()
+		}
+	}
+	return nil
+}
+
+// ETagVariant marks etag as belonging to one representation of a
+// resource, such as its CBOR or gzip form. Comparisons ignore variants, so
+// a validator from any representation works in If-Match and If-None-Match.
+func ETagVariant(etag, variant string) string {
+	if !strings.HasSuffix(etag, `"`) || len(etag) < 2 {
+		return etag
+	}
+	return etag[:len(etag)-1] + "-" + variant + `"`
+}
+
+// stripETagVariants undoes ETagVariant. The tags StrongETag and WeakETag
+// make are hex, so everything from the first "-" is a variant.
+func stripETagVariants(etag string) string {
+	if i := strings.IndexByte(etag, '-'); i >= 0 && strings.HasSuffix(etag, `"`) {
+		return etag[:i] + `"`
+	}
+	return etag
+}
+
+// setETagVariant applies variant to the ETag w already carries, if any.
+func setETagVariant(w http.ResponseWriter, variant string) {
+	if etag := w.Header().Get("ETag"); etag != "" {
+		w.Header().Set("ETag", ETagVariant(etag, variant))
+	}
+}
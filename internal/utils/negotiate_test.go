@@ -0,0 +1,191 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestNegotiateMediaType(t *testing.T) {
+	offers := []string{MediaJSON, MediaMsgPack, MediaCBOR, MediaNDJSON}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", MediaJSON},
+		{"*/*", MediaJSON},
+		{"application/cbor", MediaCBOR},
+		{"application/x-msgpack", MediaMsgPack},
+		{"application/vnd.msgpack, application/json;q=0.5", MediaMsgPack},
+		{"application/json;q=0.5, application/cbor", MediaCBOR},
+		{"application/ndjson", MediaNDJSON},
+		{"application/*;q=0.2, application/cbor;q=0.1", MediaJSON},
+		{"application/cbor;q=0, */*;q=0.1", MediaJSON},
+		{"text/html", MediaJSON},
+		{"application/cbor; charset=utf-8; q=0.9, application/json; q=0.8", MediaCBOR},
+	}
+	for _, tt := range tests {
+		if got := NegotiateMediaType(tt.accept, offers...); got != tt.want {
+			t.Errorf("NegotiateMediaType(%q) = %s, want %s", tt.accept, got, tt.want)
+		}
+	}
+}
+
+type negotiated struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Count     int       `json:"count"`
+	Note      string    `json:"note,omitempty"`
+}
+
+func respond(t *testing.T, accept string, payload any) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	rec.Header().Set("ETag", StrongETag("x"))
+	if err := RespondWithJSONHelper(rec, req, http.StatusOK, payload); err != nil {
+		t.Fatal(err)
+	}
+	return rec
+}
+
+func TestRespondFormats(t *testing.T) {
+	value := negotiated{ID: uuid.New(), CreatedAt: time.Date(2026, time.October, 19, 12, 0, 0, 0, time.UTC), Count: 3}
+	want := map[string]any{"id": value.ID.String(), "created_at": "2026-10-19T12:00:00Z", "count": int64(3)}
+
+	for _, format := range []struct {
+		mediaType string
+		decode    func([]byte) (map[string]any, error)
+	}{
+		{MediaMsgPack, func(data []byte) (map[string]any, error) {
+			var m map[string]any
+			return m, msgpack.Unmarshal(data, &m)
+		}},
+		{MediaCBOR, func(data []byte) (map[string]any, error) {
+			var m map[string]any
+			return m, cbor.Unmarshal(data, &m)
+		}},
+	} {
+		rec := respond(t, format.mediaType, value)
+		if rec.Header().Get("Content-Type") != format.mediaType {
+			t.Errorf("%s: Content-Type = %s", format.mediaType, rec.Header().Get("Content-Type"))
+		}
+		got, err := format.decode(rec.Body.Bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", format.mediaType, err)
+		}
+		// Both decoders hand back small integers in their own types.
+		if count, ok := got["count"]; ok {
+			got["count"] = toInt64(count)
+		}
+		if len(got) != len(want) || got["id"] != want["id"] || got["created_at"] != want["created_at"] || got["count"] != want["count"] {
+			t.Errorf("%s document = %v, want %v", format.mediaType, got, want)
+		}
+		if etag := rec.Header().Get("ETag"); !strings.HasSuffix(etag, `"`) || etag == StrongETag("x") {
+			t.Errorf("%s ETag = %s, want a variant", format.mediaType, etag)
+		}
+	}
+
+	rec := respond(t, "", value)
+	if rec.Header().Get("Content-Type") != MediaJSON || rec.Header().Get("ETag") != StrongETag("x") {
+		t.Errorf("default response headers = %v", rec.Header())
+	}
+	if rec.Header().Get("Vary") != "Accept" {
+		t.Errorf("Vary = %q", rec.Header().Get("Vary"))
+	}
+}
+
+func toInt64(v any) any {
+	switch n := v.(type) {
+	case int8:
+		return int64(n)
+	case int16:
+		return int64(n)
+	case int32:
+		return int64(n)
+	case uint8:
+		return int64(n)
+	case uint16:
+		return int64(n)
+	case uint32:
+		return int64(n)
+	case uint64:
+		return int64(n)
+	}
+	return v
+}
+
+func TestRespondNDJSON(t *testing.T) {
+	list := make([]negotiated, 250)
+	for i := range list {
+		list[i] = negotiated{ID: uuid.New(), Count: i}
+	}
+	rec := respond(t, MediaNDJSON, list)
+	if rec.Header().Get("Content-Type") != MediaNDJSON || !rec.Flushed {
+		t.Fatalf("headers = %v, flushed = %v", rec.Header(), rec.Flushed)
+	}
+	scanner := bufio.NewScanner(rec.Body)
+	n := 0
+	for ; scanner.Scan(); n++ {
+		var item negotiated
+		if err := json.Unmarshal(scanner.Bytes(), &item); err != nil || item != list[n] {
+			t.Fatalf("line %d = %s (%v)", n, scanner.Text(), err)
+		}
+	}
+	if n != len(list) {
+		t.Errorf("%d lines, want %d", n, len(list))
+	}
+
+	// NDJSON is only for lists.
+	if rec := respond(t, MediaNDJSON, list[0]); rec.Header().Get("Content-Type") != MediaJSON {
+		t.Errorf("single value as NDJSON: Content-Type = %s", rec.Header().Get("Content-Type"))
+	}
+}
+
+func TestETagVariants(t *testing.T) {
+	etag := StrongETag("chirp")
+	req := httptest.NewRequest("DELETE", "/", nil)
+	req.Header.Set("If-Match", ETagVariant(ETagVariant(etag, "cbor"), "gzip"))
+	if err := CheckIfMatch(req, etag); err != nil {
+		t.Errorf("If-Match with a variant = %v", err)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("If-None-Match", ETagVariant(etag, "msgpack"))
+	if !NotModified(httptest.NewRecorder(), req, etag, time.Time{}, false) {
+		t.Error("If-None-Match with a variant didn't match")
+	}
+
+	// A 304 carries the validators the 200 would have.
+	for _, tt := range []struct {
+		accept string
+		list   bool
+		want   string
+	}{
+		{"", false, etag},
+		{MediaCBOR, false, ETagVariant(etag, "cbor")},
+		{MediaMsgPack, true, ETagVariant(etag, "msgpack")},
+		{MediaNDJSON, true, ETagVariant(etag, "ndjson")},
+		{MediaNDJSON, false, etag},
+	} {
+		req = httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		req.Header.Set("If-None-Match", etag)
+		rec := httptest.NewRecorder()
+		if !NotModified(rec, req, etag, time.Time{}, tt.list) {
+			t.Fatalf("Accept %q: not a 304", tt.accept)
+		}
+		if got := rec.Header().Get("ETag"); got != tt.want {
+			t.Errorf("Accept %q, list %v: 304 ETag = %s, want %s", tt.accept, tt.list, got, tt.want)
+		}
+	}
+}
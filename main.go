@@ -1,79 +1,68 @@
 package main
 
 import (
-	"database/sql"
-	"log"
-	"net/http"
+	"fmt"
 	"os"
-
-	"github.com/joho/godotenv"
-	"github.com/k3vwdd/chirpyWS/internal/database"
-	"github.com/k3vwdd/chirpyWS/internal/handlers"
-	"github.com/k3vwdd/chirpyWS/internal/middleWare"
-	"github.com/k3vwdd/chirpyWS/internal/types"
-	_ "github.com/lib/pq"
+	"strings"
 )
 
-func main() {
-    godotenv.Load()
-    jwtKey := os.Getenv("JWTKEY")
-    polkaKey := os.Getenv("POLKA_KEY")
-    dbURL := os.Getenv("DB_URL")
-    dbDevURL := os.Getenv("PLATFORM")
-    db, err := sql.Open("postgres", dbURL)
-    if err != nil {
-        log.Fatalf("Error opening database: %v", err)
-    }
-
-    dbQueries := database.New(db)
-
-    apiCfg := &types.ApiConfig{
-        Db: dbQueries,
-        Platform: dbDevURL,
-        JWTKEY: jwtKey,
-        APIKEY: polkaKey,
-    }
-
-	cfg := &handlers.ApiConfig{
-        ApiConfig: apiCfg,
-    }
+const usage = `Usage: chirpy <command> [arguments]
 
-	mw := &middleWare.ApiConfig{
-        ApiConfig: apiCfg,
-    }
+Commands:
+  serve [flags]                           run the HTTP server (the default)
+  migrate up|down|status|redo|version     manage the database schema
+  user create --email E [--role R]        create a user; the password is read from stdin
+  user set-role --email E --role R        make a user a user, moderator or admin
+  user upgrade-red --email E              give a user Chirpy Red
+  user reset-password --email E           set a new password, read from stdin
+  tokens revoke-user --email E            revoke every refresh token of a user
+  chirps purge --author E|ID              delete every chirp by a user
+  seed --count N                          create N sample chirps (dev only)
+  export [--out FILE]                     write users and chirps as JSON
 
-	filepathRoot := "."
-	mux := http.NewServeMux()
-	loggedMux := middleWare.MiddlewareLogging(mux)
-	mux.Handle("/", http.FileServer(http.Dir(filepathRoot)))
-	// strips "/" off of /app/
+Commands other than serve read their settings from the config file, .env and
+the environment; run "chirpy serve -h" to list them.
+`
 
-	mux.Handle("/app/", http.StripPrefix("/app/", mw.MiddlewareMetricsInc((http.FileServer(http.Dir(filepathRoot))))))
-	mux.HandleFunc("GET /api/healthz", cfg.HandleHealthReadiness)
-    mux.HandleFunc("GET /api/chirps", cfg.HandleGetChirps)
-    mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.HandleGetSingleChirp)
-    mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.HandleDeleteChirp)
-    mux.HandleFunc("GET /admin/metrics", cfg.HandleWriteHits)
-    mux.HandleFunc("POST /api/users", cfg.HandleCreateUser)
-    mux.HandleFunc("POST /api/chirps", cfg.HandleCreateChirp)
-    mux.HandleFunc("POST /api/login", cfg.HandleLogin)
-    mux.HandleFunc("POST /api/refresh", cfg.HandleRefresh)
-    mux.HandleFunc("POST /api/revoke", cfg.HandleRevokeToken)
-    mux.HandleFunc("POST /api/polka/webhooks", cfg.HandleWebHook)
-	mux.HandleFunc("POST /admin/reset", cfg.HandleRegister)
-    mux.HandleFunc("PUT /api/users", cfg.HandleUpdateUser)
+// What main does with its arguments.
+const (
+	actionServe = iota
+	actionHelp
+	actionCommand
+)
 
-	port := "8080"
-	// a struct that describes a server configuration
-	server := &http.Server{
-		Addr:    ":" + port,
-		Handler: loggedMux,
+// parseArgs decides what the arguments ask for and returns the ones left
+// for it.
+func parseArgs(args []string) (action int, rest []string) {
+	switch {
+	case len(args) == 0:
+		return actionServe, nil
+	case args[0] == "serve":
+		return actionServe, args[1:]
+	case args[0] == "-h" || args[0] == "--help" || args[0] == "help":
+		return actionHelp, nil
+	case strings.HasPrefix(args[0], "-"):
+		// Flags without a command keep working as they did before
+		// subcommands existed.
+		return actionServe, args
 	}
+	return actionCommand, args
+}
 
-	err = server.ListenAndServe()
-	if err != nil {
-		log.Fatal(err)
+func main() {
+	action, args := parseArgs(os.Args[1:])
+	switch action {
+	case actionServe:
+		if err := serve(args); err != nil {
+			fmt.Fprintln(os.Stderr, "chirpy:", err)
+			os.Exit(1)
+		}
+	case actionHelp:
+		fmt.Print(usage)
+	case actionCommand:
+		if err := runCommand(args); err != nil {
+			fmt.Fprintln(os.Stderr, "chirpy:", err)
+			os.Exit(1)
+		}
 	}
-
-	log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
 }
@@ -0,0 +1,293 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: chirpy/v1/chirps.proto
+
+package chirpyv1
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	ChirpsService_ListChirps_FullMethodName  = "/chirpy.v1.ChirpsService/ListChirps"
+	ChirpsService_GetChirp_FullMethodName    = "/chirpy.v1.ChirpsService/GetChirp"
+	ChirpsService_CreateChirp_FullMethodName = "/chirpy.v1.ChirpsService/CreateChirp"
+	ChirpsService_DeleteChirp_FullMethodName = "/chirpy.v1.ChirpsService/DeleteChirp"
+	ChirpsService_WatchChirps_FullMethodName = "/chirpy.v1.ChirpsService/WatchChirps"
+)
+
+// ChirpsServiceClient is the client API for ChirpsService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// ChirpsService mirrors /api/v2/chirps. Reads take an optional access
+// token, which lets users see their own chirps while shadow-banned.
+type ChirpsServiceClient interface {
+	ListChirps(ctx context.Context, in *ListChirpsRequest, opts ...grpc.CallOption) (*ListChirpsResponse, error)
+	GetChirp(ctx context.Context, in *GetChirpRequest, opts ...grpc.CallOption) (*GetChirpResponse, error)
+	// CreateChirp needs an access token.
+	CreateChirp(ctx context.Context, in *CreateChirpRequest, opts ...grpc.CallOption) (*CreateChirpResponse, error)
+	// DeleteChirp needs an access token, and only deletes the caller's own chirps.
+	DeleteChirp(ctx context.Context, in *DeleteChirpRequest, opts ...grpc.CallOption) (*DeleteChirpResponse, error)
+	// WatchChirps streams chirps as they are published, until the client
+	// hangs up. A watcher that falls too far behind is disconnected with
+	// UNAVAILABLE and should reconnect.
+	WatchChirps(ctx context.Context, in *WatchChirpsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchChirpsResponse], error)
+}
+
+type chirpsServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewChirpsServiceClient(cc grpc.ClientConnInterface) ChirpsServiceClient {
+	return &chirpsServiceClient{cc}
+}
+
+func (c *chirpsServiceClient) ListChirps(ctx context.Context, in *ListChirpsRequest, opts ...grpc.CallOption) (*ListChirpsResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListChirpsResponse)
+	err := c.cc.Invoke(ctx, ChirpsService_ListChirps_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chirpsServiceClient) GetChirp(ctx context.Context, in *GetChirpRequest, opts ...grpc.CallOption) (*GetChirpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(GetChirpResponse)
+	err := c.cc.Invoke(ctx, ChirpsService_GetChirp_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chirpsServiceClient) CreateChirp(ctx context.Context, in *CreateChirpRequest, opts ...grpc.CallOption) (*CreateChirpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(CreateChirpResponse)
+	err := c.cc.Invoke(ctx, ChirpsService_CreateChirp_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chirpsServiceClient) DeleteChirp(ctx context.Context, in *DeleteChirpRequest, opts ...grpc.CallOption) (*DeleteChirpResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteChirpResponse)
+	err := c.cc.Invoke(ctx, ChirpsService_DeleteChirp_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *chirpsServiceClient) WatchChirps(ctx context.Context, in *WatchChirpsRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[WatchChirpsResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &ChirpsService_ServiceDesc.Streams[0], ChirpsService_WatchChirps_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[WatchChirpsRequest, WatchChirpsResponse]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ChirpsService_WatchChirpsClient = grpc.ServerStreamingClient[WatchChirpsResponse]
+
+// ChirpsServiceServer is the server API for ChirpsService service.
+// All implementations must embed UnimplementedChirpsServiceServer
+// for forward compatibility.
+//
+// ChirpsService mirrors /api/v2/chirps. Reads take an optional access
+// token, which lets users see their own chirps while shadow-banned.
+type ChirpsServiceServer interface {
+	ListChirps(context.Context, *ListChirpsRequest) (*ListChirpsResponse, error)
+	GetChirp(context.Context, *GetChirpRequest) (*GetChirpResponse, error)
+	// CreateChirp needs an access token.
+	CreateChirp(context.Context, *CreateChirpRequest) (*CreateChirpResponse, error)
+	// DeleteChirp needs an access token, and only deletes the caller's own chirps.
+	DeleteChirp(context.Context, *DeleteChirpRequest) (*DeleteChirpResponse, error)
+	// WatchChirps streams chirps as they are published, until the client
+	// hangs up. A watcher that falls too far behind is disconnected with
+	// UNAVAILABLE and should reconnect.
+	WatchChirps(*WatchChirpsRequest, grpc.ServerStreamingServer[WatchChirpsResponse]) error
+	mustEmbedUnimplementedChirpsServiceServer()
+}
+
+// UnimplementedChirpsServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedChirpsServiceServer struct{}
+
+func (UnimplementedChirpsServiceServer) ListChirps(context.Context, *ListChirpsRequest) (*ListChirpsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListChirps not implemented")
+}
+func (UnimplementedChirpsServiceServer) GetChirp(context.Context, *GetChirpRequest) (*GetChirpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetChirp not implemented")
+}
+func (UnimplementedChirpsServiceServer) CreateChirp(context.Context, *CreateChirpRequest) (*CreateChirpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateChirp not implemented")
+}
+func (UnimplementedChirpsServiceServer) DeleteChirp(context.Context, *DeleteChirpRequest) (*DeleteChirpResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteChirp not implemented")
+}
+func (UnimplementedChirpsServiceServer) WatchChirps(*WatchChirpsRequest, grpc.ServerStreamingServer[WatchChirpsResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method WatchChirps not implemented")
+}
+func (UnimplementedChirpsServiceServer) mustEmbedUnimplementedChirpsServiceServer() {}
+func (UnimplementedChirpsServiceServer) testEmbeddedByValue()                       {}
+
+// UnsafeChirpsServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to ChirpsServiceServer will
+// result in compilation errors.
+type UnsafeChirpsServiceServer interface {
+	mustEmbedUnimplementedChirpsServiceServer()
+}
+
+func RegisterChirpsServiceServer(s grpc.ServiceRegistrar, srv ChirpsServiceServer) {
+	// If the following call pancis, it indicates UnimplementedChirpsServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&ChirpsService_ServiceDesc, srv)
+}
+
+func _ChirpsService_ListChirps_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListChirpsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChirpsServiceServer).ListChirps(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChirpsService_ListChirps_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChirpsServiceServer).ListChirps(ctx, req.(*ListChirpsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChirpsService_GetChirp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetChirpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChirpsServiceServer).GetChirp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChirpsService_GetChirp_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChirpsServiceServer).GetChirp(ctx, req.(*GetChirpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChirpsService_CreateChirp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateChirpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChirpsServiceServer).CreateChirp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChirpsService_CreateChirp_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChirpsServiceServer).CreateChirp(ctx, req.(*CreateChirpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChirpsService_DeleteChirp_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteChirpRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(ChirpsServiceServer).DeleteChirp(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: ChirpsService_DeleteChirp_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(ChirpsServiceServer).DeleteChirp(ctx, req.(*DeleteChirpRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _ChirpsService_WatchChirps_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchChirpsRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(ChirpsServiceServer).WatchChirps(m, &grpc.GenericServerStream[WatchChirpsRequest, WatchChirpsResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type ChirpsService_WatchChirpsServer = grpc.ServerStreamingServer[WatchChirpsResponse]
+
+// ChirpsService_ServiceDesc is the grpc.ServiceDesc for ChirpsService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var ChirpsService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "chirpy.v1.ChirpsService",
+	HandlerType: (*ChirpsServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "ListChirps",
+			Handler:    _ChirpsService_ListChirps_Handler,
+		},
+		{
+			MethodName: "GetChirp",
+			Handler:    _ChirpsService_GetChirp_Handler,
+		},
+		{
+			MethodName: "CreateChirp",
+			Handler:    _ChirpsService_CreateChirp_Handler,
+		},
+		{
+			MethodName: "DeleteChirp",
+			Handler:    _ChirpsService_DeleteChirp_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchChirps",
+			Handler:       _ChirpsService_WatchChirps_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "chirpy/v1/chirps.proto",
+}
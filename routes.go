@@ -0,0 +1,146 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/k3vwdd/chirpyWS/internal/config"
+	"github.com/k3vwdd/chirpyWS/internal/handlers"
+	"github.com/k3vwdd/chirpyWS/internal/middleWare"
+	"github.com/k3vwdd/chirpyWS/internal/types"
+)
+
+// route is one pattern registered on the server's ServeMux.
+type route struct {
+	pattern string
+	handler http.Handler
+}
+
+// routes lists every endpoint Chirpy serves, so the server and the tests
+// register exactly the same set.
+func routes(apiCfg *types.ApiConfig, filepathRoot string) []route {
+	cfg := &handlers.ApiConfig{
+		ApiConfig: apiCfg,
+	}
+
+	mw := &middleWare.ApiConfig{
+		ApiConfig: apiCfg,
+	}
+
+	all := []route{
+		{"/", http.FileServer(http.Dir(filepathRoot))},
+		// strips "/" off of /app/
+		{"/app/", http.StripPrefix("/app/", mw.MiddlewareMetricsInc(http.FileServer(http.Dir(filepathRoot))))},
+		{"GET /api/healthz", http.HandlerFunc(cfg.HandleHealthReadiness)},
+		{"GET /api/livez", http.HandlerFunc(cfg.HandleLiveness)},
+		{"GET /api/readyz", http.HandlerFunc(cfg.HandleReadiness)},
+		{"GET /api/openapi.json", http.HandlerFunc(cfg.HandleOpenAPI)},
+		{"GET /api/docs", http.HandlerFunc(cfg.HandleSwaggerUI)},
+		{"POST /api/graphql", http.HandlerFunc(cfg.HandleGraphQL)},
+		{"GET /admin/metrics", http.HandlerFunc(cfg.HandleWriteHits)},
+		{"GET /metrics", apiCfg.Metrics.Handler()},
+		{"POST /admin/reset", http.HandlerFunc(cfg.HandleRegister)},
+		{"GET /admin/moderation/rules", http.HandlerFunc(cfg.HandleListModerationRules)},
+		{"POST /admin/moderation/rules", http.HandlerFunc(cfg.HandleCreateModerationRule)},
+		{"PUT /admin/moderation/rules/{ruleID}", http.HandlerFunc(cfg.HandleUpdateModerationRule)},
+		{"DELETE /admin/moderation/rules/{ruleID}", http.HandlerFunc(cfg.HandleDeleteModerationRule)},
+		{"GET /admin/moderation/chirps/{chirpID}/hits", http.HandlerFunc(cfg.HandleGetModerationHits)},
+		{"GET /admin/moderation/held", http.HandlerFunc(cfg.HandleListHeldChirps)},
+		{"POST /admin/moderation/chirps/{chirpID}/approve", http.HandlerFunc(cfg.HandleApproveChirp)},
+		{"POST /admin/moderation/chirps/{chirpID}/reject", http.HandlerFunc(cfg.HandleRejectChirp)},
+		{"GET /admin/moderation/audit", http.HandlerFunc(cfg.HandleListModerationAudit)},
+		{"GET /admin/reports", http.HandlerFunc(cfg.HandleListReports)},
+		{"POST /admin/reports/{reportID}/claim", http.HandlerFunc(cfg.HandleClaimReport)},
+		{"POST /admin/reports/{reportID}/resolve", http.HandlerFunc(cfg.HandleResolveReport)},
+		{"POST /admin/users/{userID}/suspend", http.HandlerFunc(cfg.HandleSuspendUser)},
+		{"POST /admin/users/{userID}/unsuspend", http.HandlerFunc(cfg.HandleUnsuspendUser)},
+		{"POST /admin/users/{userID}/shadow-ban", http.HandlerFunc(cfg.HandleShadowBanUser)},
+	}
+
+	// The public API, relative to each version's prefix.
+	versioned := []route{
+		{"GET /chirps", http.HandlerFunc(cfg.HandleGetChirps)},
+		{"GET /chirps/{chirpID}", http.HandlerFunc(cfg.HandleGetSingleChirp)},
+		{"DELETE /chirps/{chirpID}", http.HandlerFunc(cfg.HandleDeleteChirp)},
+		{"POST /users", http.HandlerFunc(cfg.HandleCreateUser)},
+		{"POST /chirps", http.HandlerFunc(cfg.HandleCreateChirp)},
+		{"POST /login", http.HandlerFunc(cfg.HandleLogin)},
+		{"POST /refresh", http.HandlerFunc(cfg.HandleRefresh)},
+		{"POST /revoke", http.HandlerFunc(cfg.HandleRevokeToken)},
+		{"POST /polka/webhooks", http.HandlerFunc(cfg.HandleWebHook)},
+		{"PUT /users", http.HandlerFunc(cfg.HandleUpdateUser)},
+		{"GET /users/me/warnings", http.HandlerFunc(cfg.HandleListWarnings)},
+		{"POST /chirps/{chirpID}/report", http.HandlerFunc(cfg.HandleReportChirp)},
+	}
+	for _, v := range handlers.APIPrefixes {
+		for _, r := range versioned {
+			method, path, _ := strings.Cut(r.pattern, " ")
+			all = append(all, route{method + " " + v.Prefix + path, handlers.Versioned(v.Version, v.Prefix, r.handler)})
+		}
+	}
+	return all
+}
+
+// rateLimitRules limit the routes that create accounts, sessions and
+// content. GraphQL mutations and RPCs that do the same count against them.
+var rateLimitRules = map[string]middleWare.RateLimitRule{
+	"POST /api/chirps":                  {Limit: 10, RedLimit: 30, Window: time.Minute},
+	"POST /api/users":                   {Limit: 5, Window: time.Hour},
+	"POST /api/login":                   {Limit: 10, Window: time.Minute},
+	"POST /api/chirps/{chirpID}/report": {Limit: 20, RedLimit: 40, Window: time.Hour},
+}
+
+// idempotentRoutes honour the Idempotency-Key header, so clients can retry
+// them without creating a second chirp, user or payment.
+var idempotentRoutes = map[string]bool{
+	"POST /api/chirps":         true,
+	"POST /api/users":          true,
+	"POST /api/polka/webhooks": true,
+}
+
+// corsExposedHeaders are the response headers the API documents, which
+// scripts on other origins may read.
+var corsExposedHeaders = []string{
+	"ETag", "Link", "Deprecation", "Sunset", "Retry-After", "X-Request-ID", "Idempotent-Replayed",
+	"RateLimit-Policy", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+}
+
+// corsPolicy lets the origins c allows call the API and read the headers
+// it documents.
+func corsPolicy(c config.CORS) middleWare.CORSPolicy {
+	return middleWare.CORSPolicy{
+		AllowedOrigins:   c.AllowedOrigins,
+		AllowedMethods:   c.AllowedMethods,
+		AllowedHeaders:   c.AllowedHeaders,
+		ExposedHeaders:   corsExposedHeaders,
+		AllowCredentials: c.AllowCredentials,
+		MaxAge:           c.MaxAge,
+	}
+}
+
+// canonicalPattern maps a versioned pattern to its plain /api one, so every
+// version of a route shares its rate limit.
+func canonicalPattern(pattern string) string {
+	method, path, found := strings.Cut(pattern, " ")
+	if !found {
+		return pattern
+	}
+	for _, v := range handlers.APIPrefixes {
+		if v.Prefix == handlers.UnversionedPrefix {
+			continue
+		}
+		if rest, ok := strings.CutPrefix(path, v.Prefix+"/"); ok {
+			return method + " " + handlers.UnversionedPrefix + "/" + rest
+		}
+	}
+	return pattern
+}
+
+func newMux(routes []route) *http.ServeMux {
+	mux := http.NewServeMux()
+	for _, r := range routes {
+		mux.Handle(r.pattern, r.handler)
+	}
+	return mux
+}
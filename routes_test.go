@@ -0,0 +1,1049 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/client"
+	"github.com/k3vwdd/chirpyWS/internal/auth"
+	"github.com/k3vwdd/chirpyWS/internal/config"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/handlers"
+	"github.com/k3vwdd/chirpyWS/internal/health"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/memstore"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/middleWare"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
+	"github.com/k3vwdd/chirpyWS/internal/openapi"
+	"github.com/k3vwdd/chirpyWS/internal/service"
+	"github.com/k3vwdd/chirpyWS/internal/testenv"
+	"github.com/k3vwdd/chirpyWS/internal/types"
+	"github.com/k3vwdd/chirpyWS/internal/utils"
+	"github.com/vmihailenco/msgpack/v5"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// apiTest drives the real route table against an in-memory store and
+// remembers which patterns were hit.
+type apiTest struct {
+	t       *testing.T
+	store   *memstore.Store
+	cfg     *types.ApiConfig
+	handler http.Handler
+	mux     *http.ServeMux
+	routes  []route
+	hit     map[string]bool
+	// prefix, if set, replaces /api in the paths of versioned routes.
+	prefix string
+}
+
+func newAPITest(t *testing.T) *apiTest {
+	t.Helper()
+	env := testenv.New(t)
+	api := &apiTest{t: t, store: env.Store, cfg: env.Config, routes: routes(env.Config, "."), hit: map[string]bool{}}
+	api.mux = newMux(api.routes)
+	api.handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		api.mux.ServeHTTP(w, r)
+		api.hit[r.Pattern] = true
+	})
+	return api
+}
+
+type response struct {
+	*httptest.ResponseRecorder
+}
+
+func (r response) decode(t *testing.T, v any) {
+	t.Helper()
+	if err := json.Unmarshal(r.Body.Bytes(), v); err != nil {
+		t.Fatalf("decoding %q: %v", r.Body.String(), err)
+	}
+}
+
+// do sends a request. body is JSON encoded unless it is nil or []byte; token is sent
+// as a bearer token unless it starts with "ApiKey ".
+func (api *apiTest) do(method, path, token string, body any) response {
+	api.t.Helper()
+	return api.doWithHeaders(method, path, token, body, nil)
+}
+
+// doWithHeaders is do with extra request headers.
+func (api *apiTest) doWithHeaders(method, path, token string, body any, header http.Header) response {
+	api.t.Helper()
+	var reader *bytes.Reader
+	if raw, ok := body.([]byte); ok {
+		reader = bytes.NewReader(raw)
+	} else if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			api.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, api.versioned(method, path), reader)
+	if strings.HasPrefix(token, "ApiKey ") {
+		req.Header.Set("Authorization", token)
+	} else if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+
+	rec := httptest.NewRecorder()
+	api.handler.ServeHTTP(rec, req)
+	return response{rec}
+}
+
+// versioned moves path under api.prefix if it is a versioned route.
+func (api *apiTest) versioned(method, path string) string {
+	rest, ok := strings.CutPrefix(path, handlers.UnversionedPrefix+"/")
+	if api.prefix == "" || !ok {
+		return path
+	}
+	candidate := api.prefix + "/" + rest
+	_, pattern := api.mux.Handler(httptest.NewRequest(method, candidate, nil))
+	if strings.HasPrefix(pattern, method+" "+api.prefix+"/") {
+		return candidate
+	}
+	return path
+}
+
+func (api *apiTest) expect(method, path, token string, body any, status int) response {
+	api.t.Helper()
+	resp := api.do(method, path, token, body)
+	if resp.Code != status {
+		api.t.Fatalf("%s %s = %d, want %d: %s", method, path, resp.Code, status, resp.Body.String())
+	}
+	return resp
+}
+
+type session struct {
+	ID           uuid.UUID `json:"id"`
+	Email        string    `json:"email"`
+	Token        string    `json:"token"`
+	RefreshToken string    `json:"refresh_token"`
+	IsChirpyRed  bool      `json:"is_chirpy_red"`
+}
+
+func (api *apiTest) signUp(email, role string) session {
+	api.t.Helper()
+	credentials := map[string]string{"email": email, "password": "hunter2"}
+	var user session
+	api.expect("POST", "/api/users", "", credentials, http.StatusCreated).decode(api.t, &user)
+	if role != auth.RoleUser {
+		err := api.store.SetUserRole(context.Background(), database.SetUserRoleParams{ID: user.ID, Role: role})
+		if err != nil {
+			api.t.Fatal(err)
+		}
+	}
+	var s session
+	api.expect("POST", "/api/login", "", credentials, http.StatusOK).decode(api.t, &s)
+	return s
+}
+
+type chirp struct {
+	ID     uuid.UUID `json:"id"`
+	Body   string    `json:"body"`
+	UserID uuid.UUID `json:"user_id"`
+}
+
+// TestEveryRoute runs the same scenario under each API prefix; between
+// them the runs must hit every route.
+func TestEveryRoute(t *testing.T) {
+	hit := map[string]bool{}
+	var registered []route
+	for _, v := range handlers.APIPrefixes {
+		t.Run(v.Prefix, func(t *testing.T) {
+			api := newAPITest(t)
+			api.prefix = v.Prefix
+			exerciseEveryRoute(t, api)
+			maps.Copy(hit, api.hit)
+			registered = api.routes
+		})
+	}
+
+	for _, r := range registered {
+		if !hit[r.pattern] {
+			t.Errorf("route %q is not exercised", r.pattern)
+		}
+	}
+}
+
+func exerciseEveryRoute(t *testing.T, api *apiTest) {
+	api.expect("GET", "/api/healthz", "", nil, http.StatusOK)
+	api.expect("GET", "/api/livez", "", nil, http.StatusOK)
+	api.expect("GET", "/api/readyz", "", nil, http.StatusOK)
+	api.expect("GET", "/", "", nil, http.StatusOK)
+	api.expect("GET", "/app/", "", nil, http.StatusOK)
+	api.expect("GET", "/api/openapi.json", "", nil, http.StatusOK)
+	api.expect("GET", "/api/docs", "", nil, http.StatusOK)
+
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	bob := api.signUp("bob@example.com", auth.RoleUser)
+	admin := api.signUp("admin@example.com", auth.RoleAdmin)
+
+	api.expect("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": "wrong"}, http.StatusUnauthorized)
+
+	// Chirps and moderation masking.
+	var posted chirp
+	api.expect("POST", "/api/chirps", alice.Token, map[string]string{"body": "what a Kerfuffle"}, http.StatusCreated).decode(t, &posted)
+	if posted.Body != "what a ****" {
+		t.Errorf("posted body = %q, want the rule masked", posted.Body)
+	}
+	api.expect("POST", "/api/chirps", "", map[string]string{"body": "no token"}, http.StatusUnauthorized)
+	api.expect("POST", "/api/chirps", bob.Token, map[string]string{"body": strings.Repeat("a", 141)}, http.StatusBadRequest)
+
+	var chirps []chirp
+	api.expect("GET", "/api/chirps", "", nil, http.StatusOK).decode(t, &chirps)
+	if len(chirps) != 1 || chirps[0].ID != posted.ID {
+		t.Errorf("GET /api/chirps = %+v, want the posted chirp", chirps)
+	}
+	api.expect("GET", "/api/chirps?author_id="+bob.ID.String(), "", nil, http.StatusOK).decode(t, &chirps)
+	if len(chirps) != 0 {
+		t.Errorf("bob has %d chirps, want 0", len(chirps))
+	}
+	api.expect("GET", "/api/chirps/"+posted.ID.String(), "", nil, http.StatusOK)
+	var graph struct {
+		Data struct {
+			Chirp struct{ Author struct{ ID uuid.UUID } }
+		}
+	}
+	api.expect("POST", "/api/graphql", "", graphQL(`query($id: ID!) { chirp(id: $id) { author { id } } }`, "id", posted.ID), http.StatusOK).decode(t, &graph)
+	if graph.Data.Chirp.Author.ID != alice.ID {
+		t.Errorf("GraphQL chirp author = %v, want alice", graph.Data.Chirp.Author.ID)
+	}
+
+	var hits []map[string]any
+	api.expect("GET", "/admin/moderation/chirps/"+posted.ID.String()+"/hits", admin.Token, nil, http.StatusOK).decode(t, &hits)
+	if len(hits) != 1 {
+		t.Errorf("got %d moderation hits, want 1", len(hits))
+	}
+	api.expect("GET", "/admin/moderation/chirps/"+posted.ID.String()+"/hits", alice.Token, nil, http.StatusForbidden)
+
+	// Moderation rules.
+	var rules []map[string]any
+	api.expect("GET", "/admin/moderation/rules", admin.Token, nil, http.StatusOK).decode(t, &rules)
+	if len(rules) != 3 {
+		t.Errorf("got %d rules, want the 3 seeded", len(rules))
+	}
+	var rule struct {
+		ID uuid.UUID `json:"id"`
+	}
+	api.expect("POST", "/admin/moderation/rules", admin.Token, map[string]string{"pattern": "spoiler", "action": "reject"}, http.StatusCreated).decode(t, &rule)
+	api.expect("POST", "/api/chirps", bob.Token, map[string]string{"body": "big SPOILER ahead"}, http.StatusBadRequest)
+	api.expect("PUT", "/admin/moderation/rules/"+rule.ID.String(), admin.Token, map[string]string{"pattern": "spoiler", "action": "hold"}, http.StatusOK)
+	var held chirp
+	api.expect("POST", "/api/chirps", bob.Token, map[string]string{"body": "big spoiler ahead"}, http.StatusAccepted).decode(t, &held)
+	api.expect("DELETE", "/admin/moderation/rules/"+rule.ID.String(), admin.Token, nil, http.StatusNoContent)
+
+	// Held chirps wait for review.
+	var queued []chirp
+	api.expect("GET", "/admin/moderation/held", admin.Token, nil, http.StatusOK).decode(t, &queued)
+	if len(queued) != 1 || queued[0].ID != held.ID {
+		t.Errorf("held queue = %+v, want bob's chirp", queued)
+	}
+	api.expect("POST", "/admin/moderation/chirps/"+held.ID.String()+"/reject", bob.Token, nil, http.StatusForbidden)
+	api.expect("POST", "/admin/moderation/chirps/"+held.ID.String()+"/reject", admin.Token, nil, http.StatusOK)
+	api.expect("POST", "/admin/moderation/chirps/"+held.ID.String()+"/approve", admin.Token, nil, http.StatusConflict)
+
+	// Reports, the queue and the audit log.
+	var report struct {
+		ID uuid.UUID `json:"id"`
+	}
+	api.expect("POST", "/api/chirps/"+posted.ID.String()+"/report", bob.Token, map[string]string{"reason": "spam"}, http.StatusCreated).decode(t, &report)
+	api.expect("POST", "/api/chirps/"+posted.ID.String()+"/report", bob.Token, map[string]string{"reason": "spam"}, http.StatusConflict)
+	var queue []map[string]any
+	api.expect("GET", "/admin/reports?status=open", admin.Token, nil, http.StatusOK).decode(t, &queue)
+	if len(queue) != 1 {
+		t.Errorf("queue has %d reports, want 1", len(queue))
+	}
+	api.expect("POST", "/admin/reports/"+report.ID.String()+"/claim", admin.Token, nil, http.StatusOK)
+	api.expect("POST", "/admin/reports/"+report.ID.String()+"/resolve", admin.Token, map[string]string{"action": "dismiss"}, http.StatusOK)
+	api.expect("POST", "/admin/reports/"+report.ID.String()+"/resolve", admin.Token, map[string]string{"action": "dismiss"}, http.StatusConflict)
+	var warnings []map[string]any
+	api.expect("GET", "/api/users/me/warnings", alice.Token, nil, http.StatusOK).decode(t, &warnings)
+	if len(warnings) != 0 {
+		t.Errorf("dismissing a report left %d warnings", len(warnings))
+	}
+	var audit []map[string]any
+	api.expect("GET", "/admin/moderation/audit", admin.Token, nil, http.StatusOK).decode(t, &audit)
+	if len(audit) == 0 {
+		t.Error("resolving a report left no audit entry")
+	}
+
+	// Suspension and shadow bans.
+	api.expect("POST", "/admin/users/"+bob.ID.String()+"/suspend", admin.Token, map[string]int{"hours": 1}, http.StatusOK)
+	api.expect("POST", "/api/login", "", map[string]string{"email": bob.Email, "password": "hunter2"}, http.StatusForbidden)
+	api.expect("POST", "/admin/users/"+bob.ID.String()+"/unsuspend", admin.Token, nil, http.StatusOK)
+	api.expect("POST", "/admin/users/"+alice.ID.String()+"/shadow-ban", admin.Token, map[string]bool{"shadow_banned": true}, http.StatusOK)
+	api.expect("GET", "/api/chirps", bob.Token, nil, http.StatusOK).decode(t, &chirps)
+	if len(chirps) != 0 {
+		t.Errorf("bob sees %d chirps from a shadow-banned user", len(chirps))
+	}
+	api.expect("GET", "/api/chirps", alice.Token, nil, http.StatusOK).decode(t, &chirps)
+	if len(chirps) != 1 {
+		t.Errorf("alice sees %d of her own chirps, want 1", len(chirps))
+	}
+
+	// Account changes and tokens.
+	api.expect("PUT", "/api/users", alice.Token, map[string]string{"email": "alice2@example.com", "password": "hunter3"}, http.StatusOK)
+	var refreshed struct {
+		Token string `json:"token"`
+	}
+	api.expect("POST", "/api/refresh", alice.RefreshToken, nil, http.StatusOK).decode(t, &refreshed)
+	if refreshed.Token == "" {
+		t.Error("refresh returned no token")
+	}
+	api.expect("POST", "/api/revoke", alice.RefreshToken, nil, http.StatusNoContent)
+	api.expect("POST", "/api/refresh", alice.RefreshToken, nil, http.StatusUnauthorized)
+
+	// Polka webhooks.
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": bob.ID.String()}}
+	api.expect("POST", "/api/polka/webhooks", "ApiKey wrong", upgrade, http.StatusUnauthorized)
+	api.expect("POST", "/api/polka/webhooks", "ApiKey "+testenv.PolkaKey, upgrade, http.StatusNoContent)
+	user, err := api.store.GetUserByID(context.Background(), bob.ID)
+	if err != nil || !user.IsChirpyRed {
+		t.Errorf("bob wasn't upgraded: %+v, %v", user, err)
+	}
+
+	api.expect("DELETE", "/api/chirps/"+posted.ID.String(), bob.Token, nil, http.StatusForbidden)
+	api.expect("DELETE", "/api/chirps/"+posted.ID.String(), alice.Token, nil, http.StatusNoContent)
+	api.expect("GET", "/api/chirps/"+posted.ID.String(), "", nil, http.StatusNotFound)
+
+	// Metrics.
+	admin_page := api.expect("GET", "/admin/metrics", "", nil, http.StatusOK)
+	if !strings.Contains(admin_page.Body.String(), "chirpy_chirps_created_total") {
+		t.Error("admin page doesn't list the chirps counter")
+	}
+	api.expect("GET", "/metrics", "", nil, http.StatusOK)
+
+	// Reset cascades to everything the users owned.
+	api.expect("POST", "/admin/reset", "", nil, http.StatusOK)
+	api.expect("GET", "/api/chirps", "", nil, http.StatusOK).decode(t, &chirps)
+	if len(chirps) != 0 {
+		t.Errorf("%d chirps survived the reset", len(chirps))
+	}
+}
+
+func TestHeldChirpReview(t *testing.T) {
+	api := newAPITest(t)
+	sub := api.cfg.ChirpFeed.Subscribe(4)
+	defer sub.Close()
+
+	ctx := context.Background()
+	_, err := api.store.CreateModerationRule(ctx, database.CreateModerationRuleParams{
+		ID: uuid.New(), Kind: moderation.KindWord, Pattern: "spoiler", Action: moderation.ActionHold, Enabled: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := api.cfg.Moderation.Reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	mod := api.signUp("mod@example.com", auth.RoleModerator)
+	var first, second chirp
+	api.expect("POST", "/api/chirps", alice.Token, map[string]string{"body": "spoiler one"}, http.StatusAccepted).decode(t, &first)
+	api.expect("POST", "/api/chirps", alice.Token, map[string]string{"body": "spoiler two"}, http.StatusAccepted).decode(t, &second)
+
+	var queued []chirp
+	api.expect("GET", "/admin/moderation/held", mod.Token, nil, http.StatusOK).decode(t, &queued)
+	if len(queued) != 2 || queued[0].ID != first.ID || queued[1].ID != second.ID {
+		t.Fatalf("held queue = %+v, want both chirps oldest first", queued)
+	}
+	api.expect("GET", "/admin/moderation/held", alice.Token, nil, http.StatusForbidden)
+
+	// Approving publishes the chirp and sends it to watchers.
+	var approved struct {
+		chirp
+		Status string `json:"status"`
+	}
+	api.expect("POST", "/admin/moderation/chirps/"+first.ID.String()+"/approve", mod.Token, nil, http.StatusOK).decode(t, &approved)
+	if approved.ID != first.ID || approved.Status != service.ChirpPublished {
+		t.Errorf("approve returned %+v", approved)
+	}
+	select {
+	case e := <-sub.C():
+		if e.Chirp.ID != first.ID || e.Author.ID != alice.ID {
+			t.Errorf("feed got %+v, want the approved chirp", e)
+		}
+	default:
+		t.Error("approving didn't publish the chirp to the feed")
+	}
+	api.expect("GET", "/api/chirps/"+first.ID.String(), "", nil, http.StatusOK)
+
+	// Rejecting removes it without publishing.
+	api.expect("POST", "/admin/moderation/chirps/"+second.ID.String()+"/reject", mod.Token, nil, http.StatusOK)
+	api.expect("GET", "/api/chirps/"+second.ID.String(), "", nil, http.StatusNotFound)
+	select {
+	case e := <-sub.C():
+		t.Errorf("rejecting published %+v", e)
+	default:
+	}
+
+	// Reviewed chirps leave the queue and can't be reviewed again.
+	api.expect("GET", "/admin/moderation/held", mod.Token, nil, http.StatusOK).decode(t, &queued)
+	if len(queued) != 0 {
+		t.Errorf("held queue = %+v after review, want it empty", queued)
+	}
+	api.expect("POST", "/admin/moderation/chirps/"+first.ID.String()+"/reject", mod.Token, nil, http.StatusConflict)
+	api.expect("POST", "/admin/moderation/chirps/"+uuid.NewString()+"/approve", mod.Token, nil, http.StatusNotFound)
+	api.expect("POST", "/admin/moderation/chirps/not-a-uuid/approve", mod.Token, nil, http.StatusBadRequest)
+
+	entries, err := api.store.ListModerationAuditEntries(ctx, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	actions := map[string]uuid.UUID{}
+	for _, e := range entries {
+		if e.ModeratorID != mod.ID || e.TargetUserID.UUID != alice.ID {
+			t.Errorf("audit entry %+v, want mod acting on alice", e)
+		}
+		actions[e.Action] = e.ChirpID.UUID
+	}
+	if len(entries) != 2 || actions["approve_chirp"] != first.ID || actions["reject_chirp"] != second.ID {
+		t.Errorf("audit log = %+v, want one approval and one rejection", entries)
+	}
+}
+
+func TestResolveReport(t *testing.T) {
+	api := newAPITest(t)
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	bob := api.signUp("bob@example.com", auth.RoleUser)
+	carol := api.signUp("carol@example.com", auth.RoleUser)
+	mod := api.signUp("mod@example.com", auth.RoleModerator)
+	other := api.signUp("other@example.com", auth.RoleModerator)
+
+	var posted chirp
+	api.expect("POST", "/api/chirps", alice.Token, map[string]string{"body": "buy my stuff"}, http.StatusCreated).decode(t, &posted)
+	var first, second reportResponse
+	api.expect("POST", "/api/chirps/"+posted.ID.String()+"/report", bob.Token, map[string]string{"reason": "spam"}, http.StatusCreated).decode(t, &first)
+	api.expect("POST", "/api/chirps/"+posted.ID.String()+"/report", carol.Token, map[string]string{"reason": "spam"}, http.StatusCreated).decode(t, &second)
+	api.expect("POST", "/admin/reports/"+second.ID.String()+"/claim", other.Token, nil, http.StatusOK)
+
+	// Another moderator's claim blocks resolving that report directly.
+	api.expect("POST", "/admin/reports/"+second.ID.String()+"/resolve", mod.Token, map[string]string{"action": "dismiss"}, http.StatusConflict)
+
+	warn := map[string]string{"action": "warn_user", "note": "no ads please"}
+	api.expect("POST", "/admin/reports/"+first.ID.String()+"/resolve", mod.Token, warn, http.StatusOK)
+	api.expect("POST", "/admin/reports/"+first.ID.String()+"/resolve", mod.Token, warn, http.StatusConflict)
+
+	// Resolving the chirp's reports leaves the one other claimed alone.
+	report, err := api.store.GetReportByID(context.Background(), second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Status != "claimed" || report.ClaimedBy.UUID != other.ID {
+		t.Errorf("claimed report = %+v, want it still claimed by the other moderator", report)
+	}
+
+	// The warning is recorded once and the author can read it.
+	var warnings []warning
+	api.expect("GET", "/api/users/me/warnings", alice.Token, nil, http.StatusOK).decode(t, &warnings)
+	if len(warnings) != 1 || warnings[0].ChirpID == nil || *warnings[0].ChirpID != posted.ID || warnings[0].Reason != "spam" || warnings[0].Note != "no ads please" {
+		t.Errorf("alice's warnings = %+v, want one about her chirp", warnings)
+	}
+	api.expect("GET", "/api/users/me/warnings", bob.Token, nil, http.StatusOK).decode(t, &warnings)
+	if len(warnings) != 0 {
+		t.Errorf("bob has %d warnings, want 0", len(warnings))
+	}
+	api.expect("GET", "/api/users/me/warnings", "", nil, http.StatusUnauthorized)
+}
+
+type reportResponse struct {
+	ID uuid.UUID `json:"id"`
+}
+
+type warning struct {
+	ChirpID *uuid.UUID `json:"chirp_id"`
+	Reason  string     `json:"reason"`
+	Note    string     `json:"note"`
+}
+
+// graphQL builds a GraphQL request body from a query and pairs of
+// variable names and values.
+func graphQL(query string, variables ...any) map[string]any {
+	vars := map[string]any{}
+	for i := 0; i+1 < len(variables); i += 2 {
+		vars[variables[i].(string)] = variables[i+1]
+	}
+	return map[string]any{"query": query, "variables": vars}
+}
+
+type graphQLResult struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message    string         `json:"message"`
+		Extensions map[string]any `json:"extensions"`
+	} `json:"errors"`
+}
+
+// countingStore counts the batched user lookups GraphQL makes.
+type countingStore struct {
+	*memstore.Store
+	userBatches int
+}
+
+func (s *countingStore) GetUsersByIDs(ctx context.Context, ids []uuid.UUID) ([]database.User, error) {
+	s.userBatches++
+	return s.Store.GetUsersByIDs(ctx, ids)
+}
+
+func TestGraphQL(t *testing.T) {
+	api := newAPITest(t)
+	store := &countingStore{Store: api.store}
+	api.cfg.Db = store
+
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	bob := api.signUp("bob@example.com", auth.RoleUser)
+	query := func(token string, body map[string]any) graphQLResult {
+		t.Helper()
+		var result graphQLResult
+		api.expect("POST", "/api/graphql", token, body, http.StatusOK).decode(t, &result)
+		return result
+	}
+
+	// Mutations enforce the REST rules: a token is required and the body is validated.
+	const post = `mutation($body: String!) { createChirp(body: $body) { held chirp { id body } } }`
+	result := query("", graphQL(post, "body", "hello"))
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != utils.CodeUnauthorized {
+		t.Errorf("anonymous createChirp = %+v", result.Errors)
+	}
+	result = query(alice.Token, graphQL(post, "body", strings.Repeat("a", 141)))
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != utils.CodeValidationFailed || result.Errors[0].Extensions["errors"] == nil {
+		t.Errorf("createChirp with a long body = %+v", result.Errors)
+	}
+	for _, s := range []session{alice, bob, alice} {
+		if result := query(s.Token, graphQL(post, "body", "hi from "+s.Email)); len(result.Errors) != 0 {
+			t.Fatalf("createChirp = %+v", result.Errors)
+		}
+	}
+
+	// Every author in the list comes from one batched lookup, and email
+	// addresses are only shown to their owner.
+	store.userBatches = 0
+	result = query(alice.Token, graphQL(`{ chirps(sort: DESC) { body author { id email } } }`))
+	var list struct {
+		Chirps []struct {
+			Body   string
+			Author struct {
+				ID    uuid.UUID
+				Email *string
+			}
+		}
+	}
+	if err := json.Unmarshal(result.Data, &list); err != nil || len(result.Errors) != 0 {
+		t.Fatalf("chirps = %s, %+v, %v", result.Data, result.Errors, err)
+	}
+	if len(list.Chirps) != 3 || list.Chirps[1].Author.ID != bob.ID {
+		t.Fatalf("chirps = %+v", list.Chirps)
+	}
+	for _, c := range list.Chirps {
+		if own := c.Author.ID == alice.ID; own != (c.Author.Email != nil) {
+			t.Errorf("alice sees %v as the email of %v", c.Author.Email, c.Author.ID)
+		}
+	}
+	if store.userBatches != 1 {
+		t.Errorf("loading 3 authors took %d batches, want 1", store.userBatches)
+	}
+
+	result = query(bob.Token, graphQL(`query($id: ID!) { user(id: $id) { chirps { body } } me { email } }`, "id", alice.ID))
+	if len(result.Errors) != 0 || !strings.Contains(string(result.Data), "hi from alice") || !strings.Contains(string(result.Data), bob.Email) {
+		t.Errorf("user and me = %s, %+v", result.Data, result.Errors)
+	}
+
+	// Nested lists multiply the cost until the query is refused unrun.
+	result = query("", graphQL(`{ chirps { author { chirps { author { chirps { id } } } } } }`))
+	if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != utils.CodeQueryTooComplex || string(result.Data) != "null" && result.Data != nil {
+		t.Errorf("deeply nested query = %s, %+v", result.Data, result.Errors)
+	}
+
+	result = query("", graphQL(`{ nope }`))
+	if len(result.Errors) == 0 {
+		t.Error("an unknown field wasn't rejected")
+	}
+}
+
+func TestGraphQLRateLimits(t *testing.T) {
+	api := newAPITest(t)
+	api.cfg.RateLimiter = &middleWare.RateLimiter{
+		Store:  middleWare.NewMemoryRateLimitStore(),
+		Rules:  rateLimitRules,
+		JWTKEY: testenv.JWTKey,
+	}
+	api.signUp("alice@example.com", auth.RoleUser)
+
+	// Logins share the REST route's budget of 10 a minute, so guessing
+	// passwords over GraphQL is no faster.
+	const login = `mutation($email: String!, $password: String!) { login(email: $email, password: $password) { token } }`
+	for i := range 11 {
+		var result graphQLResult
+		api.expect("POST", "/api/graphql", "", graphQL(login, "email", "alice@example.com", "password", "guess"), http.StatusOK).decode(t, &result)
+		want := utils.CodeInvalidCredentials
+		if i == 10 {
+			want = utils.CodeRateLimited
+		}
+		if len(result.Errors) != 1 || result.Errors[0].Extensions["code"] != want {
+			t.Errorf("login %d = %+v, want %s", i+1, result.Errors, want)
+		}
+	}
+}
+
+// TestOpenAPICoversRoutes keeps the published spec in step with routes():
+// every registered route must be documented, and nothing else.
+func TestOpenAPICoversRoutes(t *testing.T) {
+	api := newAPITest(t)
+
+	var spec openapi.Document
+	api.expect("GET", "/api/openapi.json", "", nil, http.StatusOK).decode(t, &spec)
+	if spec.OpenAPI != openapi.Version {
+		t.Errorf("openapi = %q, want %q", spec.OpenAPI, openapi.Version)
+	}
+
+	registered := map[string]bool{}
+	for _, r := range api.routes {
+		method, path, found := strings.Cut(r.pattern, " ")
+		if !found {
+			// A pattern without a method serves GET (and everything else).
+			method, path = "GET", r.pattern
+		}
+		method = strings.ToLower(method)
+		registered[method+" "+path] = true
+		if spec.Paths[path][method] == nil {
+			t.Errorf("route %q is missing from the OpenAPI spec", r.pattern)
+		}
+	}
+
+	for path, item := range spec.Paths {
+		for method, op := range item {
+			if !registered[method+" "+path] {
+				t.Errorf("spec documents %s %s, which isn't a route", strings.ToUpper(method), path)
+			}
+			if op.Responses["default"].Content["application/problem+json"].Schema == nil {
+				t.Errorf("%s %s doesn't document its errors", strings.ToUpper(method), path)
+			}
+		}
+	}
+}
+
+func TestAPIVersions(t *testing.T) {
+	api := newAPITest(t)
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": alice.ID.String()}}
+	api.expect("POST", "/api/v2/polka/webhooks", "ApiKey "+testenv.PolkaKey, upgrade, http.StatusNoContent)
+	var created chirp
+	api.expect("POST", "/api/v2/chirps", alice.Token, map[string]string{"body": "hello"}, http.StatusCreated).decode(t, &created)
+
+	// v1 and the unversioned aliases keep today's shape and say so.
+	for _, prefix := range []string{"/api", "/api/v1"} {
+		resp := api.expect("GET", prefix+"/chirps/"+created.ID.String(), "", nil, http.StatusOK)
+		if strings.Contains(resp.Body.String(), "is_chirpy_red") {
+			t.Errorf("%s chirp = %s, want no is_chirpy_red", prefix, resp.Body)
+		}
+		if resp.Header().Get("Deprecation") == "" || resp.Header().Get("Sunset") == "" {
+			t.Errorf("%s response lacks Deprecation and Sunset: %v", prefix, resp.Header())
+		}
+		if link := resp.Header().Get("Link"); link != `</api/v2/chirps/`+created.ID.String()+`>; rel="successor-version"` {
+			t.Errorf("%s Link = %q", prefix, link)
+		}
+	}
+
+	// v2 sends every chirp's author status.
+	var chirps []struct {
+		ID          uuid.UUID `json:"id"`
+		IsChirpyRed *bool     `json:"is_chirpy_red"`
+	}
+	resp := api.expect("GET", "/api/v2/chirps", "", nil, http.StatusOK)
+	resp.decode(t, &chirps)
+	if len(chirps) != 1 || chirps[0].IsChirpyRed == nil || !*chirps[0].IsChirpyRed {
+		t.Errorf("v2 chirps = %s", resp.Body)
+	}
+	if resp.Header().Get("Deprecation") != "" {
+		t.Error("v2 is marked deprecated")
+	}
+	resp = api.expect("GET", "/api/v2/chirps/"+created.ID.String(), "", nil, http.StatusOK)
+	if !strings.Contains(resp.Body.String(), `"is_chirpy_red":true`) {
+		t.Errorf("v2 chirp = %s", resp.Body)
+	}
+
+	// Operational routes aren't versioned.
+	if resp := api.expect("GET", "/api/livez", "", nil, http.StatusOK); resp.Header().Get("Deprecation") != "" {
+		t.Error("livez is marked deprecated")
+	}
+
+	for pattern, want := range map[string]string{
+		"POST /api/v2/chirps":          "POST /api/chirps",
+		"POST /api/v1/chirps":          "POST /api/chirps",
+		"POST /api/chirps":             "POST /api/chirps",
+		"GET /api/v2/chirps/{chirpID}": "GET /api/chirps/{chirpID}",
+		"GET /admin/reports":           "GET /admin/reports",
+		"/app/":                        "/app/",
+	} {
+		if got := canonicalPattern(pattern); got != want {
+			t.Errorf("canonicalPattern(%q) = %q, want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	api := newAPITest(t)
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	var created chirp
+	api.expect("POST", "/api/chirps", alice.Token, map[string]string{"body": "hello"}, http.StatusCreated).decode(t, &created)
+	path := "/api/chirps/" + created.ID.String()
+	conditional := func(method, path, token, name, value string) response {
+		t.Helper()
+		return api.doWithHeaders(method, path, token, nil, http.Header{name: {value}})
+	}
+
+	resp := api.expect("GET", path, "", nil, http.StatusOK)
+	etag, lastModified := resp.Header().Get("ETag"), resp.Header().Get("Last-Modified")
+	if !strings.HasPrefix(etag, `"`) || lastModified == "" {
+		t.Fatalf("chirp validators = %q, %q; want a strong ETag and Last-Modified", etag, lastModified)
+	}
+	if cc := resp.Header().Get("Cache-Control"); cc != "private, no-cache" {
+		t.Errorf("Cache-Control = %q", cc)
+	}
+	if resp := conditional("GET", path, "", "If-None-Match", etag); resp.Code != http.StatusNotModified || resp.Body.Len() != 0 {
+		t.Errorf("GET with the current ETag = %d %q, want an empty 304", resp.Code, resp.Body)
+	}
+	if resp := conditional("GET", path, "", "If-Modified-Since", lastModified); resp.Code != http.StatusNotModified {
+		t.Errorf("GET If-Modified-Since Last-Modified = %d, want 304", resp.Code)
+	}
+	if resp := conditional("GET", path, "", "If-None-Match", `"stale"`); resp.Code != http.StatusOK {
+		t.Errorf("GET with a stale ETag = %d, want 200", resp.Code)
+	}
+
+	// Lists get weak ETags that change with their contents.
+	resp = api.expect("GET", "/api/chirps", "", nil, http.StatusOK)
+	listETag := resp.Header().Get("ETag")
+	if !strings.HasPrefix(listETag, `W/"`) || resp.Header().Get("Last-Modified") != "" {
+		t.Fatalf("list validators = %v", resp.Header())
+	}
+	if resp := conditional("GET", "/api/chirps", "", "If-None-Match", listETag); resp.Code != http.StatusNotModified {
+		t.Errorf("list with the current ETag = %d, want 304", resp.Code)
+	}
+	api.expect("POST", "/api/chirps", alice.Token, map[string]string{"body": "again"}, http.StatusCreated)
+	if resp := conditional("GET", "/api/chirps", "", "If-None-Match", listETag); resp.Code != http.StatusOK {
+		t.Errorf("list after a new chirp = %d, want 200", resp.Code)
+	}
+
+	// v2 also carries the author's status, so upgrading them is a change.
+	v2ETag := api.expect("GET", "/api/v2/chirps/"+created.ID.String(), "", nil, http.StatusOK).Header().Get("ETag")
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": alice.ID.String()}}
+	api.expect("POST", "/api/polka/webhooks", "ApiKey "+testenv.PolkaKey, upgrade, http.StatusNoContent)
+	if resp := conditional("GET", "/api/v2/chirps/"+created.ID.String(), "", "If-None-Match", v2ETag); resp.Code != http.StatusOK {
+		t.Errorf("v2 chirp after the author upgraded = %d, want 200", resp.Code)
+	}
+	if resp := conditional("GET", path, "", "If-None-Match", etag); resp.Code != http.StatusNotModified {
+		t.Errorf("v1 chirp after the author upgraded = %d, want 304", resp.Code)
+	}
+
+	// A chirp that changed since the client fetched it isn't deleted.
+	err := api.store.UpdateChirpStatus(context.Background(), database.UpdateChirpStatusParams{ID: created.ID, Status: service.ChirpPublished})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp = conditional("DELETE", path, alice.Token, "If-Match", etag)
+	var problem utils.Problem
+	resp.decode(t, &problem)
+	if resp.Code != http.StatusPreconditionFailed || problem.Code != utils.CodePreconditionFailed {
+		t.Errorf("DELETE with a stale If-Match = %d %s, want 412", resp.Code, resp.Body)
+	}
+	etag = api.expect("GET", path, "", nil, http.StatusOK).Header().Get("ETag")
+	if resp := conditional("DELETE", path, alice.Token, "If-Match", "W/"+etag); resp.Code != http.StatusPreconditionFailed {
+		t.Errorf("DELETE with a weak If-Match = %d, want 412", resp.Code)
+	}
+	if resp := conditional("DELETE", path, alice.Token, "If-Match", etag); resp.Code != http.StatusNoContent {
+		t.Errorf("DELETE with the current If-Match = %d %s, want 204", resp.Code, resp.Body)
+	}
+	api.expect("GET", path, "", nil, http.StatusNotFound)
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	api := newAPITest(t)
+	idempotency := &middleWare.Idempotency{
+		Store:     middleWare.NewMemoryIdempotencyStore(),
+		Routes:    idempotentRoutes,
+		TTL:       time.Hour,
+		JWTKEY:    testenv.JWTKey,
+		Canonical: canonicalPattern,
+	}
+	api.handler = idempotency.Middleware(api.mux, api.handler)
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	withKey := func(key string) http.Header { return http.Header{"Idempotency-Key": {key}} }
+
+	// A mobile client retrying after a timeout posts the chirp once.
+	var first, retried chirp
+	api.doWithHeaders("POST", "/api/chirps", alice.Token, map[string]string{"body": "hello"}, withKey("c1")).decode(t, &first)
+	resp := api.doWithHeaders("POST", "/api/chirps", alice.Token, map[string]string{"body": "hello"}, withKey("c1"))
+	resp.decode(t, &retried)
+	if resp.Code != http.StatusCreated || retried.ID != first.ID || resp.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retried chirp = %d %s, want a replay of %s", resp.Code, resp.Body, first.ID)
+	}
+	// The v2 alias is the same route, but not the same request.
+	if resp := api.doWithHeaders("POST", "/api/v2/chirps", alice.Token, map[string]string{"body": "hello"}, withKey("c1")); resp.Code != http.StatusUnprocessableEntity {
+		t.Errorf("key reused on v2 = %d, want 422", resp.Code)
+	}
+	resp = api.doWithHeaders("POST", "/api/chirps", alice.Token, map[string]string{"body": "goodbye"}, withKey("c1"))
+	var problem utils.Problem
+	resp.decode(t, &problem)
+	if resp.Code != http.StatusUnprocessableEntity || problem.Code != utils.CodeIdempotencyReused {
+		t.Errorf("key reused with another body = %d %s, want 422", resp.Code, resp.Body)
+	}
+	var chirps []chirp
+	api.expect("GET", "/api/chirps?author_id="+alice.ID.String(), "", nil, http.StatusOK).decode(t, &chirps)
+	if len(chirps) != 1 {
+		t.Errorf("alice has %d chirps, want 1", len(chirps))
+	}
+
+	// A retried sign-up gets its 201 back rather than email_taken.
+	credentials := map[string]string{"email": "bob@example.com", "password": "hunter2"}
+	for range 2 {
+		if resp := api.doWithHeaders("POST", "/api/users", "", credentials, withKey("u1")); resp.Code != http.StatusCreated {
+			t.Errorf("sign-up = %d %s, want 201", resp.Code, resp.Body)
+		}
+	}
+
+	// Polka's keys are scoped to its API key, so a wrong key can't take them.
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": alice.ID.String()}}
+	api.doWithHeaders("POST", "/api/polka/webhooks", "ApiKey wrong", upgrade, withKey("evt_1"))
+	if resp := api.doWithHeaders("POST", "/api/polka/webhooks", "ApiKey "+testenv.PolkaKey, upgrade, withKey("evt_1")); resp.Code != http.StatusNoContent || resp.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("webhook = %d %v, want a fresh 204", resp.Code, resp.Header())
+	}
+	if resp := api.doWithHeaders("POST", "/api/polka/webhooks", "ApiKey "+testenv.PolkaKey, upgrade, withKey("evt_1")); resp.Code != http.StatusNoContent || resp.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("redelivered webhook = %d %v, want a replayed 204", resp.Code, resp.Header())
+	}
+}
+
+func TestContentNegotiation(t *testing.T) {
+	api := newAPITest(t)
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	var created chirp
+	for _, body := range []string{"first", "second"} {
+		api.expect("POST", "/api/chirps", alice.Token, map[string]string{"body": body}, http.StatusCreated).decode(t, &created)
+	}
+	accept := func(path, mediaType string) response {
+		t.Helper()
+		return api.doWithHeaders("GET", path, "", nil, http.Header{"Accept": {mediaType}})
+	}
+
+	resp := accept("/api/v2/chirps", utils.MediaNDJSON)
+	if resp.Header().Get("Content-Type") != utils.MediaNDJSON {
+		t.Fatalf("Content-Type = %q", resp.Header().Get("Content-Type"))
+	}
+	lines := strings.Split(strings.TrimSuffix(resp.Body.String(), "\n"), "\n")
+	if len(lines) != 2 || !strings.Contains(lines[1], `"body":"second"`) || !strings.Contains(lines[1], `"is_chirpy_red":false`) {
+		t.Errorf("NDJSON chirps = %q", resp.Body)
+	}
+
+	resp = accept("/api/chirps/"+created.ID.String(), utils.MediaCBOR)
+	var doc map[string]any
+	if err := cbor.Unmarshal(resp.Body.Bytes(), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if resp.Header().Get("Content-Type") != utils.MediaCBOR || doc["id"] != created.ID.String() || doc["body"] != "second" {
+		t.Errorf("CBOR chirp = %v with %v", doc, resp.Header())
+	}
+	jsonETag := api.expect("GET", "/api/chirps/"+created.ID.String(), "", nil, http.StatusOK).Header().Get("ETag")
+	cborETag := resp.Header().Get("ETag")
+	if cborETag == jsonETag {
+		t.Errorf("CBOR and JSON share the ETag %s", cborETag)
+	}
+	revalidate := api.doWithHeaders("GET", "/api/chirps/"+created.ID.String(), "", nil, http.Header{
+		"Accept":        {utils.MediaCBOR},
+		"If-None-Match": {cborETag},
+	})
+	if revalidate.Code != http.StatusNotModified || revalidate.Header().Get("ETag") != cborETag {
+		t.Errorf("revalidating the CBOR chirp = %d with ETag %s, want 304 with %s", revalidate.Code, revalidate.Header().Get("ETag"), cborETag)
+	}
+
+	resp = accept("/api/chirps", utils.MediaMsgPack)
+	var chirps []map[string]any
+	if err := msgpack.Unmarshal(resp.Body.Bytes(), &chirps); err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 2 || chirps[0]["body"] != "first" {
+		t.Errorf("MessagePack chirps = %v", chirps)
+	}
+}
+
+func TestReadinessFailure(t *testing.T) {
+	api := newAPITest(t)
+	readiness := &health.Checker{}
+	readiness.Register("database", 0, func(context.Context) error { return errors.New("connection refused") })
+	readiness.Register("disk", 0, func(context.Context) error { return nil })
+	api.cfg.Readiness = readiness
+
+	var report health.Report
+	api.expect("GET", "/api/readyz", "", nil, http.StatusServiceUnavailable).decode(t, &report)
+	if report.Status != health.StatusFail || len(report.Checks) != 2 {
+		t.Fatalf("report = %+v, want both checks and a failure", report)
+	}
+	if report.Checks[0].Error != "connection refused" || report.Checks[1].Status != health.StatusOK {
+		t.Errorf("checks = %+v", report.Checks)
+	}
+
+	// Liveness and the old health check don't depend on the database.
+	api.expect("GET", "/api/livez", "", nil, http.StatusOK)
+	api.expect("GET", "/api/healthz", "", nil, http.StatusOK)
+}
+
+func TestErrorEnvelope(t *testing.T) {
+	api := newAPITest(t)
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   any
+		status int
+		code   string
+		fields []string
+	}{
+		{"duplicate email", "POST", "/api/users", "", map[string]string{"email": alice.Email, "password": "x"}, http.StatusConflict, utils.CodeEmailTaken, nil},
+		{"malformed JSON", "POST", "/api/login", "", []byte(`{"email":`), http.StatusBadRequest, utils.CodeInvalidJSON, nil},
+		{"bad credentials", "POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "x"}, http.StatusUnauthorized, utils.CodeInvalidCredentials, nil},
+		{"missing token", "POST", "/api/chirps", "", map[string]string{"body": "hi"}, http.StatusUnauthorized, utils.CodeUnauthorized, nil},
+		{"chirp too long", "POST", "/api/chirps", alice.Token, map[string]string{"body": strings.Repeat("a", 141)}, http.StatusBadRequest, utils.CodeValidationFailed, []string{"body"}},
+		{"invalid sign up", "POST", "/api/users", "", map[string]string{"email": "nope", "password": " "}, http.StatusBadRequest, utils.CodeValidationFailed, []string{"password", "email"}},
+		{"unknown field", "POST", "/api/chirps", alice.Token, map[string]any{"body": "hi", "pinned": true}, http.StatusBadRequest, utils.CodeValidationFailed, []string{"pinned"}},
+		{"bad chirp ID", "GET", "/api/chirps/not-a-uuid", "", nil, http.StatusBadRequest, utils.CodeBadRequest, nil},
+		{"missing chirp", "GET", "/api/chirps/" + uuid.NewString(), "", nil, http.StatusNotFound, utils.CodeNotFound, nil},
+		{"not an admin", "GET", "/admin/reports", alice.Token, nil, http.StatusForbidden, utils.CodeForbidden, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := api.do(tt.method, tt.path, tt.token, tt.body)
+			if resp.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", resp.Code, tt.status, resp.Body.String())
+			}
+			if got := resp.Header().Get("Content-Type"); got != "application/problem+json" {
+				t.Errorf("Content-Type = %q", got)
+			}
+
+			var problem utils.Problem
+			resp.decode(t, &problem)
+			if problem.Code != tt.code || problem.Status != tt.status || problem.Type != utils.ProblemTypePrefix+tt.code {
+				t.Errorf("problem = %+v, want code %s", problem, tt.code)
+			}
+			if problem.Instance != strings.Split(tt.path, "?")[0] {
+				t.Errorf("instance = %q, want %q", problem.Instance, tt.path)
+			}
+			var fields []string
+			for _, detail := range problem.Errors {
+				fields = append(fields, detail.Field)
+			}
+			if strings.Join(fields, ",") != strings.Join(tt.fields, ",") {
+				t.Errorf("field errors = %+v, want %v", problem.Errors, tt.fields)
+			}
+		})
+	}
+}
+
+// TestClientErrorCodes keeps the client's copies of the error codes in step
+// with the ones the server sends.
+func TestClientErrorCodes(t *testing.T) {
+	codes := []struct{ client, server string }{
+		{client.CodeBadRequest, utils.CodeBadRequest},
+		{client.CodeInvalidJSON, utils.CodeInvalidJSON},
+		{client.CodeBodyTooLarge, utils.CodeBodyTooLarge},
+		{client.CodeValidationFailed, utils.CodeValidationFailed},
+		{client.CodeContentRejected, utils.CodeContentRejected},
+		{client.CodeUnauthorized, utils.CodeUnauthorized},
+		{client.CodeInvalidCredentials, utils.CodeInvalidCredentials},
+		{client.CodeForbidden, utils.CodeForbidden},
+		{client.CodeAccountSuspended, utils.CodeAccountSuspended},
+		{client.CodeNotFound, utils.CodeNotFound},
+		{client.CodeConflict, utils.CodeConflict},
+		{client.CodeEmailTaken, utils.CodeEmailTaken},
+		{client.CodePreconditionFailed, utils.CodePreconditionFailed},
+		{client.CodeIdempotencyReused, utils.CodeIdempotencyReused},
+		{client.CodeIdempotencyInUse, utils.CodeIdempotencyInUse},
+		{client.CodeRateLimited, utils.CodeRateLimited},
+		{client.CodeInternal, utils.CodeInternal},
+	}
+	for _, c := range codes {
+		if c.client != c.server {
+			t.Errorf("client code %q, server code %q", c.client, c.server)
+		}
+	}
+}
+
+func TestErrorRequestID(t *testing.T) {
+	api := newAPITest(t)
+	handler := middleWare.MiddlewareLogging(slog.New(slog.NewTextHandler(io.Discard, nil)), logging.NewRedactionPolicy(), api.handler)
+
+	req := httptest.NewRequest("GET", "/api/chirps/"+uuid.NewString(), nil)
+	req.Header.Set("X-Request-ID", "req-123")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	var problem utils.Problem
+	response{rec}.decode(t, &problem)
+	if problem.RequestID != "req-123" {
+		t.Errorf("request_id = %q, want req-123", problem.RequestID)
+	}
+}
+
+func TestAccessLogThroughServeChain(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider())
+	t.Cleanup(func() { otel.SetTracerProvider(previous) })
+
+	api := newAPITest(t)
+	var logs bytes.Buffer
+	handler := httpHandler(api.mux, logging.New(&logs, slog.LevelInfo, logging.NewRedactionPolicy()), logging.NewRedactionPolicy(),
+		metrics.New(nil), corsPolicy(config.Default().CORS),
+		&middleWare.RateLimiter{Store: middleWare.NewMemoryRateLimitStore(), Rules: rateLimitRules, Canonical: canonicalPattern},
+		&middleWare.Idempotency{Store: middleWare.NewMemoryIdempotencyStore(), Routes: idempotentRoutes, TTL: time.Hour, Canonical: canonicalPattern})
+
+	req := httptest.NewRequest("GET", "/api/chirps/"+uuid.NewString(), nil)
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	var line struct {
+		Msg     string `json:"msg"`
+		Route   string `json:"route"`
+		TraceID string `json:"trace_id"`
+		Status  int    `json:"status"`
+	}
+	if err := json.Unmarshal(logs.Bytes(), &line); err != nil {
+		t.Fatalf("access log %q: %v", logs.String(), err)
+	}
+	if line.Msg != "request" || line.Route != "GET /api/chirps/{chirpID}" || line.Status != http.StatusNotFound || len(line.TraceID) != 32 {
+		t.Errorf("access log = %s", logs.String())
+	}
+}
+
+func TestRefreshTokenExpires(t *testing.T) {
+	api := newAPITest(t)
+	now := time.Now()
+	api.store.Now = func() time.Time { return now }
+
+	alice := api.signUp("alice@example.com", auth.RoleUser)
+	api.expect("POST", "/api/refresh", alice.RefreshToken, nil, http.StatusOK)
+
+	now = now.Add(memstore.RefreshTokenLifetime + time.Minute)
+	api.expect("POST", "/api/refresh", alice.RefreshToken, nil, http.StatusUnauthorized)
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/k3vwdd/chirpyWS/internal/config"
+	"github.com/k3vwdd/chirpyWS/internal/database"
+	"github.com/k3vwdd/chirpyWS/internal/feed"
+	"github.com/k3vwdd/chirpyWS/internal/grpcapi"
+	"github.com/k3vwdd/chirpyWS/internal/health"
+	"github.com/k3vwdd/chirpyWS/internal/logging"
+	"github.com/k3vwdd/chirpyWS/internal/metrics"
+	"github.com/k3vwdd/chirpyWS/internal/middleWare"
+	"github.com/k3vwdd/chirpyWS/internal/migrations"
+	"github.com/k3vwdd/chirpyWS/internal/moderation"
+	"github.com/k3vwdd/chirpyWS/internal/tracing"
+	"github.com/k3vwdd/chirpyWS/internal/types"
+	_ "github.com/lib/pq"
+	"google.golang.org/grpc"
+)
+
+// serve runs the HTTP server until SIGINT or SIGTERM. It returns an error
+// if the server couldn't start or stopped on its own, after cleaning up.
+func serve(args []string) error {
+	conf, err := config.Load(args, config.Options{})
+	if errors.Is(err, flag.ErrHelp) {
+		return nil
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	redactionPolicy := logging.NewRedactionPolicy(conf.LogRedactFields...)
+	logger := logging.New(os.Stdout, conf.LogLevel, redactionPolicy)
+	slog.SetDefault(logger)
+
+	shutdownTracing, err := tracing.Setup(context.Background(), conf.TracesExporter, "chirpy")
+	if err != nil {
+		return fmt.Errorf("setting up tracing: %w", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	db, err := sql.Open("postgres", conf.DBURL)
+	if err != nil {
+		return fmt.Errorf("opening database: %w", err)
+	}
+	defer func() {
+		if err := db.Close(); err != nil {
+			slog.Error("closing database", "err", err)
+		}
+	}()
+
+	migrator, err := migrations.New(db)
+	if err != nil {
+		return fmt.Errorf("loading migrations: %w", err)
+	}
+	if conf.Migrate {
+		results, err := migrator.Up(ctx)
+		if err != nil {
+			return fmt.Errorf("applying migrations: %w", err)
+		}
+		for _, result := range results {
+			slog.Info("applied migration", "version", result.Source.Version, "duration", result.Duration)
+		}
+	}
+	if err := migrator.Check(ctx); err != nil {
+		return fmt.Errorf("checking schema version: %w", err)
+	}
+
+	dbQueries := database.New(tracing.WrapDB(db))
+	appMetrics := metrics.New(db)
+
+	moderationEngine := moderation.NewEngine(dbQueries)
+	if err := moderationEngine.Reload(context.Background()); err != nil {
+		return fmt.Errorf("loading moderation rules: %w", err)
+	}
+	go moderationEngine.Watch(ctx, 30*time.Second)
+
+	// streamsCtx is cancelled as soon as draining starts so long-lived
+	// streams hang up instead of holding the shutdown open.
+	streamsCtx, closeStreams := context.WithCancel(context.Background())
+	defer closeStreams()
+
+	readiness := &health.Checker{}
+	readiness.Register("database", time.Second, health.Ping(db))
+	readiness.Register("migrations", 2*time.Second, migrator.Check)
+	readiness.Register("disk", time.Second, health.DiskSpace(conf.MediaDir, uint64(conf.MinFreeDiskMB)<<20))
+	// Report not ready while draining so load balancers move on first.
+	readiness.Register("shutdown", 0, func(context.Context) error {
+		if streamsCtx.Err() != nil {
+			return errors.New("shutting down")
+		}
+		return nil
+	})
+
+	apiCfg := &types.ApiConfig{
+		Db:                  dbQueries,
+		Metrics:             appMetrics,
+		Platform:            conf.Platform,
+		JWTKEY:              conf.JWTKey,
+		APIKEY:              conf.PolkaKey,
+		Moderation:          moderationEngine,
+		ReportHideThreshold: conf.ReportHideThreshold,
+		Readiness:           readiness,
+		StreamsCtx:          streamsCtx,
+		ChirpFeed:           feed.New(),
+	}
+
+	var rateLimitStore middleWare.RateLimitStore = middleWare.NewMemoryRateLimitStore()
+	if conf.RateLimitStore == "postgres" {
+		pgStore := &middleWare.PostgresRateLimitStore{Db: dbQueries}
+		go func() {
+			ticker := time.NewTicker(10 * time.Minute)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if err := pgStore.Prune(ctx, time.Hour); err != nil {
+					slog.Error("pruning rate limit buckets", "err", err)
+				}
+			}
+		}()
+		rateLimitStore = pgStore
+	}
+
+	limiter := &middleWare.RateLimiter{
+		Store:          rateLimitStore,
+		JWTKEY:         conf.JWTKey,
+		TrustedProxies: conf.TrustedProxies,
+		Rules:          rateLimitRules,
+		IsChirpyRed: func(ctx context.Context, userID uuid.UUID) (bool, error) {
+			user, err := dbQueries.GetUserByID(ctx, userID)
+			return user.IsChirpyRed, err
+		},
+		Canonical: canonicalPattern,
+	}
+	apiCfg.RateLimiter = limiter
+
+	var idempotencyStore middleWare.IdempotencyStore = middleWare.NewMemoryIdempotencyStore()
+	if conf.IdempotencyStore == "postgres" {
+		pgStore := &middleWare.PostgresIdempotencyStore{Db: dbQueries}
+		go func() {
+			ticker := time.NewTicker(10 * time.Minute)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+				}
+				if err := pgStore.Prune(ctx); err != nil {
+					slog.Error("pruning idempotency keys", "err", err)
+				}
+			}
+		}()
+		idempotencyStore = pgStore
+	}
+
+	idempotency := &middleWare.Idempotency{
+		Store:     idempotencyStore,
+		TTL:       conf.IdempotencyTTL,
+		JWTKEY:    conf.JWTKey,
+		Routes:    idempotentRoutes,
+		Canonical: canonicalPattern,
+	}
+
+	filepathRoot := conf.MediaDir
+	mux := newMux(routes(apiCfg, filepathRoot))
+	loggedMux := httpHandler(mux, logger, redactionPolicy, appMetrics, corsPolicy(conf.CORS), limiter, idempotency)
+
+	port := strconv.Itoa(conf.Port)
+	shutdownTimeout := conf.ShutdownTimeout
+
+	// a struct that describes a server configuration
+	server := &http.Server{
+		Addr:              ":" + port,
+		Handler:           loggedMux,
+		ReadHeaderTimeout: conf.ReadHeaderTimeout,
+		ReadTimeout:       conf.ReadTimeout,
+		WriteTimeout:      conf.WriteTimeout,
+		IdleTimeout:       conf.IdleTimeout,
+		MaxHeaderBytes:    conf.MaxHeaderBytes,
+	}
+	// Shutdown doesn't wait for hijacked or streaming connections, so tell
+	// them to finish up themselves.
+	server.RegisterOnShutdown(closeStreams)
+
+	serveErr := make(chan error, 2)
+	go func() {
+		slog.Info("serving", "root", filepathRoot, "port", port)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	var grpcServer *grpc.Server
+	if conf.GRPCPort != 0 {
+		listener, err := net.Listen("tcp", ":"+strconv.Itoa(conf.GRPCPort))
+		if err != nil {
+			server.Close()
+			return fmt.Errorf("listening for gRPC: %w", err)
+		}
+		grpcServer = grpcapi.NewServer(apiCfg, logger)
+		go func() {
+			slog.Info("serving gRPC", "port", conf.GRPCPort)
+			serveErr <- grpcServer.Serve(listener)
+		}()
+	}
+
+	var serveFailed error
+	select {
+	case err := <-serveErr:
+		// One server died; stop the other so the deferred cleanup runs
+		// and the process exits instead of serving half the API.
+		serveFailed = fmt.Errorf("server stopped: %w", err)
+		closeStreams()
+		server.Close()
+		if grpcServer != nil {
+			grpcServer.Stop()
+		}
+	case <-ctx.Done():
+		stop()
+		slog.Info("shutting down", "timeout", shutdownTimeout)
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		// gRPC watches only end once the streams context is done.
+		closeStreams()
+		if err := server.Shutdown(drainCtx); err != nil {
+			slog.Error("draining requests", "err", err)
+			server.Close()
+		}
+		if grpcServer != nil {
+			stopped := make(chan struct{})
+			go func() {
+				grpcServer.GracefulStop()
+				close(stopped)
+			}()
+			select {
+			case <-stopped:
+			case <-drainCtx.Done():
+				slog.Error("draining gRPC calls", "err", drainCtx.Err())
+				grpcServer.Stop()
+			}
+		}
+	}
+
+	if serveFailed != nil {
+		return serveFailed
+	}
+	slog.Info("stopped")
+	return nil
+}
+
+// httpHandler wraps mux in the middleware every HTTP request goes through.
+// It is built from the inside out, so logging sees requests first.
+func httpHandler(mux *http.ServeMux, logger *slog.Logger, policy logging.RedactionPolicy, m *metrics.Metrics,
+	cors middleWare.CORSPolicy, limiter *middleWare.RateLimiter, idempotency *middleWare.Idempotency) http.Handler {
+	var handler http.Handler = middleWare.MiddlewareRecordRoute(mux)
+	handler = idempotency.Middleware(mux, handler)
+	handler = limiter.Middleware(mux, handler)
+	handler = middleWare.MiddlewareCompression(handler)
+	handler = cors.Middleware(handler)
+	handler = middleWare.MiddlewareRequestMetrics(m, handler)
+	handler = middleWare.MiddlewareTracing(handler)
+	return middleWare.MiddlewareLogging(logger, policy, handler)
+}
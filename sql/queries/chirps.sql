@@ -1,11 +1,14 @@
 -- name: CreateChirp :one
-INSERT INTO chirps (id, created_at, updated_at, body, user_id)
-VALUES ($1, $2, $3, $4, $5)
+INSERT INTO chirps (id, created_at, updated_at, body, user_id, status)
+VALUES ($1, $2, $3, $4, $5, $6)
 RETURNING *;
 -- name: GetAllChirps :many
-SELECT *
+SELECT chirps.*
 FROM chirps
-ORDER BY created_at ASC;
+INNER JOIN users ON users.id = chirps.user_id
+WHERE chirps.status = 'published'
+    AND (users.shadow_banned = FALSE OR chirps.user_id = sqlc.arg(viewer_id))
+ORDER BY chirps.created_at ASC;
 -- name: GetChirpByID :one
 SELECT *
 FROM chirps
@@ -13,8 +16,42 @@ WHERE id = $1;
 -- name: DeleteChirpByID :exec
 DELETE FROM chirps
 WHERE id = $1;
+-- name: DeleteChirpIfUnchanged :execrows
+DELETE FROM chirps
+WHERE id = $1
+    AND updated_at = $2;
 -- name: GetChirpsByAuthorID :many
+SELECT chirps.*
+FROM chirps
+INNER JOIN users ON users.id = chirps.user_id
+WHERE chirps.user_id = sqlc.arg(user_id)
+    AND chirps.status = 'published'
+    AND (users.shadow_banned = FALSE OR chirps.user_id = sqlc.arg(viewer_id))
+ORDER BY chirps.created_at ASC;
+-- name: UpdateChirpStatus :exec
+UPDATE chirps
+SET
+    status = $2,
+    updated_at = NOW()
+WHERE
+    id = $1;
+-- name: DeleteChirpsByAuthorID :execrows
+DELETE FROM chirps
+WHERE user_id = $1;
+-- name: ListAllChirps :many
+SELECT *
+FROM chirps
+ORDER BY created_at ASC;
+-- name: ListChirpsByStatus :many
 SELECT *
 FROM chirps
-WHERE user_id = $1
+WHERE status = $1
 ORDER BY created_at ASC;
+-- name: TransitionChirpStatus :execrows
+UPDATE chirps
+SET
+    status = sqlc.arg(new_status),
+    updated_at = NOW()
+WHERE
+    id = sqlc.arg(id)
+    AND status = sqlc.arg(old_status);
@@ -0,0 +1,33 @@
+-- name: ClaimIdempotencyKey :execrows
+INSERT INTO idempotency_keys AS k (key, request_hash, claim, created_at, expires_at)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT (key) DO UPDATE
+SET
+    request_hash = EXCLUDED.request_hash,
+    claim = EXCLUDED.claim,
+    status = 0,
+    headers = '{}',
+    body = '',
+    created_at = EXCLUDED.created_at,
+    expires_at = EXCLUDED.expires_at
+WHERE k.expires_at < EXCLUDED.created_at;
+-- name: GetIdempotencyKey :one
+SELECT *
+FROM idempotency_keys
+WHERE key = $1;
+-- name: CompleteIdempotencyKey :exec
+UPDATE idempotency_keys
+SET
+    status = $3,
+    headers = $4,
+    body = $5,
+    expires_at = $6
+WHERE key = $1
+    AND claim = $2;
+-- name: DeleteIdempotencyKey :exec
+DELETE FROM idempotency_keys
+WHERE key = $1
+    AND claim = $2;
+-- name: DeleteExpiredIdempotencyKeys :exec
+DELETE FROM idempotency_keys
+WHERE expires_at < $1;
@@ -0,0 +1,39 @@
+-- name: CreateModerationRule :one
+INSERT INTO moderation_rules (id, created_at, updated_at, kind, pattern, action, enabled)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5)
+RETURNING *;
+-- name: ListModerationRules :many
+SELECT *
+FROM moderation_rules
+ORDER BY created_at ASC;
+-- name: ListEnabledModerationRules :many
+SELECT *
+FROM moderation_rules
+WHERE enabled = TRUE
+ORDER BY created_at ASC;
+-- name: GetModerationRuleByID :one
+SELECT *
+FROM moderation_rules
+WHERE id = $1;
+-- name: UpdateModerationRule :one
+UPDATE moderation_rules
+SET
+    kind = $2,
+    pattern = $3,
+    action = $4,
+    enabled = $5,
+    updated_at = NOW()
+WHERE
+    id = $1
+RETURNING *;
+-- name: DeleteModerationRule :exec
+DELETE FROM moderation_rules
+WHERE id = $1;
+-- name: CreateModerationHit :exec
+INSERT INTO moderation_hits (id, created_at, rule_id, chirp_id, user_id, matched, action)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6);
+-- name: GetModerationHitsByChirpID :many
+SELECT *
+FROM moderation_hits
+WHERE chirp_id = $1
+ORDER BY created_at ASC;
@@ -0,0 +1,16 @@
+-- name: TakeRateLimitToken :one
+INSERT INTO rate_limit_buckets AS b (key, tokens, allowed, updated_at)
+VALUES (sqlc.arg(key), sqlc.arg(burst)::float8 - 1, TRUE, NOW())
+ON CONFLICT (key) DO UPDATE
+SET
+    allowed = LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1,
+    tokens = LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * sqlc.arg(rate)::float8)
+        - CASE
+            WHEN LEAST(sqlc.arg(burst)::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at)::float8 * sqlc.arg(rate)::float8) >= 1 THEN 1
+            ELSE 0
+        END,
+    updated_at = NOW()
+RETURNING tokens, allowed;
+-- name: DeleteStaleRateLimitBuckets :exec
+DELETE FROM rate_limit_buckets
+WHERE updated_at < $1;
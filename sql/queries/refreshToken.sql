@@ -3,7 +3,8 @@ SELECT
     users.id,
     users.email,
     users.created_at,
-    users.updated_at
+    users.updated_at,
+    users.suspended_until
 FROM
     users
 INNER JOIN
@@ -20,3 +21,8 @@ UPDATE refresh_tokens
 SET revoked_at = NOW()
 WHERE token = $1;
 
+-- name: RevokeRefreshTokensForUser :execrows
+UPDATE refresh_tokens
+SET revoked_at = NOW()
+WHERE user_id = $1
+    AND revoked_at IS NULL;
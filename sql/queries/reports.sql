@@ -0,0 +1,76 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, created_at, updated_at, chirp_id, reporter_id, reason, details)
+VALUES ($1, NOW(), NOW(), $2, $3, $4, $5)
+RETURNING *;
+-- name: CountUnresolvedReportsForChirp :one
+SELECT COUNT(*)
+FROM reports
+WHERE chirp_id = $1
+    AND status <> 'resolved';
+-- name: GetReportByID :one
+SELECT *
+FROM reports
+WHERE id = $1;
+-- name: ListReportsByStatus :many
+SELECT
+    reports.id,
+    reports.created_at,
+    reports.chirp_id,
+    reports.reporter_id,
+    reports.reason,
+    reports.details,
+    reports.status,
+    reports.claimed_by,
+    chirps.body AS chirp_body,
+    chirps.user_id AS chirp_author_id,
+    chirps.status AS chirp_status
+FROM
+    reports
+INNER JOIN
+    chirps ON chirps.id = reports.chirp_id
+WHERE
+    reports.status = $1
+ORDER BY
+    reports.created_at ASC;
+-- name: ClaimReport :one
+UPDATE reports
+SET
+    status = 'claimed',
+    claimed_by = $2,
+    claimed_at = NOW(),
+    updated_at = NOW()
+WHERE
+    id = $1
+    AND status = 'open'
+RETURNING *;
+-- name: ResolveReport :execrows
+UPDATE reports
+SET
+    status = 'resolved',
+    resolved_by = sqlc.arg(resolved_by),
+    resolved_at = NOW(),
+    resolution = sqlc.arg(resolution),
+    updated_at = NOW()
+WHERE
+    id = sqlc.arg(id)
+    AND status <> 'resolved'
+    AND (claimed_by IS NULL OR claimed_by = sqlc.arg(resolved_by) OR sqlc.arg(override_claim)::boolean);
+-- name: ResolveReportsForChirp :exec
+UPDATE reports
+SET
+    status = 'resolved',
+    resolved_by = $2,
+    resolved_at = NOW(),
+    resolution = $3,
+    updated_at = NOW()
+WHERE
+    chirp_id = $1
+    AND (status = 'open' OR (status = 'claimed' AND claimed_by = $2));
+-- name: CreateModerationAuditEntry :exec
+INSERT INTO moderation_audit_log (id, created_at, moderator_id, action, report_id, chirp_id, target_user_id, note)
+VALUES ($1, NOW(), $2, $3, $4, $5, $6, $7);
+-- name: ListModerationAuditEntries :many
+SELECT *
+FROM moderation_audit_log
+ORDER BY created_at DESC
+LIMIT $1;
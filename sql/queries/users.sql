@@ -11,7 +11,7 @@ RETURNING *;
 -- name: DeleteAllUsers :exec
 DELETE FROM users;
 -- name: GetUserByEmail :one
-SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, suspended_until, shadow_banned
 FROM users
 WHERE email = $1
 LIMIT 1;
@@ -30,7 +30,10 @@ SELECT
     updated_at,
     email,
     hashed_password,
-    is_chirpy_red
+    is_chirpy_red,
+    role,
+    suspended_until,
+    shadow_banned
 FROM
     users
 WHERE
@@ -40,4 +43,32 @@ LIMIT 1;
 UPDATE users
 SET is_chirpy_red = TRUE
 WHERE id = $1;
-
+-- name: SuspendUser :exec
+UPDATE users
+SET
+    suspended_until = $2,
+    updated_at = NOW()
+WHERE
+    id = $1;
+-- name: SetUserShadowBanned :exec
+UPDATE users
+SET
+    shadow_banned = $2,
+    updated_at = NOW()
+WHERE
+    id = $1;
+-- name: SetUserRole :exec
+UPDATE users
+SET
+    role = $2,
+    updated_at = NOW()
+WHERE
+    id = $1;
+-- name: ListUsers :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, suspended_until, shadow_banned
+FROM users
+ORDER BY created_at ASC;
+-- name: GetUsersByIDs :many
+SELECT id, created_at, updated_at, email, hashed_password, is_chirpy_red, role, suspended_until, shadow_banned
+FROM users
+WHERE id = ANY(sqlc.arg(ids)::uuid[]);
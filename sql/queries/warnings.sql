@@ -0,0 +1,9 @@
+-- name: CreateUserWarning :one
+INSERT INTO user_warnings (id, created_at, user_id, chirp_id, reason, note)
+VALUES ($1, NOW(), $2, $3, $4, $5)
+RETURNING *;
+-- name: ListUserWarnings :many
+SELECT *
+FROM user_warnings
+WHERE user_id = $1
+ORDER BY created_at DESC;
@@ -2,3 +2,6 @@
 ALTER TABLE users
 ADD COLUMN is_chirpy_red BOOLEAN DEFAULT FALSE;
 
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN is_chirpy_red;
@@ -0,0 +1,48 @@
+-- +goose Up
+ALTER TABLE chirps
+ADD COLUMN status TEXT NOT NULL DEFAULT 'published';
+
+CREATE TABLE moderation_rules (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    kind TEXT NOT NULL CHECK (kind IN ('word', 'regex')),
+    pattern TEXT NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('mask', 'reject', 'hold')),
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    UNIQUE (kind, pattern)
+);
+
+CREATE TABLE moderation_hits (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    rule_id UUID NOT NULL,
+    chirp_id UUID NULL,
+    user_id UUID NOT NULL,
+    matched TEXT NOT NULL,
+    action TEXT NOT NULL,
+    CONSTRAINT fk_rule
+        FOREIGN KEY (rule_id)
+        REFERENCES moderation_rules(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id)
+        REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE
+);
+
+INSERT INTO moderation_rules (kind, pattern, action)
+VALUES
+    ('word', 'kerfuffle', 'mask'),
+    ('word', 'sharbert', 'mask'),
+    ('word', 'fornax', 'mask');
+
+-- +goose Down
+DROP TABLE IF EXISTS moderation_hits;
+DROP TABLE IF EXISTS moderation_rules;
+ALTER TABLE chirps
+DROP COLUMN status;
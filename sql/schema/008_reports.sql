@@ -0,0 +1,57 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP NULL;
+
+CREATE TABLE reports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    chirp_id UUID NOT NULL,
+    reporter_id UUID NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('spam', 'harassment', 'hate_speech', 'violence', 'sexual_content', 'misinformation', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'resolved')),
+    claimed_by UUID NULL,
+    claimed_at TIMESTAMP NULL,
+    resolved_by UUID NULL,
+    resolved_at TIMESTAMP NULL,
+    resolution TEXT NULL,
+    UNIQUE (chirp_id, reporter_id),
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id)
+        REFERENCES chirps(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_reporter
+        FOREIGN KEY (reporter_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_claimed_by
+        FOREIGN KEY (claimed_by)
+        REFERENCES users(id)
+        ON DELETE SET NULL,
+    CONSTRAINT fk_resolved_by
+        FOREIGN KEY (resolved_by)
+        REFERENCES users(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at);
+
+-- The audit log keeps plain ids without foreign keys so entries survive the
+-- removal of the chirps and users they describe.
+CREATE TABLE moderation_audit_log (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    moderator_id UUID NOT NULL,
+    action TEXT NOT NULL,
+    report_id UUID NULL,
+    chirp_id UUID NULL,
+    target_user_id UUID NULL,
+    note TEXT NOT NULL DEFAULT ''
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS moderation_audit_log;
+DROP TABLE IF EXISTS reports;
+ALTER TABLE users
+DROP COLUMN suspended_until;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- claim identifies the request holding a key, so one whose claim expired
+-- and was taken over can't store or delete the new claimant's record.
+ALTER TABLE idempotency_keys
+ADD COLUMN claim UUID NOT NULL DEFAULT gen_random_uuid();
+
+-- +goose Down
+ALTER TABLE idempotency_keys
+DROP COLUMN claim;
@@ -0,0 +1,24 @@
+-- +goose Up
+-- A warning is what a user sees when a moderator resolves a report on one
+-- of their chirps with warn_user.
+CREATE TABLE user_warnings (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    user_id UUID NOT NULL,
+    chirp_id UUID NULL,
+    reason TEXT NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    CONSTRAINT fk_user
+        FOREIGN KEY (user_id)
+        REFERENCES users(id)
+        ON DELETE CASCADE,
+    CONSTRAINT fk_chirp
+        FOREIGN KEY (chirp_id)
+        REFERENCES chirps(id)
+        ON DELETE SET NULL
+);
+
+CREATE INDEX user_warnings_user_id_idx ON user_warnings (user_id, created_at);
+
+-- +goose Down
+DROP TABLE IF EXISTS user_warnings;